@@ -1,7 +1,16 @@
 // Definitions of structures that map to the command line arguments
 package main
 
-import "github.com/alexflint/go-arg"
+import (
+	"fmt"
+	"math"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/alexflint/go-arg"
+	"github.com/szymonwieloch/go-teleport/client/proto/teleportproto"
+)
 
 type JobID string
 
@@ -9,15 +18,197 @@ type listCmd struct {
 }
 
 type startCmd struct {
-	Command []string `arg:"positional,required" help:"Command to run"`
+	Env        map[string]string `arg:"--env" help:"Extra environment variables of the job, in the KEY=VALUE format"`
+	Dir        string            `arg:"--dir" help:"Working directory of the job"`
+	CleanEnv   bool              `arg:"--clean-env" help:"Do not inherit any environment variables from the server"`
+	Stdin      bool              `arg:"--stdin" help:"Keep the standard input of the job open for the stdin command"`
+	Tty        bool              `arg:"-t,--tty" help:"Run the job in a terminal and attach to it"`
+	Raw        bool              `arg:"--raw" help:"Capture output as chunks of bytes preserved exactly, the log command writes them without timestamps"`
+	Class      string            `arg:"--class" help:"Named set of resource limits, for example small or large [default: server configuration]"`
+	Memory     byteSize          `arg:"--memory" help:"Maximal memory usage of the job, K, M and G suffixes are accepted"`
+	CPUs       float64           `arg:"--cpus" help:"Share of the CPU time as a number of CPUs, for example 0.5"`
+	Pids       int64             `arg:"--pids" help:"Maximal number of processes and threads of the job"`
+	Runtime    time.Duration     `arg:"--max-runtime" help:"Wall-clock time after which the job gets stopped [default: server configuration]"`
+	Idle       time.Duration     `arg:"--idle-timeout" help:"Time without any output after which the job gets stopped [default: server configuration]"`
+	Restart    restartPolicy     `arg:"--restart" help:"When the command is started again after it exits: never, on-failure or always [default: never]"`
+	MaxRetries uint32            `arg:"--max-retries" help:"Maximal number of restarts, unlimited if zero"`
+	Backoff    time.Duration     `arg:"--backoff" help:"Delay before the first restart, doubled after every restart [default: server default]"`
+	MaxBackoff time.Duration     `arg:"--max-backoff" help:"Maximal delay between restarts [default: server default]"`
+	Isolate    bool              `arg:"--isolate" help:"Run the job in its own PID, mount, UTS and IPC namespaces"`
+	Network    network           `arg:"--network" help:"Network of an isolated job, host or none [default: host]"`
+	Priority   int32             `arg:"--priority" help:"Jobs with a higher priority leave the server queue first, may be negative"`
+	Pipeline   bool              `arg:"--pipeline" help:"Split the command into stages of a pipeline on | arguments, quote them for the local shell"`
+	Command    []string          `arg:"positional,required" help:"Command to run"`
+}
+
+// Restart policy of a job, one of never, on-failure and always
+type restartPolicy teleportproto.RestartPolicy
+
+func (r *restartPolicy) UnmarshalText(text []byte) error {
+	switch string(text) {
+	case "never":
+		*r = restartPolicy(teleportproto.RestartPolicy_RP_NEVER)
+	case "on-failure":
+		*r = restartPolicy(teleportproto.RestartPolicy_RP_ON_FAILURE)
+	case "always":
+		*r = restartPolicy(teleportproto.RestartPolicy_RP_ALWAYS)
+	default:
+		return fmt.Errorf("unknown restart policy %q", text)
+	}
+	return nil
+}
+
+// Network of a job, either host or none
+type network teleportproto.Network
+
+func (n *network) UnmarshalText(text []byte) error {
+	switch string(text) {
+	case "host":
+		*n = network(teleportproto.Network_N_HOST)
+	case "none":
+		*n = network(teleportproto.Network_N_NONE)
+	default:
+		return fmt.Errorf("unknown network %q", text)
+	}
+	return nil
+}
+
+// Non-negative number of bytes with an optional K, M or G suffix
+type byteSize int64
+
+func (b *byteSize) UnmarshalText(text []byte) error {
+	s := string(text)
+	multiplier := int64(1)
+	switch {
+	case strings.HasSuffix(s, "K"):
+		multiplier = 1 << 10
+	case strings.HasSuffix(s, "M"):
+		multiplier = 1 << 20
+	case strings.HasSuffix(s, "G"):
+		multiplier = 1 << 30
+	}
+	if multiplier != 1 {
+		s = s[:len(s)-1]
+	}
+	value, err := strconv.ParseInt(s, 10, 64)
+	if err != nil {
+		return err
+	}
+	if value < 0 {
+		return fmt.Errorf("negative size %q", text)
+	}
+	if value > math.MaxInt64/multiplier {
+		return fmt.Errorf("size %q is too large", text)
+	}
+	*b = byteSize(value * multiplier)
+	return nil
 }
 
 type stopCmd struct {
-	JobID JobID `arg:"positional,required" help:"Job ID to stop"`
+	JobID  JobID         `arg:"positional,required" help:"Job ID to stop"`
+	Signal string        `arg:"--signal" help:"Signal sent first, for example TERM or INT [default: TERM]"`
+	Grace  time.Duration `arg:"--grace" help:"Time given to the job to finish before it gets killed [default: server configuration]"`
+}
+
+type rmCmd struct {
+	JobID JobID `arg:"positional,required" help:"Job ID of a finished job to remove"`
+}
+
+type signalCmd struct {
+	JobID  JobID  `arg:"positional,required" help:"Job ID to send the signal to"`
+	Signal string `arg:"positional,required" help:"Signal name or number, for example HUP, USR1, STOP or CONT"`
+	Group  bool   `arg:"--group" help:"Send the signal to the whole process group of the job"`
 }
 
 type logCmd struct {
-	JobID JobID `arg:"positional,required" help:"Job ID to show logs"`
+	JobID    JobID       `arg:"positional,required" help:"Job ID to show logs"`
+	Start    uint64      `arg:"--start" help:"Index of the first line"`
+	Tail     uint32      `arg:"--tail" help:"Show only the given number of the last lines"`
+	Since    pointInTime `arg:"--since" help:"Show only lines produced since the time, a duration like 10m before now or a time in the RFC 3339 format"`
+	Until    pointInTime `arg:"--until" help:"Show only lines produced until the time, a duration like 10m before now or a time in the RFC 3339 format"`
+	NoFollow bool        `arg:"--no-follow" help:"Stop after lines produced so far instead of waiting for the job to finish"`
+	Stdout   bool        `arg:"--stdout" help:"Show only the standard output"`
+	Stderr   bool        `arg:"--stderr" help:"Show only the standard error"`
+}
+
+// Point in time given either as a duration before now or in the RFC 3339 format
+type pointInTime time.Time
+
+func (p *pointInTime) UnmarshalText(text []byte) error {
+	ago, err := time.ParseDuration(string(text))
+	if err == nil {
+		*p = pointInTime(time.Now().Add(-ago))
+		return nil
+	}
+	t, err := time.Parse(time.RFC3339, string(text))
+	if err != nil {
+		return fmt.Errorf("invalid time %q, expected a duration or a time in the RFC 3339 format", text)
+	}
+	*p = pointInTime(t)
+	return nil
+}
+
+type stdinCmd struct {
+	JobID    JobID `arg:"positional,required" help:"Job ID to write the standard input to"`
+	KeepOpen bool  `arg:"--keep-open" help:"Do not close the standard input of the job at the end of the local input"`
+}
+
+type attachCmd struct {
+	JobID JobID `arg:"positional,required" help:"Job ID to attach to, press Ctrl-] to detach"`
+}
+
+type scheduleAddCmd struct {
+	Cron   string     `arg:"--cron" help:"Cron expression with 5 fields or a descriptor like @daily, prefix it with CRON_TZ=<zone> for a time zone other than the one of the server"`
+	At     time.Time  `arg:"--at" help:"Time of a single run in the RFC 3339 format, for example 2030-01-02T03:00:00Z"`
+	Missed missedRuns `arg:"--missed" help:"What happens with runs missed while the schedule is paused: skip or run-once [default: skip]"`
+	startCmd
+}
+
+// What happens with missed runs of a schedule, either skip or run-once
+type missedRuns teleportproto.MissedRunPolicy
+
+func (m *missedRuns) UnmarshalText(text []byte) error {
+	switch string(text) {
+	case "skip":
+		*m = missedRuns(teleportproto.MissedRunPolicy_MR_SKIP)
+	case "run-once":
+		*m = missedRuns(teleportproto.MissedRunPolicy_MR_RUN_ONCE)
+	default:
+		return fmt.Errorf("unknown missed run policy %q", text)
+	}
+	return nil
+}
+
+type ScheduleID string
+
+type scheduleIDCmd struct {
+	ScheduleID ScheduleID `arg:"positional,required" help:"Schedule ID"`
+}
+
+type scheduleCmd struct {
+	Add    *scheduleAddCmd `arg:"subcommand:add" help:"Starts a command at times given by a cron expression or once at a given time"`
+	List   *listCmd        `arg:"subcommand:list" help:"Lists all schedules"`
+	Status *scheduleIDCmd  `arg:"subcommand:status" help:"Prints status and recent runs of the schedule"`
+	Rm     *scheduleIDCmd  `arg:"subcommand:rm" help:"Deletes the schedule, jobs that it started keep running"`
+	Pause  *scheduleIDCmd  `arg:"subcommand:pause" help:"Stops starting jobs until the schedule is resumed"`
+	Resume *scheduleIDCmd  `arg:"subcommand:resume" help:"Continues starting jobs of the schedule"`
+}
+
+type workflowRunCmd struct {
+	File   string `arg:"positional,required" help:"YAML file with steps of the workflow"`
+	Detach bool   `arg:"--detach" help:"Do not follow the workflow after submitting it"`
+}
+
+type WorkflowID string
+
+type workflowIDCmd struct {
+	WorkflowID WorkflowID `arg:"positional,required" help:"Workflow ID"`
+}
+
+type workflowCmd struct {
+	Run    *workflowRunCmd `arg:"subcommand:run" help:"Submits steps from a YAML file and follows them until all of them finish"`
+	List   *listCmd        `arg:"subcommand:list" help:"Lists all workflows"`
+	Status *workflowIDCmd  `arg:"subcommand:status" help:"Prints status of the workflow and of jobs of its steps"`
 }
 
 type statusCmd struct {
@@ -25,23 +216,43 @@ type statusCmd struct {
 }
 
 type args struct {
-	Address string     `arg:"env,required" help:"Address of the server"`
-	Secret  string     `arg:"env" help:"A secret for authentication, if desired"`
-	CaPath  string     `arg:"env" help:"Path to a CA certificate for the TLS connection, if desired"`
-	Start   *startCmd  `arg:"subcommand:start" help:"Starts a new remote job"`
-	Stop    *stopCmd   `arg:"subcommand:stop" help:"Stops a remote job"`
-	List    *listCmd   `arg:"subcommand:list" help:"Lists all remote job"`
-	Log     *logCmd    `arg:"subcommand:log" help:"Shows logs of the remote job"`
-	Status  *statusCmd `arg:"subcommand:status" help:"Prints status of the remote job"`
+	Address  string       `arg:"env,required" help:"Address of the server"`
+	Secret   string       `arg:"env" help:"A secret for authentication, if desired"`
+	CaPath   string       `arg:"env" help:"Path to a CA certificate for the TLS connection, if desired"`
+	Start    *startCmd    `arg:"subcommand:start" help:"Starts a new remote job"`
+	Stop     *stopCmd     `arg:"subcommand:stop" help:"Stops a remote job"`
+	Rm       *rmCmd       `arg:"subcommand:rm" help:"Removes a finished remote job together with its logs"`
+	Signal   *signalCmd   `arg:"subcommand:signal" help:"Sends a signal to a remote job"`
+	List     *listCmd     `arg:"subcommand:list" help:"Lists all remote job"`
+	Log      *logCmd      `arg:"subcommand:log" help:"Shows logs of the remote job"`
+	Status   *statusCmd   `arg:"subcommand:status" help:"Prints status of the remote job"`
+	Stdin    *stdinCmd    `arg:"subcommand:stdin" help:"Pipes the local standard input to the remote job"`
+	Attach   *attachCmd   `arg:"subcommand:attach" help:"Attaches to the terminal of the remote job"`
+	Schedule *scheduleCmd `arg:"subcommand:schedule" help:"Manages jobs started at given times"`
+	Workflow *workflowCmd `arg:"subcommand:workflow" help:"Manages sets of jobs that depend on each other"`
 }
 
 // Parses command line arguments
 func parseArgs() args {
 	var result args
 	p := arg.MustParse(&result)
-	if result.Start == nil && result.Stop == nil && result.List == nil && result.Log == nil && result.Status == nil {
+	if result.Start == nil && result.Stop == nil && result.Rm == nil && result.Signal == nil && result.List == nil && result.Log == nil && result.Status == nil && result.Stdin == nil && result.Attach == nil && result.Schedule == nil && result.Workflow == nil {
 		p.Fail("Please choose subcommand")
 	}
+	if s := result.Schedule; s != nil {
+		if s.Add == nil && s.List == nil && s.Status == nil && s.Rm == nil && s.Pause == nil && s.Resume == nil {
+			p.Fail("Please choose schedule subcommand")
+		}
+		if s.Add != nil && (s.Add.Cron == "") == s.Add.At.IsZero() {
+			p.Fail("Please provide either a cron expression or a run time")
+		}
+		if s.Add != nil && s.Add.Tty {
+			p.Fail("Scheduled jobs cannot be attached to")
+		}
+	}
+	if w := result.Workflow; w != nil && w.Run == nil && w.List == nil && w.Status == nil {
+		p.Fail("Please choose workflow subcommand")
+	}
 	if (result.Secret == "") != (result.CaPath == "") {
 		p.Fail("Both a secret and CA certificate path need to be configured")
 	}
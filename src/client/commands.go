@@ -5,7 +5,10 @@ import (
 	"context"
 	"fmt"
 	"io"
+	"maps"
 	"os"
+	"slices"
+	"strconv"
 	"strings"
 	"time"
 
@@ -13,13 +16,32 @@ import (
 	"github.com/szymonwieloch/go-teleport/client/proto/teleportproto"
 	"golang.org/x/oauth2"
 	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
 	"google.golang.org/grpc/credentials"
 	"google.golang.org/grpc/credentials/insecure"
 	"google.golang.org/grpc/credentials/oauth"
+	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/types/known/durationpb"
+	"google.golang.org/protobuf/types/known/timestamppb"
 )
 
 const separator = "------------------------------------------------------------"
 
+// How long to wait for a job to stop if the grace period is decided by the server
+const defaultStopTimeout = time.Minute
+
+// Extra time for the server to kill the job after the grace period
+const killTimeout = 10 * time.Second
+
+// Maximum size of a single message with the standard input
+const stdinChunkSize = 32 * 1024
+
+// Delay before the first attempt to resume a broken stream of logs, doubled after every failed attempt
+const reconnectBackoff = 250 * time.Millisecond
+
+// Maximal delay between attempts to resume a broken stream of logs
+const maxReconnectBackoff = 30 * time.Second
+
 // Executes command using parsed arguments
 func execute(args args) {
 	client, close := createClient(args)
@@ -28,12 +50,24 @@ func execute(args args) {
 		handleStart(args, client)
 	} else if args.Stop != nil {
 		handleStop(args, client)
+	} else if args.Rm != nil {
+		handleRemove(args, client)
+	} else if args.Signal != nil {
+		handleSignal(args, client)
 	} else if args.List != nil {
 		handleList(args, client)
 	} else if args.Log != nil {
 		handleLog(args, client)
 	} else if args.Status != nil {
 		handleStatus(args, client)
+	} else if args.Stdin != nil {
+		handleStdin(args, client, os.Stdin)
+	} else if args.Attach != nil {
+		handleAttach(args, client)
+	} else if args.Schedule != nil {
+		handleSchedule(args, client)
+	} else if args.Workflow != nil {
+		handleWorkflow(args, client)
 	}
 }
 
@@ -71,22 +105,117 @@ func handleStart(args args, client teleportproto.RemoteExecutorClient) error {
 
 	ctx, cancel := defaultContext()
 	defer cancel()
-	req := teleportproto.Command{Command: args.Start.Command}
-	st, err := client.Start(ctx, &req)
+	req := jobCommand(args.Start)
+	if args.Start.Tty {
+		req.WindowSize = localWindowSize()
+	}
+	st, err := client.Start(ctx, req)
 	if err != nil {
 		return fmt.Errorf("could not start a new command: %w", err)
 	}
-	fmt.Println("Started job", st.Id.Uuid)
+	if st.GetQueued() != nil {
+		fmt.Println("Queued job", st.Id.Uuid, "at position", st.GetQueued().Position)
+	} else {
+		fmt.Println("Started job", st.Id.Uuid)
+	}
+	if args.Start.Tty {
+		return attachTerminal(client, st.Id.Uuid)
+	}
 	return nil
 }
 
+// Maps options of the "start" command to the started command
+func jobCommand(start *startCmd) *teleportproto.Command {
+	command, pipeline := start.Command, []*teleportproto.Stage(nil)
+	if start.Pipeline {
+		command, pipeline = splitPipeline(start.Command)
+	}
+	req := teleportproto.Command{
+		Command:    command,
+		Pipeline:   pipeline,
+		Env:        start.Env,
+		WorkingDir: start.Dir,
+		Stdin:      start.Stdin,
+		Tty:        start.Tty,
+		Raw:        start.Raw,
+	}
+	if start.CleanEnv {
+		req.EnvPolicy = teleportproto.EnvPolicy_EP_CLEAN
+	}
+	req.LimitClass = start.Class
+	if start.Memory != 0 || start.CPUs != 0 || start.Pids != 0 {
+		req.Limits = &teleportproto.Limits{
+			Memory: int64(start.Memory),
+			Cpus:   start.CPUs,
+			Pids:   start.Pids,
+		}
+	}
+	if start.Runtime != 0 {
+		req.MaxRuntime = durationpb.New(start.Runtime)
+	}
+	if start.Idle != 0 {
+		req.IdleTimeout = durationpb.New(start.Idle)
+	}
+	if start.Restart != 0 {
+		req.Restart = &teleportproto.Restart{
+			Policy:     teleportproto.RestartPolicy(start.Restart),
+			MaxRetries: start.MaxRetries,
+		}
+		if start.Backoff != 0 {
+			req.Restart.Backoff = durationpb.New(start.Backoff)
+		}
+		if start.MaxBackoff != 0 {
+			req.Restart.MaxBackoff = durationpb.New(start.MaxBackoff)
+		}
+	}
+	req.Priority = start.Priority
+	if start.Isolate || start.Network != 0 {
+		req.Isolation = &teleportproto.Isolation{
+			Namespaces: start.Isolate,
+			Network:    teleportproto.Network(start.Network),
+		}
+	}
+	return &req
+}
+
+// Splits arguments of a command into stages of a pipeline on "|" arguments
+func splitPipeline(args []string) ([]string, []*teleportproto.Stage) {
+	var first []string
+	var stages []*teleportproto.Stage
+	current := &first
+	for _, arg := range args {
+		if arg == "|" {
+			stages = append(stages, &teleportproto.Stage{})
+			current = &stages[len(stages)-1].Command
+			continue
+		}
+		*current = append(*current, arg)
+	}
+	return first, stages
+}
+
+// Handles the "attach" command - connects the local terminal to the terminal of the remote job
+func handleAttach(args args, client teleportproto.RemoteExecutorClient) error {
+	fmt.Println("Attaching to job", args.Attach.JobID)
+	return attachTerminal(client, string(args.Attach.JobID))
+}
+
 // Handles the "stop" command - kills the remote process and obtains its status
 func handleStop(args args, client teleportproto.RemoteExecutorClient) error {
 	fmt.Println("Stopping job", args.Stop.JobID)
-	taskID := teleportproto.JobId{Uuid: string(args.Stop.JobID)}
-	ctx, cancel := defaultContext()
+	req := teleportproto.StopRequest{
+		Id:     &teleportproto.JobId{Uuid: string(args.Stop.JobID)},
+		Signal: args.Stop.Signal,
+	}
+	timeout := defaultStopTimeout
+	if args.Stop.Grace > 0 {
+		req.GracePeriod = durationpb.New(args.Stop.Grace)
+		timeout = args.Stop.Grace + killTimeout
+	}
+	// the server waits until the job finishes
+	ctx, cancel := context.WithTimeout(context.Background(), timeout)
 	defer cancel()
-	st, err := client.Stop(ctx, &taskID)
+	st, err := client.Stop(ctx, &req)
 	if err != nil {
 		return fmt.Errorf("could not stop the job: %w", err)
 	}
@@ -95,6 +224,38 @@ func handleStop(args args, client teleportproto.RemoteExecutorClient) error {
 	return nil
 }
 
+// Handles the "rm" command - removes a finished job and its logs from the server
+func handleRemove(args args, client teleportproto.RemoteExecutorClient) error {
+	fmt.Println("Removing job", args.Rm.JobID)
+	ctx, cancel := defaultContext()
+	defer cancel()
+	st, err := client.Remove(ctx, &teleportproto.JobId{Uuid: string(args.Rm.JobID)})
+	if err != nil {
+		return fmt.Errorf("could not remove the job: %w", err)
+	}
+	fmt.Println("Removed job")
+	printStatus(st, os.Stdout)
+	return nil
+}
+
+// Handles the "signal" command - sends a signal to the remote process
+func handleSignal(args args, client teleportproto.RemoteExecutorClient) error {
+	fmt.Println("Sending signal", args.Signal.Signal, "to job", args.Signal.JobID)
+	req := teleportproto.SignalRequest{
+		Id:     &teleportproto.JobId{Uuid: string(args.Signal.JobID)},
+		Signal: args.Signal.Signal,
+		Group:  args.Signal.Group,
+	}
+	ctx, cancel := defaultContext()
+	defer cancel()
+	st, err := client.Signal(ctx, &req)
+	if err != nil {
+		return fmt.Errorf("could not send the signal: %w", err)
+	}
+	printStatus(st, os.Stdout)
+	return nil
+}
+
 // Handles the "list" command - list statuses of running jobs
 func handleList(args args, client teleportproto.RemoteExecutorClient) error {
 	fmt.Println("Listing jobs")
@@ -125,33 +286,267 @@ func handleStatus(args args, client teleportproto.RemoteExecutorClient) error {
 	return nil
 }
 
-// Handles the "log" command - streams logs of the remote job
+// Handles the "log" command - streams logs of the remote job.
+// A broken stream is resumed after the last received line once the server is reachable again.
 func handleLog(args args, client teleportproto.RemoteExecutorClient) error {
-	fmt.Println("Showing logs for job", args.Log.JobID)
-	ctx := context.Background()
-	jobID := teleportproto.JobId{Uuid: string(args.Log.JobID)}
-	stream, err := client.Logs(ctx, &jobID)
+	// stdout carries only the output of the job, raw chunks can be redirected to a file
+	fmt.Fprintln(os.Stderr, "Showing logs for job", args.Log.JobID)
+	req := logsRequest(args.Log)
+	backoff := reconnectBackoff
+	for {
+		received, err := streamLogs(client, req)
+		if err == nil {
+			fmt.Fprintln(os.Stderr, "== End of logs ==")
+			return nil
+		}
+		if status.Code(err) != codes.Unavailable {
+			return err
+		}
+		if received > 0 {
+			backoff = reconnectBackoff
+		}
+		fmt.Fprintf(os.Stderr, "== Connection lost, reconnecting in %s: %v ==\n", backoff, err)
+		time.Sleep(backoff)
+		backoff = min(2*backoff, maxReconnectBackoff)
+	}
+}
+
+// Streams logs selected by the request until the end of logs.
+// The request is updated to start after the last received line, so that the stream can be resumed without duplicates.
+// Returns the number of received messages.
+func streamLogs(client teleportproto.RemoteExecutorClient, req *teleportproto.LogsRequest) (int, error) {
+	stream, err := client.Logs(context.Background(), req)
 	if err != nil {
-		return fmt.Errorf("could not get logs for the job: %w", err)
+		return 0, fmt.Errorf("could not get logs for the job: %w", err)
 	}
+	received := 0
 	for {
 		resp, err := stream.Recv()
 		if err == io.EOF {
-			fmt.Println("== End of logs ==")
-			return nil
+			return received, nil
 		} else if err != nil {
-			return fmt.Errorf("could not receive logs: %w", err)
+			return received, fmt.Errorf("could not receive logs: %w", err)
 		}
-		if resp.Text != "" {
-			stderr := false
-			if resp.Src == teleportproto.LogSource_LS_STDERR {
-				stderr = true
+		received++
+		req.Start = resp.Sequence + 1
+		// the beginning of the tail is behind, a new tail would skip lines produced in the meantime
+		req.Tail = 0
+		stderr := resp.Src == teleportproto.LogSource_LS_STDERR
+		if resp.Dropped > 0 {
+			fmt.Fprintf(os.Stderr, "== %d lines dropped ==\n", resp.Dropped)
+		} else if resp.Data != nil {
+			// output of a raw job is written exactly as produced
+			output := os.Stdout
+			if stderr {
+				output = os.Stderr
 			}
+			_, err = output.Write(resp.Data)
+			if err != nil {
+				return received, fmt.Errorf("could not write logs: %w", err)
+			}
+		} else if resp.Text != "" {
 			printLog(resp.Text, resp.Timestamp.AsTime(), stderr)
 		}
 	}
 }
 
+// Creates the request of logs selected by the "log" command
+func logsRequest(cmd *logCmd) *teleportproto.LogsRequest {
+	req := &teleportproto.LogsRequest{
+		Id:       &teleportproto.JobId{Uuid: string(cmd.JobID)},
+		Start:    cmd.Start,
+		Tail:     cmd.Tail,
+		NoFollow: cmd.NoFollow,
+	}
+	if !time.Time(cmd.Since).IsZero() {
+		req.Since = timestamppb.New(time.Time(cmd.Since))
+	}
+	if !time.Time(cmd.Until).IsZero() {
+		req.Until = timestamppb.New(time.Time(cmd.Until))
+	}
+	if cmd.Stdout && !cmd.Stderr {
+		req.Filter = teleportproto.LogFilter_LF_STDOUT
+	} else if cmd.Stderr && !cmd.Stdout {
+		req.Filter = teleportproto.LogFilter_LF_STDERR
+	}
+	return req
+}
+
+// Handles the "stdin" command - pipes the given input to the remote job
+func handleStdin(args args, client teleportproto.RemoteExecutorClient, input io.Reader) error {
+	fmt.Fprintln(os.Stderr, "Writing standard input of job", args.Stdin.JobID)
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	stream, err := client.WriteStdin(ctx)
+	if err != nil {
+		return fmt.Errorf("could not write standard input of the job: %w", err)
+	}
+	// the first chunk identifies the job
+	chunk := &teleportproto.StdinChunk{Id: &teleportproto.JobId{Uuid: string(args.Stdin.JobID)}}
+	buf := make([]byte, stdinChunkSize)
+	for {
+		n, err := input.Read(buf)
+		if n > 0 {
+			chunk.Data = buf[:n]
+			if sendErr := stream.Send(chunk); sendErr != nil {
+				// the actual reason is returned by CloseAndRecv
+				break
+			}
+			chunk = &teleportproto.StdinChunk{}
+		}
+		if err == io.EOF {
+			chunk.Eof = !args.Stdin.KeepOpen
+			stream.Send(chunk)
+			break
+		} else if err != nil {
+			return fmt.Errorf("could not read the standard input: %w", err)
+		}
+	}
+	_, err = stream.CloseAndRecv()
+	if err != nil {
+		return fmt.Errorf("could not write standard input of the job: %w", err)
+	}
+	return nil
+}
+
+// Handles the "schedule" commands - manages jobs started at given times
+func handleSchedule(args args, client teleportproto.RemoteExecutorClient) error {
+	ctx, cancel := defaultContext()
+	defer cancel()
+	var status *teleportproto.ScheduleStatus
+	var err error
+	cmd := args.Schedule
+	switch {
+	case cmd.Add != nil:
+		fmt.Println("Scheduling command:", strings.Join(cmd.Add.Command, " "))
+		req := teleportproto.ScheduleRequest{
+			Command: jobCommand(&cmd.Add.startCmd),
+			Missed:  teleportproto.MissedRunPolicy(cmd.Add.Missed),
+		}
+		if cmd.Add.Cron != "" {
+			req.When = &teleportproto.ScheduleRequest_Cron{Cron: cmd.Add.Cron}
+		} else {
+			req.When = &teleportproto.ScheduleRequest_RunAt{RunAt: timestamppb.New(cmd.Add.At)}
+		}
+		status, err = client.Schedule(ctx, &req)
+		if err != nil {
+			return fmt.Errorf("could not schedule the command: %w", err)
+		}
+		fmt.Println("Created schedule", status.Id.Uuid)
+	case cmd.List != nil:
+		fmt.Println("Listing schedules")
+		list, err := client.ListSchedules(ctx, &empty.Empty{})
+		if err != nil {
+			return fmt.Errorf("could not list schedules: %w", err)
+		}
+		for _, status := range list.Schedules {
+			fmt.Println(separator)
+			printSchedule(status, os.Stdout)
+		}
+		return nil
+	case cmd.Status != nil:
+		fmt.Println("Showing status for schedule", cmd.Status.ScheduleID)
+		status, err = client.GetSchedule(ctx, &teleportproto.ScheduleId{Uuid: string(cmd.Status.ScheduleID)})
+		if err != nil {
+			return fmt.Errorf("could not get status for the schedule: %w", err)
+		}
+	case cmd.Rm != nil:
+		fmt.Println("Deleting schedule", cmd.Rm.ScheduleID)
+		status, err = client.DeleteSchedule(ctx, &teleportproto.ScheduleId{Uuid: string(cmd.Rm.ScheduleID)})
+		if err != nil {
+			return fmt.Errorf("could not delete the schedule: %w", err)
+		}
+	case cmd.Pause != nil:
+		fmt.Println("Pausing schedule", cmd.Pause.ScheduleID)
+		status, err = client.PauseSchedule(ctx, &teleportproto.ScheduleId{Uuid: string(cmd.Pause.ScheduleID)})
+		if err != nil {
+			return fmt.Errorf("could not pause the schedule: %w", err)
+		}
+	case cmd.Resume != nil:
+		fmt.Println("Resuming schedule", cmd.Resume.ScheduleID)
+		status, err = client.ResumeSchedule(ctx, &teleportproto.ScheduleId{Uuid: string(cmd.Resume.ScheduleID)})
+		if err != nil {
+			return fmt.Errorf("could not resume the schedule: %w", err)
+		}
+	}
+	printSchedule(status, os.Stdout)
+	return nil
+}
+
+// Handles the "workflow" command and its subcommands
+func handleWorkflow(args args, client teleportproto.RemoteExecutorClient) error {
+	cmd := args.Workflow
+	switch {
+	case cmd.Run != nil:
+		fmt.Println("Running workflow from", cmd.Run.File)
+		file, err := os.Open(cmd.Run.File)
+		if err != nil {
+			return fmt.Errorf("could not open the workflow file: %w", err)
+		}
+		defer file.Close()
+		req, err := parseWorkflow(file)
+		if err != nil {
+			return err
+		}
+		ctx, cancel := defaultContext()
+		defer cancel()
+		status, err := client.StartWorkflow(ctx, req)
+		if err != nil {
+			return fmt.Errorf("could not start the workflow: %w", err)
+		}
+		fmt.Println("Started workflow", status.Id.Uuid)
+		if cmd.Run.Detach {
+			return nil
+		}
+		return followWorkflow(client, status, os.Stdout)
+	case cmd.List != nil:
+		fmt.Println("Listing workflows")
+		ctx, cancel := defaultContext()
+		defer cancel()
+		list, err := client.ListWorkflows(ctx, &empty.Empty{})
+		if err != nil {
+			return fmt.Errorf("could not list workflows: %w", err)
+		}
+		for _, status := range list.Workflows {
+			fmt.Println(separator)
+			printWorkflow(status, os.Stdout)
+		}
+	case cmd.Status != nil:
+		fmt.Println("Showing status for workflow", cmd.Status.WorkflowID)
+		ctx, cancel := defaultContext()
+		defer cancel()
+		status, err := client.GetWorkflow(ctx, &teleportproto.WorkflowId{Uuid: string(cmd.Status.WorkflowID)})
+		if err != nil {
+			return fmt.Errorf("could not get status for the workflow: %w", err)
+		}
+		printWorkflow(status, os.Stdout)
+	}
+	return nil
+}
+
+// Prints changes of states of steps until all steps of the workflow finish.
+// Returns an error if any of the steps did not succeed.
+func followWorkflow(client teleportproto.RemoteExecutorClient, status *teleportproto.WorkflowStatus, w io.Writer) error {
+	printStepChanges(nil, status, w)
+	for status.Finished == nil {
+		time.Sleep(workflowPollInterval)
+		ctx, cancel := defaultContext()
+		current, err := client.GetWorkflow(ctx, status.Id)
+		cancel()
+		if err != nil {
+			return fmt.Errorf("could not get status for the workflow: %w", err)
+		}
+		printStepChanges(status, current, w)
+		status = current
+	}
+	if !workflowSucceeded(status) {
+		fmt.Fprintln(w, "Workflow", status.Id.Uuid, "failed")
+		return fmt.Errorf("workflow %s failed", status.Id.Uuid)
+	}
+	fmt.Fprintln(w, "Workflow", status.Id.Uuid, "succeeded")
+	return nil
+}
+
 // Most request should complete in 1 second
 func defaultContext() (context.Context, func()) {
 	ctx, cancel := context.WithTimeout(context.Background(), time.Second)
@@ -161,17 +556,208 @@ func defaultContext() (context.Context, func()) {
 // Prints status of the remove job.
 func printStatus(status *teleportproto.JobStatus, w io.Writer) {
 	fmt.Fprintf(w, "Job ID : %s\n", status.Id.Uuid)
-	fmt.Fprintf(w, "Command: %s\n", strings.Join(status.Command.Command, " "))
-	fmt.Fprintf(w, "Started: %s\n", status.Started.AsTime())
-	fmt.Fprintf(w, "Logs   : %d\n", status.Logs)
+	fmt.Fprintf(w, "Command: %s\n", formatCommand(status.Command))
+	if status.Command.WorkingDir != "" {
+		fmt.Fprintf(w, "Dir    : %s\n", status.Command.WorkingDir)
+	}
+	for _, name := range slices.Sorted(maps.Keys(status.Command.Env)) {
+		fmt.Fprintf(w, "Env    : %s=%s\n", name, status.Command.Env[name])
+	}
+	if status.Limits != nil {
+		fmt.Fprintf(w, "Limits : %s\n", formatLimits(status.Limits))
+	}
+	if status.MaxRuntime != nil || status.IdleTimeout != nil {
+		fmt.Fprintf(w, "Timeout: %s\n", formatTimeouts(status))
+	}
+	if status.User != nil {
+		fmt.Fprintf(w, "User   : %s\n", formatUser(status.User))
+	}
+	if len(status.Namespaces) != 0 {
+		fmt.Fprintf(w, "NS     : %s\n", strings.Join(status.Namespaces, " "))
+	}
+	if status.ScheduleId != nil {
+		fmt.Fprintf(w, "Sched. : %s\n", status.ScheduleId.Uuid)
+	}
+	if status.WorkflowId != nil {
+		fmt.Fprintf(w, "Wflow. : %s\n", status.WorkflowId.Uuid)
+	}
+	if status.Started != nil {
+		fmt.Fprintf(w, "Started: %s\n", status.Started.AsTime())
+	}
+	if status.RetainedLogs != status.Logs {
+		fmt.Fprintf(w, "Logs   : %d (%d retained)\n", status.Logs, status.RetainedLogs)
+	} else {
+		fmt.Fprintf(w, "Logs   : %d\n", status.Logs)
+	}
+	if len(status.Attempts) > 1 || status.Command.Restart != nil {
+		for i, a := range status.Attempts {
+			fmt.Fprintf(w, "Attempt: #%d %s\n", i+1, formatAttempt(a))
+		}
+	}
 	if status.Details != nil {
 		switch details := status.Details.(type) {
 		case *teleportproto.JobStatus_Stopped:
 			fmt.Fprintf(w, "Stopped: %s\n", details.Stopped.Stopped.AsTime())
 			fmt.Fprintf(w, "E. code: %d\n", details.Stopped.ErrorCode)
+			if len(details.Stopped.StageErrorCodes) > 0 {
+				fmt.Fprintf(w, "Stages : %s\n", formatStageCodes(details.Stopped.StageErrorCodes))
+			}
+			switch details.Stopped.Termination {
+			case teleportproto.Termination_T_SIGNAL:
+				fmt.Fprintf(w, "Reason : stopped by a signal\n")
+			case teleportproto.Termination_T_KILL:
+				fmt.Fprintf(w, "Reason : killed\n")
+			case teleportproto.Termination_T_CANCEL:
+				fmt.Fprintf(w, "Reason : canceled while queued\n")
+			case teleportproto.Termination_T_LOST:
+				fmt.Fprintf(w, "Reason : lost, the server stopped while the job was running\n")
+			}
+			if details.Stopped.Error != "" {
+				fmt.Fprintf(w, "Error  : %s\n", details.Stopped.Error)
+			}
+			if details.Stopped.Signal != "" {
+				fmt.Fprintf(w, "Signal : %s\n", formatSignal(details.Stopped))
+			}
+			if details.Stopped.OomKilled {
+				fmt.Fprintf(w, "OOM    : out of memory killer killed a process\n")
+			}
+			if details.Stopped.WaitError != "" {
+				fmt.Fprintf(w, "Wait   : %s\n", details.Stopped.WaitError)
+			}
+			switch details.Stopped.Reason {
+			case teleportproto.StopReason_SR_USER:
+				fmt.Fprintf(w, "Cause  : stopped by a client\n")
+			case teleportproto.StopReason_SR_SHUTDOWN:
+				fmt.Fprintf(w, "Cause  : server shutdown\n")
+			}
+			switch details.Stopped.Timeout {
+			case teleportproto.Timeout_TO_RUNTIME:
+				fmt.Fprintf(w, "Cause  : maximal runtime exceeded\n")
+			case teleportproto.Timeout_TO_IDLE:
+				fmt.Fprintf(w, "Cause  : no output within the idle timeout\n")
+			}
+		case *teleportproto.JobStatus_Queued:
+			fmt.Fprintf(w, "Queued : position %d\n", details.Queued.Position)
 		case *teleportproto.JobStatus_Pending:
 			fmt.Fprintf(w, "CPU %%  : %.2f\n", details.Pending.CpuPerc)
 			fmt.Fprintf(w, "Memory : %.0f\n", details.Pending.Memory)
 		}
 	}
 }
+
+// Prints status of the schedule together with its recent runs
+func printSchedule(status *teleportproto.ScheduleStatus, w io.Writer) {
+	fmt.Fprintf(w, "Sched. : %s\n", status.Id.Uuid)
+	fmt.Fprintf(w, "Command: %s\n", strings.Join(status.Request.Command.Command, " "))
+	switch when := status.Request.When.(type) {
+	case *teleportproto.ScheduleRequest_Cron:
+		fmt.Fprintf(w, "Cron   : %s\n", when.Cron)
+	case *teleportproto.ScheduleRequest_RunAt:
+		fmt.Fprintf(w, "Run at : %s\n", when.RunAt.AsTime())
+	}
+	if status.Request.Missed == teleportproto.MissedRunPolicy_MR_RUN_ONCE {
+		fmt.Fprintf(w, "Missed : run once\n")
+	} else {
+		fmt.Fprintf(w, "Missed : skip\n")
+	}
+	fmt.Fprintf(w, "Created: %s\n", status.Created.AsTime())
+	if status.Paused {
+		fmt.Fprintf(w, "Paused : yes\n")
+	}
+	if status.NextRun != nil {
+		fmt.Fprintf(w, "Next   : %s\n", status.NextRun.AsTime())
+	} else {
+		fmt.Fprintf(w, "Next   : none\n")
+	}
+	for _, run := range status.Runs {
+		if run.JobId != nil {
+			fmt.Fprintf(w, "Run    : %s job %s\n", run.Planned.AsTime(), run.JobId.Uuid)
+		} else {
+			fmt.Fprintf(w, "Run    : %s failed: %s\n", run.Planned.AsTime(), run.Error)
+		}
+	}
+}
+
+// Prints status of the workflow together with states of its steps
+func printWorkflow(status *teleportproto.WorkflowStatus, w io.Writer) {
+	fmt.Fprintf(w, "Wflow. : %s\n", status.Id.Uuid)
+	fmt.Fprintf(w, "Created: %s\n", status.Created.AsTime())
+	if status.Finished != nil {
+		fmt.Fprintf(w, "Finish.: %s\n", status.Finished.AsTime())
+	}
+	for _, step := range status.Steps {
+		fmt.Fprintf(w, "Step   : %s %s\n", step.Step.Name, formatStep(step))
+	}
+}
+
+// Formats the command together with stages of its pipeline
+func formatCommand(cmd *teleportproto.Command) string {
+	result := strings.Join(cmd.Command, " ")
+	for _, stage := range cmd.Pipeline {
+		result += " | " + strings.Join(stage.Command, " ")
+	}
+	return result
+}
+
+// Formats the signal that terminated the job
+func formatSignal(stopped *teleportproto.StoppedJobStatus) string {
+	if stopped.CoreDumped {
+		return stopped.Signal + " (core dumped)"
+	}
+	return stopped.Signal
+}
+
+// Formats exit codes of stages of a pipeline
+func formatStageCodes(codes []int32) string {
+	result := make([]string, 0, len(codes))
+	for _, code := range codes {
+		result = append(result, strconv.Itoa(int(code)))
+	}
+	return strings.Join(result, " | ")
+}
+
+// Formats resource limits of a job, zero limits are shown as unlimited
+func formatLimits(limits *teleportproto.Limits) string {
+	memory, cpus, pids := "unlimited", "unlimited", "unlimited"
+	if limits.Memory != 0 {
+		memory = strconv.FormatInt(limits.Memory, 10)
+	}
+	if limits.Cpus != 0 {
+		cpus = strconv.FormatFloat(limits.Cpus, 'f', -1, 64)
+	}
+	if limits.Pids != 0 {
+		pids = strconv.FormatInt(limits.Pids, 10)
+	}
+	return fmt.Sprintf("memory=%s cpus=%s pids=%s", memory, cpus, pids)
+}
+
+// Formats the Unix user of a job together with the principal it was mapped from
+func formatUser(user *teleportproto.User) string {
+	groups := make([]string, len(user.Groups))
+	for i, gid := range user.Groups {
+		groups[i] = strconv.FormatUint(uint64(gid), 10)
+	}
+	numbers := fmt.Sprintf("uid=%d gid=%d groups=%s", user.Uid, user.Gid, strings.Join(groups, ","))
+	if user.Name != "" {
+		numbers = user.Name + " " + numbers
+	}
+	return fmt.Sprintf("%s (principal %s)", numbers, user.Principal)
+}
+
+// Formats timeouts of a job, missing timeouts are shown as none
+func formatTimeouts(status *teleportproto.JobStatus) string {
+	runtime, idle := "none", "none"
+	if status.MaxRuntime != nil {
+		runtime = status.MaxRuntime.AsDuration().String()
+	}
+	if status.IdleTimeout != nil {
+		idle = status.IdleTimeout.AsDuration().String()
+	}
+	return fmt.Sprintf("runtime=%s idle=%s", runtime, idle)
+}
+
+// Formats a finished run of the command of a job
+func formatAttempt(a *teleportproto.Attempt) string {
+	runtime := a.Stopped.AsTime().Sub(a.Started.AsTime()).Round(time.Millisecond)
+	return fmt.Sprintf("exit code %d after %s, logs %d-%d", a.ErrorCode, runtime, a.FirstLog, a.FirstLog+a.Logs)
+}
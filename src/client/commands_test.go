@@ -10,6 +10,10 @@ import (
 	"github.com/szymonwieloch/go-teleport/client/mocks"
 	"github.com/szymonwieloch/go-teleport/client/proto/teleportproto"
 	"go.uber.org/mock/gomock"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/types/known/durationpb"
+	"google.golang.org/protobuf/types/known/emptypb"
 	"google.golang.org/protobuf/types/known/timestamppb"
 )
 
@@ -28,6 +32,98 @@ func TestStartCommand(t *testing.T) {
 	assert.NoError(t, err)
 }
 
+func TestStartCommandWithEnvironment(t *testing.T) {
+	ctr := gomock.NewController(t)
+	client := mocks.NewMockRemoteExecutorClient(ctr)
+	args := args{
+		Start: &startCmd{
+			Command:  []string{"go", "build"},
+			Env:      map[string]string{"GOFLAGS": "-mod=mod"},
+			Dir:      "/home/user",
+			CleanEnv: true,
+		},
+	}
+
+	cmd := teleportproto.Command{
+		Command:    []string{"go", "build"},
+		Env:        map[string]string{"GOFLAGS": "-mod=mod"},
+		WorkingDir: "/home/user",
+		EnvPolicy:  teleportproto.EnvPolicy_EP_CLEAN,
+	}
+	client.EXPECT().Start(gomock.Any(), gomock.Eq(&cmd)).Return(&exampleJobStatus, nil)
+	err := handleStart(args, client)
+	assert.NoError(t, err)
+}
+
+func TestStartCommandWithLimits(t *testing.T) {
+	ctr := gomock.NewController(t)
+	client := mocks.NewMockRemoteExecutorClient(ctr)
+	args := args{
+		Start: &startCmd{
+			Command: []string{"make"},
+			Class:   "large",
+			Memory:  512 << 20,
+			CPUs:    1.5,
+		},
+	}
+
+	cmd := teleportproto.Command{
+		Command:    []string{"make"},
+		LimitClass: "large",
+		Limits:     &teleportproto.Limits{Memory: 512 << 20, Cpus: 1.5},
+	}
+	client.EXPECT().Start(gomock.Any(), gomock.Eq(&cmd)).Return(&exampleJobStatus, nil)
+	err := handleStart(args, client)
+	assert.NoError(t, err)
+}
+
+func TestStartIsolatedCommand(t *testing.T) {
+	ctr := gomock.NewController(t)
+	client := mocks.NewMockRemoteExecutorClient(ctr)
+	args := args{
+		Start: &startCmd{
+			Command: []string{"make"},
+			Isolate: true,
+			Network: network(teleportproto.Network_N_NONE),
+		},
+	}
+
+	cmd := teleportproto.Command{
+		Command:   []string{"make"},
+		Isolation: &teleportproto.Isolation{Namespaces: true, Network: teleportproto.Network_N_NONE},
+	}
+	client.EXPECT().Start(gomock.Any(), gomock.Eq(&cmd)).Return(&exampleJobStatus, nil)
+	err := handleStart(args, client)
+	assert.NoError(t, err)
+}
+
+func TestNetwork(t *testing.T) {
+	var n network
+	assert.NoError(t, n.UnmarshalText([]byte("none")))
+	assert.Equal(t, network(teleportproto.Network_N_NONE), n)
+	assert.NoError(t, n.UnmarshalText([]byte("host")))
+	assert.Equal(t, network(teleportproto.Network_N_HOST), n)
+	assert.Error(t, n.UnmarshalText([]byte("bridge")))
+}
+
+func TestByteSize(t *testing.T) {
+	var b byteSize
+	assert.NoError(t, b.UnmarshalText([]byte("512M")))
+	assert.Equal(t, byteSize(512<<20), b)
+	assert.NoError(t, b.UnmarshalText([]byte("1000")))
+	assert.Equal(t, byteSize(1000), b)
+	assert.Error(t, b.UnmarshalText([]byte("1T")))
+	assert.Error(t, b.UnmarshalText([]byte("9999999999G")))
+	assert.Error(t, b.UnmarshalText([]byte("-1M")))
+	assert.NoError(t, b.UnmarshalText([]byte("8589934591G")))
+	assert.Equal(t, byteSize(8589934591<<30), b)
+}
+
+func TestFormatLimits(t *testing.T) {
+	limits := teleportproto.Limits{Memory: 1 << 20, Cpus: 0.5}
+	assert.Equal(t, "memory=1048576 cpus=0.5 pids=unlimited", formatLimits(&limits))
+}
+
 func TestListCommand(t *testing.T) {
 	ctr := gomock.NewController(t)
 	client := mocks.NewMockRemoteExecutorClient(ctr)
@@ -48,12 +144,66 @@ func TestStopCommand(t *testing.T) {
 			JobID: exampleJobID,
 		},
 	}
-	expectedArg := &teleportproto.JobId{Uuid: exampleJobID}
+	expectedArg := &teleportproto.StopRequest{Id: &teleportproto.JobId{Uuid: exampleJobID}}
 	client.EXPECT().Stop(gomock.Any(), gomock.Eq(expectedArg)).Return(&exampleJobStatus, nil)
 	err := handleStop(args, client)
 	assert.NoError(t, err)
 }
 
+func TestGracefulStopCommand(t *testing.T) {
+	ctr := gomock.NewController(t)
+	client := mocks.NewMockRemoteExecutorClient(ctr)
+	args := args{
+		Stop: &stopCmd{
+			JobID:  exampleJobID,
+			Signal: "INT",
+			Grace:  30 * time.Second,
+		},
+	}
+	expectedArg := &teleportproto.StopRequest{
+		Id:          &teleportproto.JobId{Uuid: exampleJobID},
+		Signal:      "INT",
+		GracePeriod: durationpb.New(30 * time.Second),
+	}
+	client.EXPECT().Stop(gomock.Any(), gomock.Eq(expectedArg)).Return(&exampleStoppedJobStatus, nil)
+	err := handleStop(args, client)
+	assert.NoError(t, err)
+}
+
+func TestSignalCommand(t *testing.T) {
+	ctr := gomock.NewController(t)
+	client := mocks.NewMockRemoteExecutorClient(ctr)
+	args := args{
+		Signal: &signalCmd{
+			JobID:  exampleJobID,
+			Signal: "HUP",
+			Group:  true,
+		},
+	}
+	expectedArg := &teleportproto.SignalRequest{
+		Id:     &teleportproto.JobId{Uuid: exampleJobID},
+		Signal: "HUP",
+		Group:  true,
+	}
+	client.EXPECT().Signal(gomock.Any(), gomock.Eq(expectedArg)).Return(&exampleJobStatus, nil)
+	err := handleSignal(args, client)
+	assert.NoError(t, err)
+}
+
+func TestRemoveCommand(t *testing.T) {
+	ctr := gomock.NewController(t)
+	client := mocks.NewMockRemoteExecutorClient(ctr)
+	args := args{
+		Rm: &rmCmd{
+			JobID: exampleJobID,
+		},
+	}
+	expectedArg := &teleportproto.JobId{Uuid: exampleJobID}
+	client.EXPECT().Remove(gomock.Any(), gomock.Eq(expectedArg)).Return(&exampleJobStatus, nil)
+	err := handleRemove(args, client)
+	assert.NoError(t, err)
+}
+
 func TestStatusCommand(t *testing.T) {
 	ctr := gomock.NewController(t)
 	client := mocks.NewMockRemoteExecutorClient(ctr)
@@ -76,20 +226,99 @@ func TestLogCommand(t *testing.T) {
 			JobID: exampleJobID,
 		},
 	}
-	expectedArg := &teleportproto.JobId{Uuid: exampleJobID}
+	expectedArg := &teleportproto.LogsRequest{Id: &teleportproto.JobId{Uuid: exampleJobID}}
 
 	stream := mocks.NewMockServerStreamingClient[teleportproto.Log](ctr)
 	client.EXPECT().Logs(gomock.Any(), gomock.Eq(expectedArg)).Return(stream, nil)
+	stream.EXPECT().Recv().Return(&teleportproto.Log{Text: "hello", Src: teleportproto.LogSource_LS_STDOUT, Timestamp: timestamppb.Now()}, nil)
+	stream.EXPECT().Recv().Return(&teleportproto.Log{Data: []byte("50%\r"), Src: teleportproto.LogSource_LS_STDOUT, Offset: 6}, nil)
 	stream.EXPECT().Recv().Return(nil, io.EOF)
 	err := handleLog(args, client)
 	assert.NoError(t, err)
 }
 
+func TestLogCommandResumes(t *testing.T) {
+	ctr := gomock.NewController(t)
+	client := mocks.NewMockRemoteExecutorClient(ctr)
+	args := args{Log: &logCmd{JobID: exampleJobID, Tail: 10}}
+	id := &teleportproto.JobId{Uuid: exampleJobID}
+
+	broken := mocks.NewMockServerStreamingClient[teleportproto.Log](ctr)
+	resumed := mocks.NewMockServerStreamingClient[teleportproto.Log](ctr)
+	gomock.InOrder(
+		client.EXPECT().Logs(gomock.Any(), gomock.Eq(&teleportproto.LogsRequest{Id: id, Tail: 10})).Return(broken, nil),
+		broken.EXPECT().Recv().Return(&teleportproto.Log{Text: "first", Timestamp: timestamppb.Now(), Sequence: 41}, nil),
+		broken.EXPECT().Recv().Return(nil, status.Error(codes.Unavailable, "connection reset")),
+		// the server is not reachable yet
+		client.EXPECT().Logs(gomock.Any(), gomock.Eq(&teleportproto.LogsRequest{Id: id, Start: 42})).Return(nil, status.Error(codes.Unavailable, "connection refused")),
+		client.EXPECT().Logs(gomock.Any(), gomock.Eq(&teleportproto.LogsRequest{Id: id, Start: 42})).Return(resumed, nil),
+		resumed.EXPECT().Recv().Return(&teleportproto.Log{Text: "second", Timestamp: timestamppb.Now(), Sequence: 42}, nil),
+		resumed.EXPECT().Recv().Return(nil, io.EOF),
+	)
+	err := handleLog(args, client)
+	assert.NoError(t, err)
+}
+
+func TestLogCommandFails(t *testing.T) {
+	ctr := gomock.NewController(t)
+	client := mocks.NewMockRemoteExecutorClient(ctr)
+	args := args{Log: &logCmd{JobID: exampleJobID}}
+	client.EXPECT().Logs(gomock.Any(), gomock.Any()).Return(nil, status.Error(codes.NotFound, "job not found"))
+	err := handleLog(args, client)
+	assert.Error(t, err)
+}
+
+func TestLogsRequest(t *testing.T) {
+	var since pointInTime
+	assert.NoError(t, since.UnmarshalText([]byte("10m")))
+	assert.WithinDuration(t, time.Now().Add(-10*time.Minute), time.Time(since), time.Minute)
+	var until pointInTime
+	assert.NoError(t, until.UnmarshalText([]byte("2024-01-01T12:00:00Z")))
+	assert.Error(t, until.UnmarshalText([]byte("yesterday")))
+
+	cmd := logCmd{JobID: exampleJobID, Tail: 100, Since: since, Until: until, NoFollow: true, Stderr: true}
+	expected := &teleportproto.LogsRequest{
+		Id:       &teleportproto.JobId{Uuid: exampleJobID},
+		Tail:     100,
+		Since:    timestamppb.New(time.Time(since)),
+		Until:    timestamppb.New(time.Date(2024, 1, 1, 12, 0, 0, 0, time.UTC)),
+		NoFollow: true,
+		Filter:   teleportproto.LogFilter_LF_STDERR,
+	}
+	assert.Equal(t, expected.String(), logsRequest(&cmd).String())
+
+	cmd = logCmd{JobID: exampleJobID, Stdout: true, Stderr: true}
+	assert.Equal(t, teleportproto.LogFilter_LF_ALL, logsRequest(&cmd).Filter)
+}
+
+func TestStdinCommand(t *testing.T) {
+	ctr := gomock.NewController(t)
+	client := mocks.NewMockRemoteExecutorClient(ctr)
+	args := args{
+		Stdin: &stdinCmd{
+			JobID: exampleJobID,
+		},
+	}
+	stream := mocks.NewMockClientStreamingClient[teleportproto.StdinChunk, emptypb.Empty](ctr)
+	client.EXPECT().WriteStdin(gomock.Any()).Return(stream, nil)
+	gomock.InOrder(
+		stream.EXPECT().Send(gomock.Eq(&teleportproto.StdinChunk{
+			Id:   &teleportproto.JobId{Uuid: exampleJobID},
+			Data: []byte("some input\n"),
+		})).Return(nil),
+		stream.EXPECT().Send(gomock.Eq(&teleportproto.StdinChunk{Eof: true})).Return(nil),
+		stream.EXPECT().CloseAndRecv().Return(&emptypb.Empty{}, nil),
+	)
+	err := handleStdin(args, client, strings.NewReader("some input\n"))
+	assert.NoError(t, err)
+}
+
 const exampleJobID = "6067dc56-0856-45f8-a87b-dd9745d292e7"
 
 var exampleJobStatus teleportproto.JobStatus = teleportproto.JobStatus{
-	Id:   &teleportproto.JobId{Uuid: exampleJobID},
-	Logs: 15,
+	Id:           &teleportproto.JobId{Uuid: exampleJobID},
+	Logs:         15,
+	RetainedLogs: 15,
 	Started: timestamppb.New(time.Date(
 		2009, 11, 17, 20, 34, 58, 651387237, time.UTC)),
 	Command: &teleportproto.Command{Command: []string{"echo", "blah"}},
@@ -101,6 +330,23 @@ var exampleJobStatus teleportproto.JobStatus = teleportproto.JobStatus{
 	},
 }
 
+var exampleStoppedJobStatus teleportproto.JobStatus = teleportproto.JobStatus{
+	Id:           &teleportproto.JobId{Uuid: exampleJobID},
+	Logs:         15,
+	RetainedLogs: 10,
+	Started: timestamppb.New(time.Date(
+		2009, 11, 17, 20, 34, 58, 651387237, time.UTC)),
+	Command: &teleportproto.Command{Command: []string{"echo", "blah"}},
+	Details: &teleportproto.JobStatus_Stopped{
+		Stopped: &teleportproto.StoppedJobStatus{
+			ErrorCode: -1,
+			Stopped: timestamppb.New(time.Date(
+				2009, 11, 17, 20, 35, 8, 0, time.UTC)),
+			Termination: teleportproto.Termination_T_KILL,
+		},
+	},
+}
+
 func TestPrintStatus(t *testing.T) {
 
 	buf := strings.Builder{}
@@ -108,3 +354,260 @@ func TestPrintStatus(t *testing.T) {
 	want := "Job ID : 6067dc56-0856-45f8-a87b-dd9745d292e7\nCommand: echo blah\nStarted: 2009-11-17 20:34:58.651387237 +0000 UTC\nLogs   : 15\nCPU %  : 12.00\nMemory : 12345678\n"
 	assert.Equal(t, buf.String(), want)
 }
+
+func TestPrintStoppedStatus(t *testing.T) {
+	buf := strings.Builder{}
+	printStatus(&exampleStoppedJobStatus, &buf)
+	want := "Job ID : 6067dc56-0856-45f8-a87b-dd9745d292e7\nCommand: echo blah\nStarted: 2009-11-17 20:34:58.651387237 +0000 UTC\nLogs   : 15 (10 retained)\nStopped: 2009-11-17 20:35:08 +0000 UTC\nE. code: -1\nReason : killed\n"
+	assert.Equal(t, buf.String(), want)
+}
+
+func TestPrintQueuedStatus(t *testing.T) {
+	status := teleportproto.JobStatus{
+		Id:      &teleportproto.JobId{Uuid: exampleJobID},
+		Command: &teleportproto.Command{Command: []string{"make"}},
+		Details: &teleportproto.JobStatus_Queued{Queued: &teleportproto.QueuedJobStatus{Position: 4}},
+	}
+	buf := strings.Builder{}
+	printStatus(&status, &buf)
+	want := "Job ID : 6067dc56-0856-45f8-a87b-dd9745d292e7\nCommand: make\nLogs   : 0\nQueued : position 4\n"
+	assert.Equal(t, want, buf.String())
+}
+
+func TestPrintOOMKilledStatus(t *testing.T) {
+	stopped := time.Date(2024, 1, 1, 12, 0, 0, 0, time.UTC)
+	status := teleportproto.JobStatus{
+		Id:      &teleportproto.JobId{Uuid: exampleJobID},
+		Command: &teleportproto.Command{Command: []string{"make"}},
+		Details: &teleportproto.JobStatus_Stopped{Stopped: &teleportproto.StoppedJobStatus{
+			ErrorCode: -1,
+			Stopped:   timestamppb.New(stopped),
+			Signal:    "KILL",
+			OomKilled: true,
+			WaitError: "signal: killed",
+		}},
+	}
+	buf := strings.Builder{}
+	printStatus(&status, &buf)
+	want := "Job ID : 6067dc56-0856-45f8-a87b-dd9745d292e7\nCommand: make\nLogs   : 0\n" +
+		"Stopped: 2024-01-01 12:00:00 +0000 UTC\nE. code: -1\nSignal : KILL\n" +
+		"OOM    : out of memory killer killed a process\nWait   : signal: killed\n"
+	assert.Equal(t, want, buf.String())
+	assert.Equal(t, "SEGV (core dumped)", formatSignal(&teleportproto.StoppedJobStatus{Signal: "SEGV", CoreDumped: true}))
+}
+
+func TestStartCommandWithPriority(t *testing.T) {
+	ctr := gomock.NewController(t)
+	client := mocks.NewMockRemoteExecutorClient(ctr)
+	args := args{
+		Start: &startCmd{
+			Command:  []string{"make"},
+			Priority: -3,
+		},
+	}
+
+	cmd := teleportproto.Command{Command: []string{"make"}, Priority: -3}
+	queued := teleportproto.JobStatus{
+		Id:      &teleportproto.JobId{Uuid: exampleJobID},
+		Details: &teleportproto.JobStatus_Queued{Queued: &teleportproto.QueuedJobStatus{Position: 2}},
+	}
+	client.EXPECT().Start(gomock.Any(), gomock.Eq(&cmd)).Return(&queued, nil)
+	err := handleStart(args, client)
+	assert.NoError(t, err)
+}
+
+func TestStartPipelineCommand(t *testing.T) {
+	ctr := gomock.NewController(t)
+	client := mocks.NewMockRemoteExecutorClient(ctr)
+	args := args{
+		Start: &startCmd{
+			Command:  []string{"cat", "access.log", "|", "grep", "GET", "|", "wc", "-l"},
+			Pipeline: true,
+		},
+	}
+
+	cmd := teleportproto.Command{
+		Command:  []string{"cat", "access.log"},
+		Pipeline: []*teleportproto.Stage{{Command: []string{"grep", "GET"}}, {Command: []string{"wc", "-l"}}},
+	}
+	client.EXPECT().Start(gomock.Any(), gomock.Eq(&cmd)).Return(&exampleJobStatus, nil)
+	err := handleStart(args, client)
+	assert.NoError(t, err)
+	assert.Equal(t, "cat access.log | grep GET | wc -l", formatCommand(&cmd))
+	// without the option "|" is an ordinary argument
+	assert.Equal(t, []string{"tr", "|", ","}, jobCommand(&startCmd{Command: []string{"tr", "|", ","}}).Command)
+}
+
+func TestFormatStageCodes(t *testing.T) {
+	assert.Equal(t, "0 | 1 | -1", formatStageCodes([]int32{0, 1, -1}))
+}
+
+func TestFormatUser(t *testing.T) {
+	user := teleportproto.User{Principal: "team", Name: "nobody", Uid: 65534, Gid: 65534, Groups: []uint32{100, 10}}
+	assert.Equal(t, "nobody uid=65534 gid=65534 groups=100,10 (principal team)", formatUser(&user))
+	user = teleportproto.User{Principal: "default", Uid: 1000, Gid: 100}
+	assert.Equal(t, "uid=1000 gid=100 groups= (principal default)", formatUser(&user))
+}
+
+func TestStartCommandWithTimeouts(t *testing.T) {
+	ctr := gomock.NewController(t)
+	client := mocks.NewMockRemoteExecutorClient(ctr)
+	args := args{
+		Start: &startCmd{
+			Command: []string{"make"},
+			Runtime: time.Hour,
+		},
+	}
+
+	cmd := teleportproto.Command{
+		Command:    []string{"make"},
+		MaxRuntime: durationpb.New(time.Hour),
+	}
+	client.EXPECT().Start(gomock.Any(), gomock.Eq(&cmd)).Return(&exampleJobStatus, nil)
+	err := handleStart(args, client)
+	assert.NoError(t, err)
+}
+
+func TestFormatTimeouts(t *testing.T) {
+	status := teleportproto.JobStatus{IdleTimeout: durationpb.New(10 * time.Minute)}
+	assert.Equal(t, "runtime=none idle=10m0s", formatTimeouts(&status))
+}
+
+func TestStartCommandWithRestart(t *testing.T) {
+	ctr := gomock.NewController(t)
+	client := mocks.NewMockRemoteExecutorClient(ctr)
+	args := args{
+		Start: &startCmd{
+			Command:    []string{"daemon"},
+			Restart:    restartPolicy(teleportproto.RestartPolicy_RP_ALWAYS),
+			MaxRetries: 3,
+			Backoff:    time.Second,
+		},
+	}
+
+	cmd := teleportproto.Command{
+		Command: []string{"daemon"},
+		Restart: &teleportproto.Restart{
+			Policy:     teleportproto.RestartPolicy_RP_ALWAYS,
+			MaxRetries: 3,
+			Backoff:    durationpb.New(time.Second),
+		},
+	}
+	client.EXPECT().Start(gomock.Any(), gomock.Eq(&cmd)).Return(&exampleJobStatus, nil)
+	err := handleStart(args, client)
+	assert.NoError(t, err)
+}
+
+func TestRestartPolicy(t *testing.T) {
+	var r restartPolicy
+	assert.NoError(t, r.UnmarshalText([]byte("on-failure")))
+	assert.Equal(t, restartPolicy(teleportproto.RestartPolicy_RP_ON_FAILURE), r)
+	assert.Error(t, r.UnmarshalText([]byte("sometimes")))
+}
+
+func TestFormatAttempt(t *testing.T) {
+	started := time.Date(2024, 1, 1, 12, 0, 0, 0, time.UTC)
+	a := teleportproto.Attempt{
+		Started:   timestamppb.New(started),
+		Stopped:   timestamppb.New(started.Add(1500 * time.Millisecond)),
+		ErrorCode: 3,
+		FirstLog:  10,
+		Logs:      5,
+	}
+	assert.Equal(t, "exit code 3 after 1.5s, logs 10-15", formatAttempt(&a))
+}
+
+var exampleScheduleStatus = teleportproto.ScheduleStatus{
+	Id: &teleportproto.ScheduleId{Uuid: "0b9a1c52-7f3e-4d8e-9a43-1d2f5b6c7e8f"},
+	Request: &teleportproto.ScheduleRequest{
+		Command: &teleportproto.Command{Command: []string{"cleanup"}},
+		When:    &teleportproto.ScheduleRequest_Cron{Cron: "0 3 * * *"},
+	},
+	Created: timestamppb.New(time.Date(2024, 1, 1, 12, 0, 0, 0, time.UTC)),
+	NextRun: timestamppb.New(time.Date(2024, 1, 2, 3, 0, 0, 0, time.UTC)),
+	Runs: []*teleportproto.ScheduledRun{
+		{Planned: timestamppb.New(time.Date(2024, 1, 1, 3, 0, 0, 0, time.UTC)), JobId: &teleportproto.JobId{Uuid: "6067dc56-0856-45f8-a87b-dd9745d292e7"}},
+		{Planned: timestamppb.New(time.Date(2024, 1, 1, 4, 0, 0, 0, time.UTC)), Error: "could not start the process"},
+	},
+}
+
+func TestScheduleAddCommand(t *testing.T) {
+	ctr := gomock.NewController(t)
+	client := mocks.NewMockRemoteExecutorClient(ctr)
+	args := args{
+		Schedule: &scheduleCmd{
+			Add: &scheduleAddCmd{
+				Cron:     "0 3 * * *",
+				Missed:   missedRuns(teleportproto.MissedRunPolicy_MR_RUN_ONCE),
+				startCmd: startCmd{Command: []string{"cleanup"}, Runtime: time.Hour},
+			},
+		},
+	}
+
+	req := teleportproto.ScheduleRequest{
+		Command: &teleportproto.Command{Command: []string{"cleanup"}, MaxRuntime: durationpb.New(time.Hour)},
+		When:    &teleportproto.ScheduleRequest_Cron{Cron: "0 3 * * *"},
+		Missed:  teleportproto.MissedRunPolicy_MR_RUN_ONCE,
+	}
+	client.EXPECT().Schedule(gomock.Any(), gomock.Eq(&req)).Return(&exampleScheduleStatus, nil)
+	err := handleSchedule(args, client)
+	assert.NoError(t, err)
+}
+
+func TestScheduleAddRunAtCommand(t *testing.T) {
+	ctr := gomock.NewController(t)
+	client := mocks.NewMockRemoteExecutorClient(ctr)
+	at := time.Date(2030, 1, 2, 3, 0, 0, 0, time.UTC)
+	args := args{
+		Schedule: &scheduleCmd{
+			Add: &scheduleAddCmd{At: at, startCmd: startCmd{Command: []string{"report"}}},
+		},
+	}
+
+	req := teleportproto.ScheduleRequest{
+		Command: &teleportproto.Command{Command: []string{"report"}},
+		When:    &teleportproto.ScheduleRequest_RunAt{RunAt: timestamppb.New(at)},
+	}
+	client.EXPECT().Schedule(gomock.Any(), gomock.Eq(&req)).Return(&exampleScheduleStatus, nil)
+	err := handleSchedule(args, client)
+	assert.NoError(t, err)
+}
+
+func TestSchedulePauseCommand(t *testing.T) {
+	ctr := gomock.NewController(t)
+	client := mocks.NewMockRemoteExecutorClient(ctr)
+	args := args{
+		Schedule: &scheduleCmd{Pause: &scheduleIDCmd{ScheduleID: "0b9a1c52-7f3e-4d8e-9a43-1d2f5b6c7e8f"}},
+	}
+
+	id := teleportproto.ScheduleId{Uuid: "0b9a1c52-7f3e-4d8e-9a43-1d2f5b6c7e8f"}
+	client.EXPECT().PauseSchedule(gomock.Any(), gomock.Eq(&id)).Return(&exampleScheduleStatus, nil)
+	err := handleSchedule(args, client)
+	assert.NoError(t, err)
+}
+
+func TestScheduleListCommand(t *testing.T) {
+	ctr := gomock.NewController(t)
+	client := mocks.NewMockRemoteExecutorClient(ctr)
+	args := args{Schedule: &scheduleCmd{List: &listCmd{}}}
+
+	list := teleportproto.ScheduleList{Schedules: []*teleportproto.ScheduleStatus{&exampleScheduleStatus}}
+	client.EXPECT().ListSchedules(gomock.Any(), gomock.Any()).Return(&list, nil)
+	err := handleSchedule(args, client)
+	assert.NoError(t, err)
+}
+
+func TestMissedRuns(t *testing.T) {
+	var m missedRuns
+	assert.NoError(t, m.UnmarshalText([]byte("run-once")))
+	assert.Equal(t, missedRuns(teleportproto.MissedRunPolicy_MR_RUN_ONCE), m)
+	assert.Error(t, m.UnmarshalText([]byte("all")))
+}
+
+func TestPrintSchedule(t *testing.T) {
+	buf := strings.Builder{}
+	printSchedule(&exampleScheduleStatus, &buf)
+	want := "Sched. : 0b9a1c52-7f3e-4d8e-9a43-1d2f5b6c7e8f\nCommand: cleanup\nCron   : 0 3 * * *\nMissed : skip\nCreated: 2024-01-01 12:00:00 +0000 UTC\nNext   : 2024-01-02 03:00:00 +0000 UTC\n" +
+		"Run    : 2024-01-01 03:00:00 +0000 UTC job 6067dc56-0856-45f8-a87b-dd9745d292e7\nRun    : 2024-01-01 04:00:00 +0000 UTC failed: could not start the process\n"
+	assert.Equal(t, want, buf.String())
+}
@@ -3,7 +3,7 @@ package main
 //go:generate mkdir -p proto mocks
 //go:generate protoc -I=../../proto --go-grpc_out=. --go_out=. teleport.proto
 //go:generate mockgen -destination mocks/grpc_mock.go -package mocks ./proto/teleportproto RemoteExecutorClient
-//go:generate mockgen -destination mocks/grpc_steam_mock.go -package mocks google.golang.org/grpc ServerStreamingClient
+//go:generate mockgen -destination mocks/grpc_steam_mock.go -package mocks google.golang.org/grpc ServerStreamingClient,ClientStreamingClient,BidiStreamingClient
 
 import "fmt"
 
@@ -0,0 +1,173 @@
+// Interactive sessions with remote jobs running in a terminal
+package main
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"os/signal"
+	"sync"
+	"syscall"
+
+	"github.com/szymonwieloch/go-teleport/client/proto/teleportproto"
+	"golang.org/x/term"
+)
+
+// Pressing Ctrl-] detaches from the remote terminal
+const detachKey byte = 0x1d
+
+var errDetached = errors.New("detached")
+
+type attachStream = teleportproto.RemoteExecutor_AttachClient
+
+// Attaches the local terminal to the terminal of the remote job.
+// The local terminal is switched to the raw mode for the duration of the session.
+func attachTerminal(client teleportproto.RemoteExecutorClient, jobID string) error {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	stream, err := client.Attach(ctx)
+	if err != nil {
+		return fmt.Errorf("could not attach to the job: %w", err)
+	}
+	session := newSession(stream)
+	err = session.send(&teleportproto.AttachInput{Input: &teleportproto.AttachInput_Id{Id: &teleportproto.JobId{Uuid: jobID}}})
+	if err != nil {
+		return fmt.Errorf("could not attach to the job: %w", err)
+	}
+
+	fd := int(os.Stdin.Fd())
+	if term.IsTerminal(fd) {
+		state, err := term.MakeRaw(fd)
+		if err != nil {
+			return fmt.Errorf("could not switch the terminal to the raw mode: %w", err)
+		}
+		defer term.Restore(fd, state)
+		session.resize(fd)
+		resized := make(chan os.Signal, 1)
+		signal.Notify(resized, syscall.SIGWINCH)
+		defer signal.Stop(resized)
+		go func() {
+			for range resized {
+				session.resize(fd)
+			}
+		}()
+	}
+	err = session.run(os.Stdin, os.Stdout)
+	if err == errDetached {
+		return nil
+	}
+	return err
+}
+
+// A single attach session
+type session struct {
+	// gRPC streams do not allow concurrent sending
+	sendMutex sync.Mutex
+	stream    attachStream
+}
+
+func newSession(stream attachStream) *session {
+	return &session{stream: stream}
+}
+
+// Sends a message to the server.
+// Thread safe.
+func (s *session) send(input *teleportproto.AttachInput) error {
+	s.sendMutex.Lock()
+	defer s.sendMutex.Unlock()
+	return s.stream.Send(input)
+}
+
+// Sends the current size of the local terminal
+func (s *session) resize(fd int) {
+	size := windowSize(fd)
+	if size != nil {
+		s.send(&teleportproto.AttachInput{Input: &teleportproto.AttachInput_Resize{Resize: size}})
+	}
+}
+
+// Returns size of the terminal, nil if it is not a terminal
+func windowSize(fd int) *teleportproto.WindowSize {
+	cols, rows, err := term.GetSize(fd)
+	if err != nil {
+		return nil
+	}
+	return &teleportproto.WindowSize{Rows: uint32(rows), Cols: uint32(cols)}
+}
+
+// Returns size of the local terminal, nil if the client does not run in a terminal
+func localWindowSize() *teleportproto.WindowSize {
+	return windowSize(int(os.Stdin.Fd()))
+}
+
+// Forwards input to the remote terminal and its output to the local one.
+// Returns when the remote terminal gets closed or the user detaches.
+func (s *session) run(input io.Reader, output io.Writer) error {
+	inputDone := make(chan error, 1)
+	go func() {
+		inputDone <- s.forwardInput(input)
+	}()
+	outputDone := make(chan error, 1)
+	go func() {
+		outputDone <- forwardOutput(s.stream, output)
+	}()
+	select {
+	case err := <-outputDone:
+		return err
+	case err := <-inputDone:
+		if err == nil {
+			// local input finished, keep showing the output
+			return <-outputDone
+		}
+		return err
+	}
+}
+
+// Sends local input to the remote terminal
+func (s *session) forwardInput(input io.Reader) error {
+	buf := make([]byte, 1024)
+	for {
+		n, err := input.Read(buf)
+		if n > 0 {
+			data := buf[:n]
+			detach := false
+			if i := bytes.IndexByte(data, detachKey); i >= 0 {
+				data, detach = data[:i], true
+			}
+			if len(data) > 0 {
+				msg := &teleportproto.AttachInput{Input: &teleportproto.AttachInput_Data{Data: bytes.Clone(data)}}
+				if sendErr := s.send(msg); sendErr != nil {
+					// the reason is reported by the output stream
+					return nil
+				}
+			}
+			if detach {
+				return errDetached
+			}
+		}
+		if err == io.EOF {
+			s.sendMutex.Lock()
+			defer s.sendMutex.Unlock()
+			s.stream.CloseSend()
+			return nil
+		} else if err != nil {
+			return fmt.Errorf("could not read the input: %w", err)
+		}
+	}
+}
+
+// Prints output of the remote terminal
+func forwardOutput(stream attachStream, output io.Writer) error {
+	for {
+		resp, err := stream.Recv()
+		if err == io.EOF {
+			return nil
+		} else if err != nil {
+			return fmt.Errorf("could not receive the terminal output: %w", err)
+		}
+		output.Write(resp.Data)
+	}
+}
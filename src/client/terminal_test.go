@@ -0,0 +1,52 @@
+package main
+
+import (
+	"io"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/szymonwieloch/go-teleport/client/mocks"
+	"github.com/szymonwieloch/go-teleport/client/proto/teleportproto"
+	"go.uber.org/mock/gomock"
+)
+
+func TestSession(t *testing.T) {
+	ctr := gomock.NewController(t)
+	stream := mocks.NewMockBidiStreamingClient[teleportproto.AttachInput, teleportproto.AttachOutput](ctr)
+	input := &teleportproto.AttachInput{Input: &teleportproto.AttachInput_Data{Data: []byte("ls\n")}}
+	stream.EXPECT().Send(gomock.Eq(input)).Return(nil)
+	// the remote terminal finishes once the input is closed
+	inputClosed := make(chan struct{})
+	stream.EXPECT().CloseSend().DoAndReturn(func() error {
+		close(inputClosed)
+		return nil
+	})
+	gomock.InOrder(
+		stream.EXPECT().Recv().Return(&teleportproto.AttachOutput{Data: []byte("file.txt\r\n")}, nil),
+		stream.EXPECT().Recv().DoAndReturn(func() (*teleportproto.AttachOutput, error) {
+			<-inputClosed
+			return nil, io.EOF
+		}),
+	)
+	output := strings.Builder{}
+	err := newSession(stream).run(strings.NewReader("ls\n"), &output)
+	assert.NoError(t, err)
+	assert.Equal(t, "file.txt\r\n", output.String())
+}
+
+func TestSessionDetach(t *testing.T) {
+	ctr := gomock.NewController(t)
+	stream := mocks.NewMockBidiStreamingClient[teleportproto.AttachInput, teleportproto.AttachOutput](ctr)
+	input := &teleportproto.AttachInput{Input: &teleportproto.AttachInput_Data{Data: []byte("top")}}
+	stream.EXPECT().Send(gomock.Eq(input)).Return(nil)
+	// output never ends on its own
+	block := make(chan struct{})
+	defer close(block)
+	stream.EXPECT().Recv().DoAndReturn(func() (*teleportproto.AttachOutput, error) {
+		<-block
+		return nil, io.EOF
+	}).AnyTimes()
+	err := newSession(stream).run(strings.NewReader("top\x1dignored"), io.Discard)
+	assert.Equal(t, errDetached, err)
+}
@@ -0,0 +1,130 @@
+// Workflows - steps of a workflow loaded from YAML files and following their progress
+package main
+
+import (
+	"fmt"
+	"io"
+	"time"
+
+	"github.com/szymonwieloch/go-teleport/client/proto/teleportproto"
+	"gopkg.in/yaml.v3"
+)
+
+// How often the status of a followed workflow is checked
+const workflowPollInterval = 500 * time.Millisecond
+
+// Content of a workflow file
+type workflowFile struct {
+	Steps []workflowStep `yaml:"steps"`
+}
+
+// A single step of a workflow file, the options match the ones of the "start" command
+type workflowStep struct {
+	Name        string            `yaml:"name"`
+	DependsOn   []string          `yaml:"depends_on"`
+	Command     []string          `yaml:"command"`
+	Pipeline    [][]string        `yaml:"pipeline"`
+	Env         map[string]string `yaml:"env"`
+	Dir         string            `yaml:"dir"`
+	CleanEnv    bool              `yaml:"clean_env"`
+	Class       string            `yaml:"class"`
+	MaxRuntime  time.Duration     `yaml:"max_runtime"`
+	IdleTimeout time.Duration     `yaml:"idle_timeout"`
+	Priority    int32             `yaml:"priority"`
+}
+
+// Parses a workflow file into a request.
+// Unknown fields are rejected to catch typos in step options.
+func parseWorkflow(r io.Reader) (*teleportproto.WorkflowRequest, error) {
+	var file workflowFile
+	decoder := yaml.NewDecoder(r)
+	decoder.KnownFields(true)
+	err := decoder.Decode(&file)
+	if err != nil {
+		return nil, fmt.Errorf("invalid workflow file: %w", err)
+	}
+	if len(file.Steps) == 0 {
+		return nil, fmt.Errorf("invalid workflow file: no steps")
+	}
+	req := teleportproto.WorkflowRequest{}
+	for _, step := range file.Steps {
+		if len(step.Command) == 0 {
+			return nil, fmt.Errorf("invalid workflow file: step %q has no command", step.Name)
+		}
+		start := startCmd{
+			Env:      step.Env,
+			Dir:      step.Dir,
+			CleanEnv: step.CleanEnv,
+			Class:    step.Class,
+			Runtime:  step.MaxRuntime,
+			Idle:     step.IdleTimeout,
+			Priority: step.Priority,
+			Command:  step.Command,
+		}
+		cmd := jobCommand(&start)
+		for _, stage := range step.Pipeline {
+			cmd.Pipeline = append(cmd.Pipeline, &teleportproto.Stage{Command: stage})
+		}
+		req.Steps = append(req.Steps, &teleportproto.WorkflowStep{
+			Name:      step.Name,
+			DependsOn: step.DependsOn,
+			Command:   cmd,
+		})
+	}
+	return &req, nil
+}
+
+// Prints steps whose state changed since the previous status of the workflow.
+// previous may be nil.
+func printStepChanges(previous, current *teleportproto.WorkflowStatus, w io.Writer) {
+	for i, step := range current.Steps {
+		if previous != nil && i < len(previous.Steps) && previous.Steps[i].State == step.State {
+			continue
+		}
+		if step.State == teleportproto.StepState_S_WAITING {
+			continue
+		}
+		fmt.Fprintf(w, "%s: %s\n", step.Step.Name, formatStep(step))
+	}
+}
+
+// Formats the state of a step together with its job or error
+func formatStep(step *teleportproto.StepStatus) string {
+	result := formatStepState(step.State)
+	if step.Job != nil {
+		result += " job " + step.Job.Id.Uuid
+		if stopped := step.Job.GetStopped(); stopped != nil && step.State == teleportproto.StepState_S_FAILED {
+			result += fmt.Sprintf(" exit code %d", stopped.ErrorCode)
+		}
+	}
+	if step.Error != "" {
+		result += ": " + step.Error
+	}
+	return result
+}
+
+// Formats the state of a step
+func formatStepState(state teleportproto.StepState) string {
+	switch state {
+	case teleportproto.StepState_S_RUNNING:
+		return "running"
+	case teleportproto.StepState_S_SUCCEEDED:
+		return "succeeded"
+	case teleportproto.StepState_S_FAILED:
+		return "failed"
+	case teleportproto.StepState_S_SKIPPED:
+		return "skipped"
+	default:
+		return "waiting"
+	}
+}
+
+// Checks if all steps of a finished workflow succeeded
+func workflowSucceeded(status *teleportproto.WorkflowStatus) bool {
+	for _, step := range status.Steps {
+		if step.State != teleportproto.StepState_S_SUCCEEDED {
+			return false
+		}
+	}
+	return true
+}
@@ -0,0 +1,101 @@
+package main
+
+import (
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/szymonwieloch/go-teleport/client/mocks"
+	"github.com/szymonwieloch/go-teleport/client/proto/teleportproto"
+	"go.uber.org/mock/gomock"
+	"google.golang.org/protobuf/types/known/durationpb"
+	"google.golang.org/protobuf/types/known/timestamppb"
+)
+
+const exampleWorkflowFile = `
+steps:
+  - name: build
+    command: [make, build]
+    env:
+      GOOS: linux
+    max_runtime: 10m
+  - name: test
+    depends_on: [build]
+    command: [make, test]
+    pipeline:
+      - [grep, FAIL]
+    priority: 5
+`
+
+func TestParseWorkflow(t *testing.T) {
+	req, err := parseWorkflow(strings.NewReader(exampleWorkflowFile))
+	assert.NoError(t, err)
+	expected := teleportproto.WorkflowRequest{Steps: []*teleportproto.WorkflowStep{
+		{
+			Name: "build",
+			Command: &teleportproto.Command{
+				Command:    []string{"make", "build"},
+				Env:        map[string]string{"GOOS": "linux"},
+				MaxRuntime: durationpb.New(10 * time.Minute),
+			},
+		},
+		{
+			Name:      "test",
+			DependsOn: []string{"build"},
+			Command: &teleportproto.Command{
+				Command:  []string{"make", "test"},
+				Pipeline: []*teleportproto.Stage{{Command: []string{"grep", "FAIL"}}},
+				Priority: 5,
+			},
+		},
+	}}
+	assert.Equal(t, expected.String(), req.String())
+}
+
+func TestParseInvalidWorkflow(t *testing.T) {
+	for _, file := range []string{
+		"",
+		"steps: []",
+		"steps: [{name: build}]",
+		"steps: [{name: build, command: [make], retries: 3}]",
+	} {
+		_, err := parseWorkflow(strings.NewReader(file))
+		assert.Error(t, err, file)
+	}
+}
+
+func exampleWorkflowStatus(build, test teleportproto.StepState) *teleportproto.WorkflowStatus {
+	return &teleportproto.WorkflowStatus{
+		Id:      &teleportproto.WorkflowId{Uuid: "4c0d1e2f-3a4b-4c5d-8e6f-7a8b9c0d1e2f"},
+		Created: timestamppb.New(time.Date(2024, 1, 1, 12, 0, 0, 0, time.UTC)),
+		Steps: []*teleportproto.StepStatus{
+			{Step: &teleportproto.WorkflowStep{Name: "build"}, State: build},
+			{Step: &teleportproto.WorkflowStep{Name: "test", DependsOn: []string{"build"}}, State: test},
+		},
+	}
+}
+
+func TestFollowWorkflow(t *testing.T) {
+	ctr := gomock.NewController(t)
+	client := mocks.NewMockRemoteExecutorClient(ctr)
+	started := exampleWorkflowStatus(teleportproto.StepState_S_RUNNING, teleportproto.StepState_S_WAITING)
+	finished := exampleWorkflowStatus(teleportproto.StepState_S_FAILED, teleportproto.StepState_S_SKIPPED)
+	finished.Finished = timestamppb.New(time.Date(2024, 1, 1, 12, 1, 0, 0, time.UTC))
+	client.EXPECT().GetWorkflow(gomock.Any(), gomock.Eq(started.Id)).Return(finished, nil)
+
+	output := strings.Builder{}
+	err := followWorkflow(client, started, &output)
+	assert.Error(t, err)
+	assert.Equal(t, "build: running\nbuild: failed\ntest: skipped\nWorkflow 4c0d1e2f-3a4b-4c5d-8e6f-7a8b9c0d1e2f failed\n", output.String())
+}
+
+func TestWorkflowStatusCommand(t *testing.T) {
+	ctr := gomock.NewController(t)
+	client := mocks.NewMockRemoteExecutorClient(ctr)
+	status := exampleWorkflowStatus(teleportproto.StepState_S_SUCCEEDED, teleportproto.StepState_S_RUNNING)
+	args := args{Workflow: &workflowCmd{Status: &workflowIDCmd{WorkflowID: WorkflowID(status.Id.Uuid)}}}
+	client.EXPECT().GetWorkflow(gomock.Any(), gomock.Eq(status.Id)).Return(status, nil)
+	err := handleWorkflow(args, client)
+	assert.NoError(t, err)
+}
@@ -5,18 +5,34 @@ package apitests
 
 import (
 	"fmt"
+	"io"
+	"os"
+	"strconv"
 	"sync"
 	"testing"
 	"time"
 
 	"github.com/stretchr/testify/assert"
+	"github.com/szymonwieloch/go-teleport/server/jobs"
 	"github.com/szymonwieloch/go-teleport/server/proto/teleportproto"
+	"github.com/szymonwieloch/go-teleport/server/service"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/types/known/durationpb"
+	"google.golang.org/protobuf/types/known/emptypb"
+	"google.golang.org/protobuf/types/known/timestamppb"
 )
 
 var shortCmd []string = []string{"echo", "blah"}
 var longCmd []string = []string{"sleep", "10"}
 var loggingCmd []string = []string{"bash", "-c", "for i in {0..5}; do echo Welcome $i times; sleep 0.1; done"}
 
+// The test binary is started again as the init process of isolated jobs
+func TestMain(m *testing.M) {
+	jobs.RunInit()
+	os.Exit(m.Run())
+}
+
 func TestAuth(t *testing.T) {
 	tests := []struct {
 		clientSecret string
@@ -44,6 +60,17 @@ func TestAuth(t *testing.T) {
 			_, err := client.Start(testContext(), &req)
 			gotOk := (err == nil)
 			assert.Equal(t, test.wantOk, gotOk)
+
+			// streaming calls are authenticated too
+			stream, err := client.Logs(testContext(), &teleportproto.LogsRequest{Id: &teleportproto.JobId{Uuid: "unknown"}})
+			if err == nil {
+				_, err = stream.Recv()
+			}
+			if test.wantOk {
+				assert.Equal(t, codes.NotFound, status.Code(err))
+			} else {
+				assert.NotEqual(t, codes.NotFound, status.Code(err))
+			}
 		})
 	}
 }
@@ -64,15 +91,24 @@ func TestShort(t *testing.T) {
 	checkStoppedJob(t, st2, st1.Id.Uuid, shortCmd)
 	assert.Equal(t, st2.GetStopped().ErrorCode, int32(0))
 
-	// Stop is supposed to remove the job from the internal list and free resources
+	// Stop keeps the finished job, Remove frees its resources
 
-	st3, err := client.Stop(testContext(), st1.Id)
+	st3, err := client.Stop(testContext(), &teleportproto.StopRequest{Id: st1.Id})
 	assert.NoError(t, err)
 	checkStoppedJob(t, st3, st1.Id.Uuid, shortCmd)
 	assert.Equal(t, st2.GetStopped().ErrorCode, int32(0))
 
 	_, err = client.GetStatus(testContext(), st1.Id)
-	assert.Error(t, err)
+	assert.NoError(t, err)
+
+	st4, err := client.Remove(testContext(), st1.Id)
+	assert.NoError(t, err)
+	checkStoppedJob(t, st4, st1.Id.Uuid, shortCmd)
+
+	_, err = client.GetStatus(testContext(), st1.Id)
+	assert.Equal(t, codes.NotFound, status.Code(err))
+	_, err = client.Remove(testContext(), st1.Id)
+	assert.Equal(t, codes.NotFound, status.Code(err))
 }
 
 // Runs a long application and inspects its status while it is running
@@ -89,13 +125,20 @@ func TestLong(t *testing.T) {
 	assert.NoError(t, err)
 	checkStartedJob(t, st2, longCmd)
 
-	st3, err := client.Stop(testContext(), st1.Id)
+	// a running job cannot be removed
+	_, err = client.Remove(testContext(), st1.Id)
+	assert.Equal(t, codes.FailedPrecondition, status.Code(err))
+
+	st3, err := client.Stop(testContext(), &teleportproto.StopRequest{Id: st1.Id})
 	assert.NoError(t, err)
 	checkStoppedJob(t, st3, st1.Id.Uuid, longCmd)
 	assert.Equal(t, st3.GetStopped().ErrorCode, int32(-1))
+	assert.Equal(t, st3.GetStopped().Termination, teleportproto.Termination_T_SIGNAL)
 
+	_, err = client.Remove(testContext(), st1.Id)
+	assert.NoError(t, err)
 	_, err = client.GetStatus(testContext(), st1.Id)
-	assert.Error(t, err)
+	assert.Equal(t, codes.NotFound, status.Code(err))
 }
 
 // Runs a long applicaton and inspect its logs while it is running
@@ -139,3 +182,770 @@ func TestParallel(t *testing.T) {
 
 	wg.Wait()
 }
+
+// Runs a job with custom environment and working directory
+func TestEnvironment(t *testing.T) {
+	client, close := mustCreateClientAndServer(t)
+	defer close()
+
+	cmd := []string{"bash", "-c", "echo $GREETING from $PWD"}
+	req := teleportproto.Command{
+		Command:    cmd,
+		Env:        map[string]string{"GREETING": "hello"},
+		WorkingDir: "/tmp",
+		EnvPolicy:  teleportproto.EnvPolicy_EP_CLEAN,
+	}
+	st, err := client.Start(testContext(), &req)
+	assert.NoError(t, err)
+	checkStartedJob(t, st, cmd)
+	assert.Equal(t, "/tmp", st.Command.WorkingDir)
+
+	stream, err := client.Logs(testContext(), &teleportproto.LogsRequest{Id: st.Id})
+	assert.NoError(t, err)
+	resp, err := stream.Recv()
+	assert.NoError(t, err)
+	assert.Equal(t, "hello from /tmp", resp.Text)
+}
+
+// Feeds the standard input of a job
+func TestStdin(t *testing.T) {
+	client, close := mustCreateClientAndServer(t)
+	defer close()
+
+	cmd := []string{"cat"}
+	req := teleportproto.Command{Command: cmd, Stdin: true}
+	st, err := client.Start(testContext(), &req)
+	assert.NoError(t, err)
+	checkStartedJob(t, st, cmd)
+
+	input, err := client.WriteStdin(testContext())
+	assert.NoError(t, err)
+	assert.NoError(t, input.Send(&teleportproto.StdinChunk{Id: st.Id, Data: []byte("hello\n")}))
+	assert.NoError(t, input.Send(&teleportproto.StdinChunk{Data: []byte("world\n"), Eof: true}))
+	_, err = input.CloseAndRecv()
+	assert.NoError(t, err)
+
+	stream, err := client.Logs(testContext(), &teleportproto.LogsRequest{Id: st.Id})
+	assert.NoError(t, err)
+	for _, want := range []string{"hello", "world"} {
+		resp, err := stream.Recv()
+		assert.NoError(t, err)
+		assert.Equal(t, want, resp.Text)
+	}
+	_, err = stream.Recv()
+	assert.Equal(t, io.EOF, err)
+}
+
+// Writing to a job without an open standard input fails
+func TestNoStdin(t *testing.T) {
+	client, close := mustCreateClientAndServer(t)
+	defer close()
+
+	st := startJob(t, client, longCmd)
+	input, err := client.WriteStdin(testContext())
+	assert.NoError(t, err)
+	assert.NoError(t, input.Send(&teleportproto.StdinChunk{Id: st.Id, Data: []byte("hello\n")}))
+	_, err = input.CloseAndRecv()
+	assert.Equal(t, codes.FailedPrecondition, status.Code(err))
+}
+
+// Runs a job in a terminal and interacts with it
+func TestAttach(t *testing.T) {
+	client, close := mustCreateClientAndServer(t)
+	defer close()
+
+	cmd := []string{"bash", "-c", "read line; stty size; echo got $line"}
+	req := teleportproto.Command{Command: cmd, Tty: true}
+	st, err := client.Start(testContext(), &req)
+	assert.NoError(t, err)
+	checkStartedJob(t, st, cmd)
+
+	stream, err := client.Attach(testContext())
+	assert.NoError(t, err)
+	inputs := []*teleportproto.AttachInput{
+		{Input: &teleportproto.AttachInput_Id{Id: st.Id}},
+		{Input: &teleportproto.AttachInput_Resize{Resize: &teleportproto.WindowSize{Rows: 33, Cols: 111}}},
+		{Input: &teleportproto.AttachInput_Data{Data: []byte("hello\n")}},
+	}
+	for _, input := range inputs {
+		assert.NoError(t, stream.Send(input))
+	}
+	assert.NoError(t, stream.CloseSend())
+	output := ""
+	for {
+		resp, err := stream.Recv()
+		if err == io.EOF {
+			break
+		}
+		assert.NoError(t, err)
+		output += string(resp.Data)
+	}
+	assert.Contains(t, output, "33 111\r\n")
+	assert.Contains(t, output, "got hello\r\n")
+}
+
+// Attaching to a job without a terminal fails
+func TestAttachWithoutTerminal(t *testing.T) {
+	client, close := mustCreateClientAndServer(t)
+	defer close()
+
+	st := startJob(t, client, longCmd)
+	stream, err := client.Attach(testContext())
+	assert.NoError(t, err)
+	assert.NoError(t, stream.Send(&teleportproto.AttachInput{Input: &teleportproto.AttachInput_Id{Id: st.Id}}))
+	_, err = stream.Recv()
+	assert.Equal(t, codes.FailedPrecondition, status.Code(err))
+}
+
+// Stops a job that ignores the stop signal
+func TestStopEscalation(t *testing.T) {
+	client, close := mustCreateClientAndServer(t)
+	defer close()
+
+	cmd := []string{"bash", "-c", "trap '' TERM; echo ready; while true; do sleep 0.1; done"}
+	st1 := startJob(t, client, cmd)
+	// make sure the trap is set
+	stream, err := client.Logs(testContext(), &teleportproto.LogsRequest{Id: st1.Id})
+	assert.NoError(t, err)
+	_, err = stream.Recv()
+	assert.NoError(t, err)
+
+	req := teleportproto.StopRequest{Id: st1.Id, Signal: "TERM", GracePeriod: durationpb.New(200 * time.Millisecond)}
+	st2, err := client.Stop(testContext(), &req)
+	assert.NoError(t, err)
+	checkStoppedJob(t, st2, st1.Id.Uuid, cmd)
+	assert.Equal(t, st2.GetStopped().Termination, teleportproto.Termination_T_KILL)
+	assert.Equal(t, teleportproto.StopReason_SR_USER, st2.GetStopped().Reason)
+	assert.Equal(t, "KILL", st2.GetStopped().Signal)
+	assert.Equal(t, "signal: killed", st2.GetStopped().WaitError)
+}
+
+// Stopping with an unknown signal fails
+func TestStopInvalidSignal(t *testing.T) {
+	client, close := mustCreateClientAndServer(t)
+	defer close()
+
+	st := startJob(t, client, longCmd)
+	_, err := client.Stop(testContext(), &teleportproto.StopRequest{Id: st.Id, Signal: "BLAH"})
+	assert.Equal(t, codes.InvalidArgument, status.Code(err))
+}
+
+// Limit classes have to be configured on the server
+func TestUnknownLimitClass(t *testing.T) {
+	client, close := mustCreateClientAndServer(t)
+	defer close()
+
+	_, err := client.Start(testContext(), &teleportproto.Command{Command: shortCmd, LimitClass: "small"})
+	assert.Equal(t, codes.InvalidArgument, status.Code(err))
+}
+
+// Isolated jobs get their own hostname and network
+func TestIsolation(t *testing.T) {
+	client, close := mustCreateClientAndServer(t)
+	defer close()
+
+	cmd := teleportproto.Command{
+		Command:   []string{"bash", "-c", "hostname isolated && hostname"},
+		Isolation: &teleportproto.Isolation{Namespaces: true, Network: teleportproto.Network_N_NONE},
+	}
+	st, err := client.Start(testContext(), &cmd)
+	if status.Code(err) == codes.Internal {
+		t.Skip("namespaces are not available:", err)
+	}
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"pid", "mnt", "uts", "ipc", "net"}, st.Namespaces)
+	stream, err := client.Logs(testContext(), &teleportproto.LogsRequest{Id: st.Id})
+	assert.NoError(t, err)
+	resp, err := stream.Recv()
+	assert.NoError(t, err)
+	assert.Equal(t, "isolated", resp.Text)
+
+	// network isolation requires namespaces
+	cmd.Isolation.Namespaces = false
+	_, err = client.Start(testContext(), &cmd)
+	assert.Equal(t, codes.InvalidArgument, status.Code(err))
+}
+
+// Jobs run as Unix users mapped from principals
+func TestRunAs(t *testing.T) {
+	if os.Geteuid() != 0 {
+		t.Skip("switching users requires root")
+	}
+	nobody := jobs.User{Uid: 65534, Gid: 65534}
+	opts := service.ServiceOptions{
+		AuthCert:   relativePath("certs", "server_cert.pem"),
+		AuthKey:    relativePath("certs", "server_key.pem"),
+		Principals: map[string]string{"team": "team-secret", "other": "other-secret"},
+		Users:      map[string]jobs.User{"team": nobody},
+	}
+	close, err := startServerWithOptions(opts)
+	if err != nil {
+		t.Fatalf("could not start server: %s", err)
+	}
+	defer func() { assert.NoError(t, close()) }()
+
+	client := mustCreateClient(t, "team-secret")
+	defer client.close()
+	st, err := client.Start(testContext(), &teleportproto.Command{Command: []string{"id", "-u"}})
+	assert.NoError(t, err)
+	assert.Equal(t, "team", st.User.Principal)
+	assert.Equal(t, uint32(65534), st.User.Uid)
+	stream, err := client.Logs(testContext(), &teleportproto.LogsRequest{Id: st.Id})
+	assert.NoError(t, err)
+	resp, err := stream.Recv()
+	assert.NoError(t, err)
+	assert.Equal(t, "65534", resp.Text)
+
+	// principals without a user cannot start jobs
+	other := mustCreateClient(t, "other-secret")
+	defer other.close()
+	_, err = other.Start(testContext(), &teleportproto.Command{Command: shortCmd})
+	assert.Equal(t, codes.PermissionDenied, status.Code(err))
+}
+
+// Jobs, schedules and workflows are visible only to the principal that created them
+func TestOwnership(t *testing.T) {
+	opts := service.ServiceOptions{
+		AuthCert:   relativePath("certs", "server_cert.pem"),
+		AuthKey:    relativePath("certs", "server_key.pem"),
+		Principals: map[string]string{"team": "team-secret", "other": "other-secret"},
+	}
+	close, err := startServerWithOptions(opts)
+	if err != nil {
+		t.Fatalf("could not start server: %s", err)
+	}
+	defer func() { assert.NoError(t, close()) }()
+
+	team := mustCreateClient(t, "team-secret")
+	defer team.close()
+	other := mustCreateClient(t, "other-secret")
+	defer other.close()
+
+	st, err := team.Start(testContext(), &teleportproto.Command{Command: []string{"cat"}, Stdin: true})
+	assert.NoError(t, err)
+	_, err = other.GetStatus(testContext(), st.Id)
+	assert.Equal(t, codes.NotFound, status.Code(err))
+	_, err = other.Stop(testContext(), &teleportproto.StopRequest{Id: st.Id})
+	assert.Equal(t, codes.NotFound, status.Code(err))
+	_, err = other.Signal(testContext(), &teleportproto.SignalRequest{Id: st.Id, Signal: "KILL"})
+	assert.Equal(t, codes.NotFound, status.Code(err))
+	_, err = other.Remove(testContext(), st.Id)
+	assert.Equal(t, codes.NotFound, status.Code(err))
+	logs, err := other.Logs(testContext(), &teleportproto.LogsRequest{Id: st.Id})
+	assert.NoError(t, err)
+	_, err = logs.Recv()
+	assert.Equal(t, codes.NotFound, status.Code(err))
+	input, err := other.WriteStdin(testContext())
+	assert.NoError(t, err)
+	assert.NoError(t, input.Send(&teleportproto.StdinChunk{Id: st.Id, Data: []byte("hello\n")}))
+	_, err = input.CloseAndRecv()
+	assert.Equal(t, codes.NotFound, status.Code(err))
+	attach, err := other.Attach(testContext())
+	assert.NoError(t, err)
+	assert.NoError(t, attach.Send(&teleportproto.AttachInput{Input: &teleportproto.AttachInput_Id{Id: st.Id}}))
+	_, err = attach.Recv()
+	assert.Equal(t, codes.NotFound, status.Code(err))
+	list, err := other.List(testContext(), &emptypb.Empty{})
+	assert.NoError(t, err)
+	assert.Empty(t, list.Jobs)
+
+	// the owner still controls the job
+	list, err = team.List(testContext(), &emptypb.Empty{})
+	assert.NoError(t, err)
+	assert.Len(t, list.Jobs, 1)
+	st, err = team.Stop(testContext(), &teleportproto.StopRequest{Id: st.Id})
+	assert.NoError(t, err)
+	assert.NotNil(t, st.GetStopped())
+
+	sc, err := team.Schedule(testContext(), &teleportproto.ScheduleRequest{
+		Command: &teleportproto.Command{Command: shortCmd},
+		When:    &teleportproto.ScheduleRequest_Cron{Cron: "@hourly"},
+	})
+	assert.NoError(t, err)
+	_, err = other.GetSchedule(testContext(), sc.Id)
+	assert.Equal(t, codes.NotFound, status.Code(err))
+	_, err = other.PauseSchedule(testContext(), sc.Id)
+	assert.Equal(t, codes.NotFound, status.Code(err))
+	_, err = other.DeleteSchedule(testContext(), sc.Id)
+	assert.Equal(t, codes.NotFound, status.Code(err))
+	schedules, err := other.ListSchedules(testContext(), &emptypb.Empty{})
+	assert.NoError(t, err)
+	assert.Empty(t, schedules.Schedules)
+	_, err = team.DeleteSchedule(testContext(), sc.Id)
+	assert.NoError(t, err)
+
+	wf, err := team.StartWorkflow(testContext(), &teleportproto.WorkflowRequest{Steps: []*teleportproto.WorkflowStep{
+		{Name: "build", Command: &teleportproto.Command{Command: shortCmd}},
+	}})
+	assert.NoError(t, err)
+	_, err = other.GetWorkflow(testContext(), wf.Id)
+	assert.Equal(t, codes.NotFound, status.Code(err))
+	workflows, err := other.ListWorkflows(testContext(), &emptypb.Empty{})
+	assert.NoError(t, err)
+	assert.Empty(t, workflows.Workflows)
+	_, err = team.GetWorkflow(testContext(), wf.Id)
+	assert.NoError(t, err)
+}
+
+// Jobs running for too long get stopped by the server
+func TestMaxRuntime(t *testing.T) {
+	client, close := mustCreateClientAndServer(t)
+	defer close()
+
+	req := teleportproto.Command{Command: longCmd, MaxRuntime: durationpb.New(200 * time.Millisecond)}
+	st1, err := client.Start(testContext(), &req)
+	assert.NoError(t, err)
+	assert.Equal(t, 200*time.Millisecond, st1.MaxRuntime.AsDuration())
+	time.Sleep(500 * time.Millisecond)
+	st2, err := client.GetStatus(testContext(), st1.Id)
+	assert.NoError(t, err)
+	checkStoppedJob(t, st2, st1.Id.Uuid, longCmd)
+	assert.Equal(t, teleportproto.Timeout_TO_RUNTIME, st2.GetStopped().Timeout)
+	assert.Equal(t, teleportproto.Termination_T_SIGNAL, st2.GetStopped().Termination)
+}
+
+// Failed jobs are restarted, logs of all attempts are streamed together
+func TestRestart(t *testing.T) {
+	client, close := mustCreateClientAndServer(t)
+	defer close()
+
+	cmd := []string{"bash", "-c", "echo run; exit 1"}
+	req := teleportproto.Command{
+		Command: cmd,
+		Restart: &teleportproto.Restart{
+			Policy:     teleportproto.RestartPolicy_RP_ON_FAILURE,
+			MaxRetries: 2,
+			Backoff:    durationpb.New(10 * time.Millisecond),
+		},
+	}
+	st1, err := client.Start(testContext(), &req)
+	assert.NoError(t, err)
+	stream, err := client.Logs(testContext(), &teleportproto.LogsRequest{Id: st1.Id})
+	assert.NoError(t, err)
+	for range 3 {
+		resp, err := stream.Recv()
+		assert.NoError(t, err)
+		assert.Equal(t, "run", resp.Text)
+	}
+	_, err = stream.Recv()
+	assert.Equal(t, io.EOF, err)
+
+	st2, err := client.GetStatus(testContext(), st1.Id)
+	assert.NoError(t, err)
+	checkStoppedJob(t, st2, st1.Id.Uuid, cmd)
+	assert.Len(t, st2.Attempts, 3)
+}
+
+// Jobs above the limit of running jobs wait in the queue and can be canceled there
+func TestQueue(t *testing.T) {
+	close, err := startServerWithOptions(service.ServiceOptions{MaxRunning: 1})
+	if err != nil {
+		t.Fatalf("could not start server: %s", err)
+	}
+	defer func() { assert.NoError(t, close()) }()
+	client := mustCreateClient(t, "")
+	defer client.close()
+
+	st1 := startJob(t, client, longCmd)
+	st2, err := client.Start(testContext(), &teleportproto.Command{Command: shortCmd})
+	assert.NoError(t, err)
+	st3, err := client.Start(testContext(), &teleportproto.Command{Command: shortCmd, Priority: 1})
+	assert.NoError(t, err)
+	assert.Nil(t, st2.Started)
+	assert.Equal(t, uint32(0), st2.GetQueued().Position)
+	assert.Equal(t, uint32(0), st3.GetQueued().Position)
+	st4, err := client.GetStatus(testContext(), st2.Id)
+	assert.NoError(t, err)
+	assert.Equal(t, uint32(1), st4.GetQueued().Position)
+	_, err = client.Signal(testContext(), &teleportproto.SignalRequest{Id: st2.Id, Signal: "HUP"})
+	assert.Equal(t, codes.FailedPrecondition, status.Code(err))
+
+	st5, err := client.Stop(testContext(), &teleportproto.StopRequest{Id: st2.Id})
+	assert.NoError(t, err)
+	assert.Equal(t, teleportproto.Termination_T_CANCEL, st5.GetStopped().Termination)
+	_, err = client.Stop(testContext(), &teleportproto.StopRequest{Id: st1.Id})
+	assert.NoError(t, err)
+	// the remaining queued job starts in place of the stopped one
+	stream, err := client.Logs(testContext(), &teleportproto.LogsRequest{Id: st3.Id})
+	assert.NoError(t, err)
+	resp, err := stream.Recv()
+	assert.NoError(t, err)
+	assert.Equal(t, "blah", resp.Text)
+	_, err = stream.Recv()
+	assert.Equal(t, io.EOF, err)
+	st6, err := client.GetStatus(testContext(), st3.Id)
+	assert.NoError(t, err)
+	checkStoppedJob(t, st6, st3.Id.Uuid, shortCmd)
+}
+
+// Stages of a pipeline pass their output on, the status reports exit codes of all of them
+func TestPipeline(t *testing.T) {
+	client, close := mustCreateClientAndServer(t)
+	defer close()
+
+	cmd := teleportproto.Command{
+		Command:  []string{"sh", "-c", "echo blah; exit 2"},
+		Pipeline: []*teleportproto.Stage{{Command: []string{"tr", "a-z", "A-Z"}}},
+	}
+	st1, err := client.Start(testContext(), &cmd)
+	assert.NoError(t, err)
+	stream, err := client.Logs(testContext(), &teleportproto.LogsRequest{Id: st1.Id})
+	assert.NoError(t, err)
+	resp, err := stream.Recv()
+	assert.NoError(t, err)
+	assert.Equal(t, "BLAH", resp.Text)
+	_, err = stream.Recv()
+	assert.Equal(t, io.EOF, err)
+	st2, err := client.GetStatus(testContext(), st1.Id)
+	assert.NoError(t, err)
+	assert.Equal(t, int32(2), st2.GetStopped().ErrorCode)
+	assert.Equal(t, []int32{2, 0}, st2.GetStopped().StageErrorCodes)
+
+	cmd.Tty = true
+	_, err = client.Start(testContext(), &cmd)
+	assert.Equal(t, codes.InvalidArgument, status.Code(err))
+}
+
+// A one-shot schedule starts its job, the job is linked to the schedule
+func TestSchedule(t *testing.T) {
+	client, close := mustCreateClientAndServer(t)
+	defer close()
+
+	req := teleportproto.ScheduleRequest{
+		Command: &teleportproto.Command{Command: shortCmd},
+		When:    &teleportproto.ScheduleRequest_RunAt{RunAt: timestamppb.New(time.Now().Add(100 * time.Millisecond))},
+	}
+	sc1, err := client.Schedule(testContext(), &req)
+	assert.NoError(t, err)
+	assert.True(t, isUUID(sc1.Id.Uuid))
+	assert.NotNil(t, sc1.NextRun)
+	time.Sleep(300 * time.Millisecond)
+
+	sc2, err := client.GetSchedule(testContext(), sc1.Id)
+	assert.NoError(t, err)
+	assert.Nil(t, sc2.NextRun)
+	if assert.Len(t, sc2.Runs, 1) {
+		st, err := client.GetStatus(testContext(), sc2.Runs[0].JobId)
+		assert.NoError(t, err)
+		checkJob(t, st, shortCmd)
+		assert.Equal(t, sc1.Id.Uuid, st.ScheduleId.Uuid)
+	}
+
+	list, err := client.ListSchedules(testContext(), &emptypb.Empty{})
+	assert.NoError(t, err)
+	assert.Len(t, list.Schedules, 1)
+	_, err = client.DeleteSchedule(testContext(), sc1.Id)
+	assert.NoError(t, err)
+	_, err = client.GetSchedule(testContext(), sc1.Id)
+	assert.Equal(t, codes.NotFound, status.Code(err))
+}
+
+// Steps start after their dependencies, steps depending on a failed step are skipped
+func TestWorkflow(t *testing.T) {
+	client, close := mustCreateClientAndServer(t)
+	defer close()
+
+	req := teleportproto.WorkflowRequest{Steps: []*teleportproto.WorkflowStep{
+		{Name: "build", Command: &teleportproto.Command{Command: shortCmd}},
+		{Name: "test", DependsOn: []string{"build"}, Command: &teleportproto.Command{Command: []string{"false"}}},
+		{Name: "package", DependsOn: []string{"test"}, Command: &teleportproto.Command{Command: shortCmd}},
+	}}
+	wf, err := client.StartWorkflow(testContext(), &req)
+	assert.NoError(t, err)
+	assert.True(t, isUUID(wf.Id.Uuid))
+	assert.Eventually(t, func() bool {
+		wf, err = client.GetWorkflow(testContext(), wf.Id)
+		return err == nil && wf.Finished != nil
+	}, 5*time.Second, 50*time.Millisecond)
+
+	states := []teleportproto.StepState{}
+	for _, step := range wf.Steps {
+		states = append(states, step.State)
+	}
+	assert.Equal(t, []teleportproto.StepState{teleportproto.StepState_S_SUCCEEDED, teleportproto.StepState_S_FAILED, teleportproto.StepState_S_SKIPPED}, states)
+	checkJob(t, wf.Steps[0].Job, shortCmd)
+	assert.Equal(t, wf.Id.Uuid, wf.Steps[0].Job.WorkflowId.Uuid)
+	assert.Nil(t, wf.Steps[2].Job)
+
+	list, err := client.ListWorkflows(testContext(), &emptypb.Empty{})
+	assert.NoError(t, err)
+	assert.Len(t, list.Workflows, 1)
+
+	// cycles are rejected
+	req.Steps[0].DependsOn = []string{"package"}
+	_, err = client.StartWorkflow(testContext(), &req)
+	assert.Equal(t, codes.InvalidArgument, status.Code(err))
+	_, err = client.GetWorkflow(testContext(), &teleportproto.WorkflowId{Uuid: "a"})
+	assert.Equal(t, codes.NotFound, status.Code(err))
+}
+
+// Invalid cron expressions are rejected, paused schedules do not start jobs
+func TestSchedulePause(t *testing.T) {
+	client, close := mustCreateClientAndServer(t)
+	defer close()
+
+	req := teleportproto.ScheduleRequest{
+		Command: &teleportproto.Command{Command: shortCmd},
+		When:    &teleportproto.ScheduleRequest_Cron{Cron: "61 * * * *"},
+	}
+	_, err := client.Schedule(testContext(), &req)
+	assert.Equal(t, codes.InvalidArgument, status.Code(err))
+
+	req.When = &teleportproto.ScheduleRequest_Cron{Cron: "@hourly"}
+	sc1, err := client.Schedule(testContext(), &req)
+	assert.NoError(t, err)
+	sc2, err := client.PauseSchedule(testContext(), sc1.Id)
+	assert.NoError(t, err)
+	assert.True(t, sc2.Paused)
+	sc3, err := client.ResumeSchedule(testContext(), sc1.Id)
+	assert.NoError(t, err)
+	assert.False(t, sc3.Paused)
+	assert.Empty(t, sc3.Runs)
+	assert.True(t, sc3.NextRun.AsTime().After(time.Now()))
+}
+
+// Sends signals to a running job
+func TestSignal(t *testing.T) {
+	client, close := mustCreateClientAndServer(t)
+	defer close()
+
+	cmd := []string{"bash", "-c", "trap 'echo reloading' HUP; echo ready; while true; do sleep 0.1; done"}
+	st1 := startJob(t, client, cmd)
+	stream, err := client.Logs(testContext(), &teleportproto.LogsRequest{Id: st1.Id})
+	assert.NoError(t, err)
+	resp, err := stream.Recv()
+	assert.NoError(t, err)
+	assert.Equal(t, "ready", resp.Text)
+
+	st2, err := client.Signal(testContext(), &teleportproto.SignalRequest{Id: st1.Id, Signal: "HUP"})
+	assert.NoError(t, err)
+	assert.NotNil(t, st2.GetPending())
+	resp, err = stream.Recv()
+	assert.NoError(t, err)
+	assert.Equal(t, "reloading", resp.Text)
+
+	_, err = client.Signal(testContext(), &teleportproto.SignalRequest{Id: st1.Id, Signal: "NOPE"})
+	assert.Equal(t, codes.InvalidArgument, status.Code(err))
+
+	// the job stays in the list after being terminated by a signal
+	_, err = client.Signal(testContext(), &teleportproto.SignalRequest{Id: st1.Id, Signal: "KILL", Group: true})
+	assert.NoError(t, err)
+	time.Sleep(100 * time.Millisecond)
+	st3, err := client.GetStatus(testContext(), st1.Id)
+	assert.NoError(t, err)
+	checkStoppedJob(t, st3, st1.Id.Uuid, cmd)
+
+	_, err = client.Signal(testContext(), &teleportproto.SignalRequest{Id: st1.Id, Signal: "HUP"})
+	assert.Equal(t, codes.FailedPrecondition, status.Code(err))
+}
+
+// Jobs recorded in the store are available after the server restarts
+func TestStoreRestart(t *testing.T) {
+	opts := service.ServiceOptions{StoreDir: t.TempDir()}
+	close, err := startServerWithOptions(opts)
+	if err != nil {
+		t.Fatalf("could not start server: %s", err)
+	}
+	client := mustCreateClient(t, "")
+	defer client.close()
+	finished, err := client.Start(testContext(), &teleportproto.Command{Command: shortCmd})
+	assert.NoError(t, err)
+	time.Sleep(100 * time.Millisecond)
+	// the server goes away while the job runs
+	running := startJob(t, client, []string{"sleep", "1"})
+	assert.NoError(t, close())
+
+	close, err = startServerWithOptions(opts)
+	if err != nil {
+		t.Fatalf("could not restart server: %s", err)
+	}
+	defer func() { assert.NoError(t, close()) }()
+	client = mustCreateClient(t, "")
+	defer client.close()
+
+	st1, err := client.GetStatus(testContext(), finished.Id)
+	assert.NoError(t, err)
+	checkStoppedJob(t, st1, finished.Id.Uuid, shortCmd)
+	assert.Equal(t, teleportproto.Termination_T_EXIT, st1.GetStopped().Termination)
+
+	st2, err := client.GetStatus(testContext(), running.Id)
+	assert.NoError(t, err)
+	checkStoppedJob(t, st2, running.Id.Uuid, []string{"sleep", "1"})
+	assert.Equal(t, teleportproto.Termination_T_LOST, st2.GetStopped().Termination)
+}
+
+// Logs spilled to disk are streamed like the ones kept in memory
+func TestLogsOnDisk(t *testing.T) {
+	opts := service.ServiceOptions{LogDir: t.TempDir(), LogLimits: jobs.LogLimits{Memory: 100, Segment: 1000}}
+	close, err := startServerWithOptions(opts)
+	if err != nil {
+		t.Fatalf("could not start server: %s", err)
+	}
+	defer func() { assert.NoError(t, close()) }()
+	client := mustCreateClient(t, "")
+	defer client.close()
+
+	st, err := client.Start(testContext(), &teleportproto.Command{Command: []string{"seq", "1000"}})
+	assert.NoError(t, err)
+	stream, err := client.Logs(testContext(), &teleportproto.LogsRequest{Id: st.Id})
+	assert.NoError(t, err)
+	for i := 1; i <= 1000; i++ {
+		resp, err := stream.Recv()
+		assert.NoError(t, err)
+		assert.Equal(t, strconv.Itoa(i), resp.Text)
+	}
+	_, err = stream.Recv()
+	assert.Equal(t, io.EOF, err)
+}
+
+// Readers of dropped lines get a marker instead of them
+func TestLogLimits(t *testing.T) {
+	close, err := startServerWithOptions(service.ServiceOptions{LogLimits: jobs.LogLimits{JobLines: 10}})
+	if err != nil {
+		t.Fatalf("could not start server: %s", err)
+	}
+	defer func() { assert.NoError(t, close()) }()
+	client := mustCreateClient(t, "")
+	defer client.close()
+
+	st, err := client.Start(testContext(), &teleportproto.Command{Command: []string{"seq", "100"}})
+	assert.NoError(t, err)
+	time.Sleep(100 * time.Millisecond)
+	st, err = client.GetStatus(testContext(), st.Id)
+	assert.NoError(t, err)
+	assert.NotNil(t, st.GetStopped())
+	assert.Equal(t, uint32(100), st.Logs)
+	assert.Equal(t, uint32(10), st.RetainedLogs)
+
+	stream, err := client.Logs(testContext(), &teleportproto.LogsRequest{Id: st.Id})
+	assert.NoError(t, err)
+	resp, err := stream.Recv()
+	assert.NoError(t, err)
+	assert.Equal(t, uint32(90), resp.Dropped)
+	assert.Empty(t, resp.Text)
+	for i := 91; i <= 100; i++ {
+		resp, err := stream.Recv()
+		assert.NoError(t, err)
+		assert.Equal(t, strconv.Itoa(i), resp.Text)
+		assert.Zero(t, resp.Dropped)
+	}
+	_, err = stream.Recv()
+	assert.Equal(t, io.EOF, err)
+}
+
+func TestRawLogs(t *testing.T) {
+	close, err := startServerWithOptions(service.ServiceOptions{})
+	if err != nil {
+		t.Fatalf("could not start server: %s", err)
+	}
+	defer func() { assert.NoError(t, close()) }()
+	client := mustCreateClient(t, "")
+	defer client.close()
+
+	// not valid UTF-8 and without a line end
+	script := `printf '\000\377 10%%\r'; printf 'latin \351' >&2; printf ' 100%%'`
+	st, err := client.Start(testContext(), &teleportproto.Command{Command: []string{"sh", "-c", script}, Raw: true})
+	assert.NoError(t, err)
+	assert.True(t, st.Command.Raw)
+
+	stream, err := client.Logs(testContext(), &teleportproto.LogsRequest{Id: st.Id})
+	assert.NoError(t, err)
+	var stdout, stderr []byte
+	for {
+		resp, err := stream.Recv()
+		if err == io.EOF {
+			break
+		}
+		assert.NoError(t, err)
+		assert.Empty(t, resp.Text)
+		if resp.Src == teleportproto.LogSource_LS_STDOUT {
+			assert.Equal(t, uint64(len(stdout)), resp.Offset)
+			stdout = append(stdout, resp.Data...)
+		} else {
+			assert.Equal(t, uint64(len(stderr)), resp.Offset)
+			stderr = append(stderr, resp.Data...)
+		}
+	}
+	assert.Equal(t, []byte("\x00\xff 10%\r 100%"), stdout)
+	assert.Equal(t, []byte("latin \xe9"), stderr)
+}
+
+func TestLogOptions(t *testing.T) {
+	close, err := startServerWithOptions(service.ServiceOptions{})
+	if err != nil {
+		t.Fatalf("could not start server: %s", err)
+	}
+	defer func() { assert.NoError(t, close()) }()
+	client := mustCreateClient(t, "")
+	defer client.close()
+
+	script := "for i in $(seq 1 20); do echo out$i; echo err$i >&2; done; sleep 10"
+	st, err := client.Start(testContext(), &teleportproto.Command{Command: []string{"sh", "-c", script}})
+	assert.NoError(t, err)
+	defer client.Stop(testContext(), &teleportproto.StopRequest{Id: st.Id})
+	assert.Eventually(t, func() bool {
+		st, err := client.GetStatus(testContext(), st.Id)
+		return err == nil && st.Logs == 40
+	}, 5*time.Second, 10*time.Millisecond)
+
+	// the job still runs, without following the stream ends
+	req := &teleportproto.LogsRequest{Id: st.Id, Tail: 3, NoFollow: true, Filter: teleportproto.LogFilter_LF_STDERR}
+	stream, err := client.Logs(testContext(), req)
+	assert.NoError(t, err)
+	for i := 18; i <= 20; i++ {
+		resp, err := stream.Recv()
+		assert.NoError(t, err)
+		assert.Equal(t, fmt.Sprintf("err%d", i), resp.Text)
+		assert.Equal(t, teleportproto.LogSource_LS_STDERR, resp.Src)
+	}
+	_, err = stream.Recv()
+	assert.Equal(t, io.EOF, err)
+
+	req = &teleportproto.LogsRequest{Id: st.Id, Since: timestamppb.New(time.Now().Add(time.Hour)), NoFollow: true}
+	stream, err = client.Logs(testContext(), req)
+	assert.NoError(t, err)
+	_, err = stream.Recv()
+	assert.Equal(t, io.EOF, err)
+}
+
+func TestResumeLogs(t *testing.T) {
+	close, err := startServerWithOptions(service.ServiceOptions{})
+	if err != nil {
+		t.Fatalf("could not start server: %s", err)
+	}
+	defer func() { assert.NoError(t, close()) }()
+	client := mustCreateClient(t, "")
+	defer client.close()
+
+	script := "for i in $(seq 1 5); do echo out$i; echo err$i >&2; done"
+	st, err := client.Start(testContext(), &teleportproto.Command{Command: []string{"sh", "-c", script}})
+	assert.NoError(t, err)
+
+	// sequence numbers are shared by both streams
+	var all []*teleportproto.Log
+	stream, err := client.Logs(testContext(), &teleportproto.LogsRequest{Id: st.Id})
+	assert.NoError(t, err)
+	for {
+		resp, err := stream.Recv()
+		if err == io.EOF {
+			break
+		}
+		assert.NoError(t, err)
+		assert.Equal(t, uint64(len(all)), resp.Sequence)
+		all = append(all, resp)
+	}
+	assert.Len(t, all, 10)
+
+	// resumed after the fourth line
+	stream, err = client.Logs(testContext(), &teleportproto.LogsRequest{Id: st.Id, Start: all[3].Sequence + 1})
+	assert.NoError(t, err)
+	for _, expected := range all[4:] {
+		resp, err := stream.Recv()
+		assert.NoError(t, err)
+		assert.Equal(t, expected.Sequence, resp.Sequence)
+		assert.Equal(t, expected.Text, resp.Text)
+		assert.Equal(t, expected.Src, resp.Src)
+	}
+	_, err = stream.Recv()
+	assert.Equal(t, io.EOF, err)
+}
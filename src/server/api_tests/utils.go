@@ -36,14 +36,17 @@ func relativePath(elem ...string) string {
 }
 
 func startServer(secret string) (func() error, error) {
-	opts := service.ServiceOptions{
-		Address: address,
-	}
+	opts := service.ServiceOptions{}
 	if secret != "" {
 		opts.AuthCert = relativePath("certs", "server_cert.pem")
 		opts.AuthKey = relativePath("certs", "server_key.pem")
 		opts.Secret = secret
 	}
+	return startServerWithOptions(opts)
+}
+
+func startServerWithOptions(opts service.ServiceOptions) (func() error, error) {
+	opts.Address = address
 	srv, err := service.NewService(opts)
 	if err != nil {
 		return nil, err
@@ -179,7 +182,7 @@ func startJob(t *testing.T, client client, cmd []string) *teleportproto.JobStatu
 }
 
 func drainLogs(t *testing.T, client client, id *teleportproto.JobId) {
-	stream, err := client.Logs(testContext(), id)
+	stream, err := client.Logs(testContext(), &teleportproto.LogsRequest{Id: id})
 	assert.NoError(t, err)
 	for i := range 7 {
 		resp, err := stream.Recv()
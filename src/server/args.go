@@ -1,14 +1,111 @@
 // Definitions of structures that map to the command line arguments
 package main
 
-import "github.com/alexflint/go-arg"
+import (
+	"fmt"
+	"maps"
+	"slices"
+	"time"
+
+	"github.com/alexflint/go-arg"
+	"github.com/szymonwieloch/go-teleport/server/jobs"
+)
 
 type Args struct {
-	Address  string `arg:"env,required" help:"Address of the server"`
-	AuthKey  string `arg:"env" help:"Path to a authentication key, if desired"`
-	AuthCert string `arg:"env" help:"Path to a authentication certificate, if desired"`
-	Secret   string `arg:"env" help:"A secret for authentication, if desired"`
-	Limits   bool   `help:"Enable cgroup limits"`
+	Address                string               `arg:"env,required" help:"Address of the server"`
+	AuthKey                string               `arg:"env" help:"Path to a authentication key, if desired"`
+	AuthCert               string               `arg:"env" help:"Path to a authentication certificate, if desired"`
+	Secret                 string               `arg:"env" help:"A secret for authentication, if desired"`
+	Limits                 bool                 `help:"Enable cgroup limits"`
+	EnvAllowlist           []string             `arg:"--env-allowlist,env:ENV_ALLOWLIST" help:"Server environment variables that jobs may inherit [default: PATH LANG TZ]"`
+	StopGracePeriod        time.Duration        `arg:"--stop-grace-period,env:STOP_GRACE_PERIOD" default:"10s" help:"Time given to jobs to finish after the stop signal before they get killed"`
+	LimitClasses           map[string]limitsArg `arg:"--limit-class" help:"Named set of job limits, for example small=memory=64M,cpus=0.5,pids=64 [default: small and large]"`
+	DefaultLimitClass      string               `arg:"--default-limit-class" default:"small" help:"Limit class of jobs that do not request any, no limits if empty"`
+	MaxLimits              *limitsArg           `arg:"--max-limits" help:"Maximal limits of a single job, for example memory=4G,cpus=4,pids=4096 [default: memory=4G,cpus=4,pids=4096]"`
+	IOWeight               uint16               `arg:"--io-weight" help:"Proportional share of the block IO time of every job, from 1 to 10000 [default: kernel default]"`
+	IOMax                  map[string]string    `arg:"--io-max" help:"Bandwidth limits of a block device for every job, for example /dev/sda=rbps=10M,wbps=10M,riops=100,wiops=100 or 8:0=wbps=1M"`
+	TotalPids              int64                `arg:"--total-pids" help:"Maximal number of processes of all jobs together, no limit if zero"`
+	DefaultTimeouts        timeoutsArg          `arg:"--default-timeouts" help:"Timeouts of jobs that do not request any, for example runtime=24h,idle=1h [default: no timeouts]"`
+	MaxTimeouts            timeoutsArg          `arg:"--max-timeouts" help:"Maximal timeouts a job may request, for example runtime=72h,idle=12h [default: no maximum]"`
+	Principals             map[string]string    `arg:"--principal" help:"Principal authenticated by its own secret, in the NAME=SECRET form, the main secret authenticates the default principal"`
+	RunAs                  map[string]string    `arg:"--run-as" help:"Unix user that jobs of a principal run as, a name or UID:GID[:GROUP,...], for example default=nobody [default: the server user]"`
+	MaxRunning             int                  `arg:"--max-running" help:"Maximal number of jobs running at the same time, further jobs are queued, no limit if zero"`
+	MaxRunningPerPrincipal int                  `arg:"--max-running-per-principal" help:"Maximal number of jobs of a single principal running at the same time, no limit if zero"`
+	Retention              retentionArg         `arg:"--retention" help:"When finished jobs are removed together with their logs, for example age=24h,count=1000,logs=1G [default: kept until removed]"`
+	StoreDir               string               `arg:"--store-dir,env:STORE_DIR" help:"Directory where jobs are recorded to survive restarts of the server [default: kept only in memory]"`
+	LogDir                 string               `arg:"--log-dir,env:LOG_DIR" help:"Directory where logs of jobs are spilled from memory [default: logs are kept only in memory]"`
+	LogLimits              logLimitsArg         `arg:"--log-limits" help:"When logs are spilled to disk and dropped, for example memory=1M,total-memory=256M,segment=16M,job=1G,job-lines=100000,total=10G, only job limits apply without a log directory [default: memory=1M,segment=16M]"`
+}
+
+// Resource limits in the form accepted by jobs.ParseLimits
+type limitsArg jobs.Limits
+
+func (l *limitsArg) UnmarshalText(text []byte) error {
+	limits, err := jobs.ParseLimits(string(text))
+	*l = limitsArg(limits)
+	return err
+}
+
+// Timeouts in the form accepted by jobs.ParseTimeouts
+type timeoutsArg jobs.Timeouts
+
+func (t *timeoutsArg) UnmarshalText(text []byte) error {
+	timeouts, err := jobs.ParseTimeouts(string(text))
+	*t = timeoutsArg(timeouts)
+	return err
+}
+
+// Retention policy in the form accepted by jobs.ParseRetention
+type retentionArg jobs.Retention
+
+func (r *retentionArg) UnmarshalText(text []byte) error {
+	retention, err := jobs.ParseRetention(string(text))
+	*r = retentionArg(retention)
+	return err
+}
+
+// Log limits in the form accepted by jobs.ParseLogLimits
+type logLimitsArg jobs.LogLimits
+
+func (l *logLimitsArg) UnmarshalText(text []byte) error {
+	limits, err := jobs.ParseLogLimits(string(text))
+	*l = logLimitsArg(limits)
+	return err
+}
+
+// Block IO limits as expected by the jobs package
+func (args Args) ioLimits() (jobs.IOLimits, error) {
+	result := jobs.IOLimits{Weight: args.IOWeight}
+	for _, device := range slices.Sorted(maps.Keys(args.IOMax)) {
+		limits, err := jobs.ParseDeviceIOLimits(device, args.IOMax[device])
+		if err != nil {
+			return jobs.IOLimits{}, err
+		}
+		result.Devices = append(result.Devices, limits)
+	}
+	return result, nil
+}
+
+// Limit classes as expected by the jobs package
+func (args Args) limitClasses() map[string]jobs.Limits {
+	result := make(map[string]jobs.Limits, len(args.LimitClasses))
+	for name, limits := range args.LimitClasses {
+		result[name] = jobs.Limits(limits)
+	}
+	return result
+}
+
+// Unix users of principals as expected by the service package
+func (args Args) users() (map[string]jobs.User, error) {
+	result := make(map[string]jobs.User, len(args.RunAs))
+	for principal, name := range args.RunAs {
+		user, err := jobs.LookupUser(name)
+		if err != nil {
+			return nil, fmt.Errorf("invalid user of principal %s: %w", principal, err)
+		}
+		result[principal] = user
+	}
+	return result, nil
 }
 
 // Either all are empty or all are set
@@ -29,9 +126,47 @@ func definedTogether(a ...string) bool {
 func parseArgs() Args {
 	var result Args
 	parser := arg.MustParse(&result)
-	if !definedTogether(result.Secret, result.AuthCert, result.AuthKey) {
+	if len(result.Principals) == 0 && !definedTogether(result.Secret, result.AuthCert, result.AuthKey) {
 		parser.Fail("Authentication key, certificate and secret need to be provided together")
 	}
+	if len(result.Principals) != 0 && (result.AuthCert == "" || result.AuthKey == "") {
+		parser.Fail("Principals require the authentication key and certificate")
+	}
+	secrets := map[string]bool{result.Secret: result.Secret != ""}
+	for _, secret := range result.Principals {
+		if secret == "" || secrets[secret] {
+			parser.Fail("Secrets of principals have to be unique and not empty")
+		}
+		secrets[secret] = true
+	}
+	if _, err := result.users(); err != nil {
+		parser.Fail(err.Error())
+	}
+	if result.EnvAllowlist == nil {
+		result.EnvAllowlist = jobs.DefaultEnvAllowlist
+	}
+	if result.LimitClasses == nil {
+		result.LimitClasses = make(map[string]limitsArg)
+		for name, limits := range jobs.DefaultLimitClasses {
+			result.LimitClasses[name] = limitsArg(limits)
+		}
+	}
+	if _, ok := result.LimitClasses[result.DefaultLimitClass]; result.DefaultLimitClass != "" && !ok {
+		parser.Fail("Default limit class is not defined")
+	}
+	if result.MaxRunning < 0 || result.MaxRunningPerPrincipal < 0 {
+		parser.Fail("Limits of running jobs cannot be negative")
+	}
+	if result.IOWeight > 10000 {
+		parser.Fail("IO weight has to be between 1 and 10000")
+	}
+	if _, err := result.ioLimits(); err != nil {
+		parser.Fail(err.Error())
+	}
+	if result.MaxLimits == nil {
+		max := limitsArg(jobs.DefaultMaxLimits)
+		result.MaxLimits = &max
+	}
 
 	return result
 }
@@ -1,34 +1,254 @@
 package jobs
 
 import (
+	"errors"
+	"io"
+	"log"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync/atomic"
+	"syscall"
+	"time"
+
 	"github.com/containerd/cgroups/v3/cgroup2"
+	"golang.org/x/sys/unix"
 )
 
 const groupName string = "teleport-group.slice"
-const memLimit int64 = 10 * 1024 * 1024
-const cpuPeriod uint64 = 1000000
-const cpuQuota int64 = 200000
 
-func GetOrCreateGroup() (*cgroup2.Manager, error) {
+// Location of the slice in the cgroup hierarchy, as created by systemd
+const groupPath string = "/teleport.slice/teleport-group.slice"
+
+const cgroupMountpoint string = "/sys/fs/cgroup"
+const cpuPeriod uint64 = 100000
+
+// How often the cgroup of a job is checked for remaining processes if its events cannot be watched
+const cgroupPollInterval = 50 * time.Millisecond
+
+// Longest wait for a change of cgroup.events before the file is read again, in milliseconds
+const cgroupEventsTimeout = 1000
+
+// Parent cgroup of all jobs
+type Slice struct {
+	manager *cgroup2.Manager
+	// where the cgroup hierarchy is mounted
+	mountpoint string
+	// location in the cgroup hierarchy
+	group string
+	// created by systemd and has to be removed through it
+	systemd bool
+}
+
+// Cgroup of a single job
+type jobCgroup struct {
+	*cgroup2.Manager
+	// directory of the cgroup
+	path string
+}
+
+// Set when the kernel cannot start processes directly inside of a cgroup
+var noCloneIntoCgroup atomic.Bool
+
+// Returns the slice under which every job gets its own cgroup.
+// The slice itself only limits the total number of processes of all jobs, zero means unlimited.
+func GetOrCreateGroup(totalPids int64) (*Slice, error) {
+	res := cgroup2.Resources{}
+	if totalPids != 0 {
+		res.Pids = &cgroup2.Pids{Max: totalPids}
+	}
 	m, err := cgroup2.LoadSystemd("/", groupName)
 	if err == nil {
-		return m, nil
+		// loading always succeeds, check if the slice really exists
+		_, err = m.Controllers()
+	}
+	if err == nil {
+		err = m.Update(&res)
+	} else {
+		// dummy PID of -1 is used for creating a "general slice" to be used as a parent cgroup.
+		m, err = cgroup2.NewSystemd("/", groupName, -1, &res)
+	}
+	if err != nil {
+		return nil, err
 	}
+	return &Slice{manager: m, mountpoint: cgroupMountpoint, group: groupPath, systemd: true}, nil
 
-	memMax := memLimit
-	period := cpuPeriod
-	quota := cpuQuota
-	cpu := cgroup2.CPU{
-		Max: cgroup2.NewCPUMax(&quota, &period),
+}
+
+// Kills processes of all jobs
+func (slice *Slice) kill() error {
+	return slice.manager.Kill()
+}
+
+// Removes the slice
+func (slice *Slice) delete() error {
+	if slice.systemd {
+		return slice.manager.DeleteSystemd()
 	}
-	mem := cgroup2.Memory{
-		Max: &memMax,
+	return slice.manager.Delete()
+}
+
+// Creates a cgroup of a single job inside of the slice
+func newJobGroup(slice *Slice, id JobID, limits Limits, io IOLimits) (*jobCgroup, error) {
+	group := slice.group + "/" + string(id)
+	m, err := cgroup2.NewManager(slice.mountpoint, group, resources(limits, io))
+	if err != nil {
+		return nil, err
 	}
-	res := cgroup2.Resources{
-		CPU:    &cpu,
-		Memory: &mem,
+	cgroup := &jobCgroup{Manager: m, path: filepath.Join(slice.mountpoint, group)}
+	if io.Weight != 0 {
+		// not supported by the cgroup manager, which sets only the weight of the BFQ scheduler
+		weight := "default " + strconv.Itoa(int(io.Weight))
+		err = os.WriteFile(filepath.Join(cgroup.path, "io.weight"), []byte(weight), 0)
+		if err != nil {
+			deleteCgroup(cgroup)
+			return nil, err
+		}
 	}
-	// dummy PID of -1 is used for creating a "general slice" to be used as a parent cgroup.
-	return cgroup2.NewSystemd("/", groupName, -1, &res)
+	return cgroup, nil
+}
+
+// Maps limits of a job to the cgroup resources.
+// Only controllers of the limited resources are enabled.
+func resources(limits Limits, io IOLimits) *cgroup2.Resources {
+	res := cgroup2.Resources{}
+	if limits.Memory != 0 {
+		res.Memory = &cgroup2.Memory{Max: &limits.Memory}
+	}
+	if limits.CPUs != 0 {
+		period := cpuPeriod
+		quota := int64(limits.CPUs * float64(period))
+		res.CPU = &cgroup2.CPU{Max: cgroup2.NewCPUMax(&quota, &period)}
+	}
+	if limits.Pids != 0 {
+		res.Pids = &cgroup2.Pids{Max: limits.Pids}
+	}
+	if entries := io.entries(); len(entries) != 0 || io.Weight != 0 {
+		res.IO = &cgroup2.IO{Max: entries}
+	}
+	return &res
+}
 
+// Configures the command to be started directly inside of the cgroup,
+// so that it cannot do anything before it is limited.
+// Returns the opened cgroup directory that has to be closed once the command started,
+// nil if the kernel does not support it.
+func cloneIntoCgroup(cmd *exec.Cmd, cgroup *jobCgroup) (*os.File, error) {
+	if noCloneIntoCgroup.Load() {
+		return nil, nil
+	}
+	dir, err := os.Open(cgroup.path)
+	if err != nil {
+		return nil, err
+	}
+	cmd.SysProcAttr.CgroupFD = int(dir.Fd())
+	cmd.SysProcAttr.UseCgroupFD = true
+	return dir, nil
+}
+
+// Checks if starting of a process failed because the kernel cannot start it inside of a cgroup.
+// Remembers it, so that following processes are moved into cgroups after they start.
+func cloneIntoCgroupUnsupported(err error) bool {
+	// no clone3 at all or no CLONE_INTO_CGROUP support in it
+	if errors.Is(err, syscall.ENOSYS) || errors.Is(err, syscall.E2BIG) || errors.Is(err, syscall.EINVAL) {
+		log.Println("Processes cannot be started inside of cgroups, they are moved after start:", err)
+		noCloneIntoCgroup.Store(true)
+		return true
+	}
+	return false
+}
+
+// Blocks until no process remains in the cgroup.
+// The kernel notifies about changes of cgroup.events, the processes are polled only if it cannot be watched.
+func waitCgroup(cgroup *jobCgroup) {
+	events, err := os.Open(filepath.Join(cgroup.path, "cgroup.events"))
+	if err != nil {
+		pollCgroup(cgroup)
+		return
+	}
+	defer events.Close()
+	buffer := make([]byte, 512)
+	for {
+		n, err := events.ReadAt(buffer, 0)
+		if err != nil && err != io.EOF {
+			pollCgroup(cgroup)
+			return
+		}
+		populated, ok := parsePopulated(string(buffer[:n]))
+		if !ok {
+			pollCgroup(cgroup)
+			return
+		}
+		if !populated {
+			return
+		}
+		// a change of the file is reported as a priority event
+		fds := []unix.PollFd{{Fd: int32(events.Fd()), Events: unix.POLLPRI}}
+		_, err = unix.Poll(fds, cgroupEventsTimeout)
+		if err != nil && err != unix.EINTR {
+			pollCgroup(cgroup)
+			return
+		}
+	}
+}
+
+// Blocks until no process remains in the cgroup, checks the processes periodically
+func pollCgroup(cgroup *jobCgroup) {
+	for {
+		procs, err := cgroup.Procs(true)
+		if err != nil || len(procs) == 0 {
+			return
+		}
+		time.Sleep(cgroupPollInterval)
+	}
+}
+
+// Checks if the kernel OOM killer killed any process in the cgroup, false if nil.
+// The counter is available only with the memory controller enabled.
+func oomKilled(cgroup *jobCgroup) bool {
+	if cgroup == nil {
+		return false
+	}
+	events, err := os.ReadFile(filepath.Join(cgroup.path, "memory.events"))
+	if err != nil {
+		return false
+	}
+	return parseOOMKills(string(events)) > 0
+}
+
+// Extracts from the content of the cgroup.events file if any process lives in the cgroup or its descendants.
+// Returns false as the second value if the file does not report it.
+func parsePopulated(events string) (bool, bool) {
+	for _, line := range strings.Split(events, "\n") {
+		name, value, ok := strings.Cut(line, " ")
+		if ok && name == "populated" {
+			return strings.TrimSpace(value) != "0", true
+		}
+	}
+	return false, false
+}
+
+// Extracts the oom_kill counter from the content of the memory.events file
+func parseOOMKills(events string) uint64 {
+	for _, line := range strings.Split(events, "\n") {
+		name, value, ok := strings.Cut(line, " ")
+		if ok && name == "oom_kill" {
+			count, _ := strconv.ParseUint(strings.TrimSpace(value), 10, 64)
+			return count
+		}
+	}
+	return 0
+}
+
+// Deletes the cgroup of a job, does nothing if nil
+func deleteCgroup(cgroup *jobCgroup) {
+	if cgroup == nil {
+		return
+	}
+	err := cgroup.Delete()
+	if err != nil {
+		log.Println("Could not delete cgroup", err)
+	}
 }
@@ -0,0 +1,209 @@
+package jobs
+
+import (
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"syscall"
+	"testing"
+	"time"
+
+	"github.com/containerd/cgroups/v3"
+	"github.com/containerd/cgroups/v3/cgroup2"
+	"github.com/google/uuid"
+	"github.com/stretchr/testify/assert"
+)
+
+// Creates a parent cgroup for jobs, skips the test if cgroups v2 cannot be used
+func testSlice(t *testing.T) *Slice {
+	var mountpoint string
+	switch cgroups.Mode() {
+	case cgroups.Unified:
+		mountpoint = cgroupMountpoint
+	case cgroups.Hybrid:
+		mountpoint = filepath.Join(cgroupMountpoint, "unified")
+	default:
+		t.Skip("cgroups v2 are not available")
+	}
+	group := "/teleport-test-" + uuid.New().String()
+	m, err := cgroup2.NewManager(mountpoint, group, &cgroup2.Resources{})
+	if err != nil {
+		t.Skip("cannot create cgroup:", err)
+	}
+	slice := &Slice{manager: m, mountpoint: mountpoint, group: group}
+	t.Cleanup(func() { slice.delete() })
+	return slice
+}
+
+// Skips the test if the controllers cannot be used in the slice
+func requireControllers(t *testing.T, slice *Slice, controllers ...string) {
+	available, err := os.ReadFile(filepath.Join(slice.mountpoint, slice.group, "cgroup.controllers"))
+	assert.NoError(t, err)
+	for _, c := range controllers {
+		if !slices.Contains(strings.Fields(string(available)), c) {
+			t.Skip("cgroup controller is not available:", c)
+		}
+	}
+}
+
+func TestJobCgroup(t *testing.T) {
+	slice := testSlice(t)
+	j, err := newJob(Spec{Command: []string{"cat", "/proc/self/cgroup"}}, Config{}, slice)
+	assert.NoError(t, err)
+	// the very first instruction of the job runs inside of its cgroup
+	lines := allLines(j)
+	assert.Contains(t, lines, "0::"+slice.group+"/"+string(j.ID))
+	<-j.killedSignal
+	// the cgroup of the job is removed
+	assert.NoDirExists(t, j.cgroup.path)
+}
+
+func TestJobCgroupFallback(t *testing.T) {
+	slice := testSlice(t)
+	noCloneIntoCgroup.Store(true)
+	defer noCloneIntoCgroup.Store(false)
+	j, err := newJob(Spec{Command: []string{"sleep", "10"}}, Config{}, slice)
+	assert.NoError(t, err)
+	defer j.stop(StopOptions{})
+	procs, err := j.cgroup.Procs(false)
+	assert.NoError(t, err)
+	assert.Equal(t, []uint64{uint64(j.cmd.Process.Pid)}, procs)
+}
+
+func TestJobCgroupEscape(t *testing.T) {
+	slice := testSlice(t)
+	// the child leaves the process group of the job, but not its cgroup, and ignores the stop signal
+	cmd := []string{"bash", "-c", "setsid bash -c \"trap '' TERM; sleep 1000\" & sleep 0.1; echo ready; wait"}
+	j, err := newJob(Spec{Command: cmd}, Config{}, slice)
+	assert.NoError(t, err)
+	j.GetLogs(0, 1)
+	assert.NoError(t, j.stop(StopOptions{GracePeriod: 200 * time.Millisecond}))
+	assert.Equal(t, TerminationKill, j.Status().Stopped.Termination)
+	assert.NoDirExists(t, j.cgroup.path)
+}
+
+func TestJobCgroupLimits(t *testing.T) {
+	slice := testSlice(t)
+	requireControllers(t, slice, "memory", "cpu", "pids")
+	limits := Limits{Memory: 32 << 20, CPUs: 0.5, Pids: 16}
+	j, err := newJob(Spec{Command: []string{"sleep", "10"}, Limits: limits}, Config{}, slice)
+	assert.NoError(t, err)
+	defer j.stop(StopOptions{})
+	assert.Equal(t, limits, j.Status().Limits)
+	max, err := os.ReadFile(filepath.Join(j.cgroup.path, "memory.max"))
+	assert.NoError(t, err)
+	assert.Equal(t, "33554432\n", string(max))
+}
+
+func TestJobPidsLimit(t *testing.T) {
+	slice := testSlice(t)
+	requireControllers(t, slice, "pids")
+	cmd := []string{"bash", "-c", "for i in $(seq 20); do sleep 1 & done 2>/dev/null; jobs -p | wc -l"}
+	j, err := newJob(Spec{Command: cmd, Limits: Limits{Pids: 5}}, Config{}, slice)
+	assert.NoError(t, err)
+	defer j.stop(StopOptions{})
+	lines := allLines(j)
+	assert.NotEqual(t, []string{"20"}, lines)
+}
+
+func TestJobIOLimits(t *testing.T) {
+	slice := testSlice(t)
+	requireControllers(t, slice, "io")
+	config := Config{IO: IOLimits{Weight: 50}}
+	j, err := newJob(Spec{Command: []string{"true"}}, config, slice)
+	assert.NoError(t, err)
+	defer j.stop(StopOptions{})
+	weight, err := os.ReadFile(filepath.Join(j.cgroup.path, "io.weight"))
+	assert.NoError(t, err)
+	assert.Contains(t, string(weight), "default 50")
+}
+
+func TestCloneIntoCgroupUnsupported(t *testing.T) {
+	defer noCloneIntoCgroup.Store(false)
+	assert.False(t, cloneIntoCgroupUnsupported(&os.PathError{Op: "fork/exec", Path: "sleep", Err: syscall.ENOENT}))
+	assert.False(t, noCloneIntoCgroup.Load())
+	assert.True(t, cloneIntoCgroupUnsupported(&os.PathError{Op: "fork/exec", Path: "sleep", Err: syscall.ENOSYS}))
+	assert.True(t, noCloneIntoCgroup.Load())
+}
+
+func TestJobIsolatedCgroup(t *testing.T) {
+	slice := testSlice(t)
+	requireNamespaces(t)
+	spec := Spec{Command: []string{"cat", "/proc/self/cgroup"}, Isolation: Isolation{Namespaces: true}}
+	j, err := newJob(spec, Config{}, slice)
+	assert.NoError(t, err)
+	// children of init stay in the cgroup of the job
+	assert.Contains(t, allLines(j), "0::"+slice.group+"/"+string(j.ID))
+	<-j.killedSignal
+	assert.Equal(t, 0, j.Status().Stopped.ExitCode)
+}
+
+func TestJobRestartCgroup(t *testing.T) {
+	slice := testSlice(t)
+	restart := Restart{Policy: RestartAlways, MaxRetries: 1, Backoff: 10 * time.Millisecond}
+	j, err := newJob(Spec{Command: []string{"cat", "/proc/self/cgroup"}, Restart: restart}, Config{}, slice)
+	assert.NoError(t, err)
+	// every attempt gets a fresh cgroup of the job
+	group := "0::" + slice.group + "/" + string(j.ID)
+	found := 0
+	for _, line := range allLines(j) {
+		if line == group {
+			found++
+		}
+	}
+	assert.Equal(t, 2, found)
+	<-j.killedSignal
+	assert.Len(t, j.Status().Attempts, 2)
+	assert.NoDirExists(t, j.cgroup.path)
+}
+
+func TestParseOOMKills(t *testing.T) {
+	assert.Equal(t, uint64(2), parseOOMKills("low 0\nhigh 0\nmax 5\noom 2\noom_kill 2\noom_group_kill 0\n"))
+	assert.Equal(t, uint64(0), parseOOMKills("low 0\n"))
+}
+
+func TestParsePopulated(t *testing.T) {
+	populated, ok := parsePopulated("populated 1\nfrozen 0\n")
+	assert.True(t, ok)
+	assert.True(t, populated)
+	populated, ok = parsePopulated("populated 0\nfrozen 0\n")
+	assert.True(t, ok)
+	assert.False(t, populated)
+	_, ok = parsePopulated("frozen 0\n")
+	assert.False(t, ok)
+}
+
+func TestWaitCgroup(t *testing.T) {
+	slice := testSlice(t)
+	// the child outlives the command
+	j, err := newJob(Spec{Command: []string{"sh", "-c", "sleep 0.3 & exit 0"}}, Config{}, slice)
+	assert.NoError(t, err)
+	defer j.stop(StopOptions{})
+	start := time.Now()
+	<-j.killedSignal
+	elapsed := time.Since(start)
+	assert.Greater(t, elapsed, 250*time.Millisecond)
+	// notified by the kernel, not by the timeout of the events
+	assert.Less(t, elapsed, cgroupEventsTimeout*time.Millisecond)
+}
+
+func TestJobOOMKilled(t *testing.T) {
+	slice := testSlice(t)
+	requireControllers(t, slice, "memory")
+	limits := Limits{Memory: 16 << 20}
+	// keeps allocating until the kernel kills it
+	cmd := []string{"sh", "-c", "x=a; while true; do x=$x$x; done"}
+	j, err := newJob(Spec{Command: cmd, Limits: limits}, Config{}, slice)
+	assert.NoError(t, err)
+	select {
+	case <-j.killedSignal:
+	case <-time.After(10 * time.Second):
+		j.kill()
+		t.Fatal("job was not killed")
+	}
+	stopped := j.Status().Stopped
+	assert.True(t, stopped.OOMKilled)
+	assert.Equal(t, syscall.SIGKILL, stopped.Signal)
+	assert.Equal(t, StopReasonNone, stopped.Reason)
+}
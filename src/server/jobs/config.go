@@ -0,0 +1,39 @@
+// Server-wide configuration of jobs
+package jobs
+
+import "time"
+
+// Environment variables that are passed through to jobs if nothing else is configured
+var DefaultEnvAllowlist = []string{"PATH", "LANG", "TZ"}
+
+// Configuration shared by all jobs
+type Config struct {
+	// Names of the server environment variables that jobs may inherit
+	EnvAllowlist []string
+	// Time given to jobs to finish after the stop signal if not requested otherwise
+	StopGracePeriod time.Duration
+	// Named sets of resource limits that jobs can request
+	LimitClasses map[string]Limits
+	// Class of jobs that do not request any, no limits if empty
+	DefaultLimitClass string
+	// Maximal resource limits of a single job, zero means unlimited
+	MaxLimits Limits
+	// Block IO limits of every job
+	IO IOLimits
+	// Timeouts of jobs that do not request any
+	DefaultTimeouts Timeouts
+	// Maximal timeouts of a single job, zero means no maximum
+	MaxTimeouts Timeouts
+	// Maximal number of jobs running at the same time, further jobs are queued, zero means unlimited
+	MaxRunning int
+	// Maximal number of jobs of a single owner running at the same time, zero means unlimited
+	MaxRunningPerOwner int
+	// When finished jobs are removed, they are kept until removed explicitly if zero
+	Retention Retention
+	// Where jobs are recorded to survive restarts of the server, kept only in memory if nil
+	Store Store
+	// Where logs are spilled from memory, all logs are kept in memory if nil
+	Logs *LogStorage
+	// Limits of kept logs of a single job, only the ones of jobs apply without a log storage
+	LogLimits LogLimits
+}
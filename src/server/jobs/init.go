@@ -0,0 +1,163 @@
+// Init process of isolated jobs
+package jobs
+
+import (
+	"fmt"
+	"os"
+	"os/exec"
+	"os/signal"
+	"strings"
+	"syscall"
+
+	"golang.org/x/sys/unix"
+)
+
+// Name under which the server binary is started as the init process of an isolated job
+const initName = "teleport-init"
+
+// Option of the init process that brings up the loopback interface
+const initLoopback = "--loopback"
+
+// Option of the init process that starts the command as another user, followed by the user in the UID:GID:GROUPS form
+const initUser = "--user="
+
+// Exit code of the init process if the command could not be started
+const initFailure = 127
+
+// Runs the init process of an isolated job if the binary was started as one, otherwise does nothing.
+// Has to be called at the very beginning of main() of any binary that starts isolated jobs.
+//
+// The init process is the first process in the new PID namespace.
+// It mounts /proc of the namespace, optionally brings up the loopback interface,
+// then starts the command in its own process group, forwards signals to that group and reaps orphans.
+// The command cannot be started directly, because the first process of a namespace ignores signals it does not handle.
+// Exits with the exit code of the command or with 128 plus the signal number if the command was killed.
+func RunInit() {
+	if len(os.Args) == 0 || os.Args[0] != initName {
+		return
+	}
+	loopback := false
+	var user *User
+	args := os.Args[1:]
+	for len(args) > 0 && args[0] != "--" {
+		if args[0] == initLoopback {
+			loopback = true
+		}
+		if numbers, ok := strings.CutPrefix(args[0], initUser); ok {
+			u, err := parseUser(numbers)
+			if err != nil {
+				initFail(err)
+			}
+			user = &u
+		}
+		args = args[1:]
+	}
+	if len(args) < 2 {
+		initFail(fmt.Errorf("no command"))
+	}
+	os.Exit(runInit(args[1:], loopback, user))
+}
+
+// Prints the error to the output of the job and exits
+func initFail(err error) {
+	fmt.Fprintln(os.Stderr, initName+":", err)
+	os.Exit(initFailure)
+}
+
+// Prepares the namespaces, runs the command and returns its exit code.
+// The init process keeps its privileges, only the command runs as the user.
+func runInit(command []string, loopback bool, user *User) int {
+	// do not propagate mounts back to the server
+	err := unix.Mount("", "/", "", unix.MS_REC|unix.MS_PRIVATE, "")
+	if err != nil {
+		initFail(fmt.Errorf("could not make mounts private: %w", err))
+	}
+	err = unix.Mount("proc", "/proc", "proc", unix.MS_NOSUID|unix.MS_NODEV|unix.MS_NOEXEC, "")
+	if err != nil {
+		initFail(fmt.Errorf("could not mount /proc: %w", err))
+	}
+	if loopback {
+		err = loopbackUp()
+		if err != nil {
+			initFail(fmt.Errorf("could not bring up the loopback interface: %w", err))
+		}
+	}
+	signals := make(chan os.Signal, 16)
+	signal.Notify(signals)
+
+	cmd := exec.Command(command[0], command[1:]...)
+	cmd.Stdin, cmd.Stdout, cmd.Stderr = os.Stdin, os.Stdout, os.Stderr
+	cmd.SysProcAttr = &syscall.SysProcAttr{Setpgid: true}
+	if user != nil {
+		cmd.SysProcAttr.Credential = user.credential()
+	}
+	if _, err := unix.IoctlGetTermios(0, unix.TCGETS); err == nil {
+		// the command has to own the terminal to read from it
+		cmd.SysProcAttr.Foreground = true
+		cmd.SysProcAttr.Ctty = 0
+	}
+	err = cmd.Start()
+	if err != nil {
+		initFail(err)
+	}
+	pid := cmd.Process.Pid
+	exited := make(chan int)
+	go reap(pid, exited)
+	for {
+		select {
+		case sig := <-signals:
+			s := sig.(syscall.Signal)
+			// the runtime uses SIGURG internally, SIGCHLD is handled by reaping
+			if s != syscall.SIGCHLD && s != syscall.SIGURG {
+				syscall.Kill(-pid, s)
+			}
+		case code := <-exited:
+			// remaining processes of the namespace get killed once init exits
+			return code
+		}
+	}
+}
+
+// Reaps all children, reports the exit code once the command with the given pid finishes
+func reap(pid int, exited chan<- int) {
+	for {
+		var status unix.WaitStatus
+		child, err := unix.Wait4(-1, &status, 0, nil)
+		if err == unix.EINTR {
+			continue
+		}
+		if err != nil {
+			// no children left, should not happen before the command finished
+			exited <- initFailure
+			return
+		}
+		if child != pid {
+			continue
+		}
+		if status.Signaled() {
+			exited <- 128 + int(status.Signal())
+		} else {
+			exited <- status.ExitStatus()
+		}
+		return
+	}
+}
+
+// Brings up the loopback interface of a new network namespace
+func loopbackUp() error {
+	fd, err := unix.Socket(unix.AF_INET, unix.SOCK_DGRAM|unix.SOCK_CLOEXEC, 0)
+	if err != nil {
+		return err
+	}
+	defer unix.Close(fd)
+	ifreq, err := unix.NewIfreq("lo")
+	if err != nil {
+		return err
+	}
+	err = unix.IoctlIfreq(fd, unix.SIOCGIFFLAGS, ifreq)
+	if err != nil {
+		return err
+	}
+	ifreq.SetUint16(ifreq.Uint16() | unix.IFF_UP)
+	return unix.IoctlIfreq(fd, unix.SIOCSIFFLAGS, ifreq)
+}
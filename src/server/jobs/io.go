@@ -0,0 +1,119 @@
+// Block IO limits of jobs
+package jobs
+
+import (
+	"fmt"
+	"os"
+	"strconv"
+	"strings"
+	"syscall"
+
+	"github.com/containerd/cgroups/v3/cgroup2"
+	"golang.org/x/sys/unix"
+)
+
+// Block IO limits applied to every job
+type IOLimits struct {
+	// Proportional share of the IO time, from 1 to 10000, the kernel default if zero
+	Weight uint16
+	// Bandwidth limits of block devices
+	Devices []DeviceIOLimits
+}
+
+// Bandwidth limits of a single block device, zero means unlimited
+type DeviceIOLimits struct {
+	Major int64
+	Minor int64
+	// Bytes per second
+	ReadBPS  uint64
+	WriteBPS uint64
+	// Operations per second
+	ReadIOPS  uint64
+	WriteIOPS uint64
+}
+
+// Maps the limits to entries of the io.max file of a cgroup
+func (io IOLimits) entries() []cgroup2.Entry {
+	var result []cgroup2.Entry
+	for _, dev := range io.Devices {
+		rates := []struct {
+			t    cgroup2.IOType
+			rate uint64
+		}{
+			{cgroup2.ReadBPS, dev.ReadBPS},
+			{cgroup2.WriteBPS, dev.WriteBPS},
+			{cgroup2.ReadIOPS, dev.ReadIOPS},
+			{cgroup2.WriteIOPS, dev.WriteIOPS},
+		}
+		for _, r := range rates {
+			if r.rate != 0 {
+				result = append(result, cgroup2.Entry{Type: r.t, Major: dev.Major, Minor: dev.Minor, Rate: r.rate})
+			}
+		}
+	}
+	return result
+}
+
+// Parses bandwidth limits of a block device.
+// The device is either a path like /dev/sda or numbers in the MAJOR:MINOR form.
+// Limits are in the form of "rbps=10M,wbps=10M,riops=100,wiops=100", bandwidth accepts K, M and G suffixes.
+func ParseDeviceIOLimits(device, limits string) (DeviceIOLimits, error) {
+	var result DeviceIOLimits
+	var err error
+	result.Major, result.Minor, err = deviceNumbers(device)
+	if err != nil {
+		return DeviceIOLimits{}, err
+	}
+	for _, item := range strings.Split(limits, ",") {
+		name, value, ok := strings.Cut(item, "=")
+		if !ok {
+			return DeviceIOLimits{}, fmt.Errorf("invalid IO limit %q", item)
+		}
+		var bytes int64
+		switch strings.TrimSpace(name) {
+		case "rbps":
+			bytes, err = parseBytes(value)
+			result.ReadBPS = uint64(bytes)
+		case "wbps":
+			bytes, err = parseBytes(value)
+			result.WriteBPS = uint64(bytes)
+		case "riops":
+			result.ReadIOPS, err = strconv.ParseUint(value, 10, 64)
+		case "wiops":
+			result.WriteIOPS, err = strconv.ParseUint(value, 10, 64)
+		default:
+			return DeviceIOLimits{}, fmt.Errorf("unknown IO limit %q", name)
+		}
+		if err == nil && bytes < 0 {
+			err = fmt.Errorf("negative value")
+		}
+		if err != nil {
+			return DeviceIOLimits{}, fmt.Errorf("invalid value of IO limit %q: %w", name, err)
+		}
+	}
+	return result, nil
+}
+
+// Obtains major and minor numbers of a block device
+func deviceNumbers(device string) (int64, int64, error) {
+	if major, minor, ok := strings.Cut(device, ":"); ok {
+		ma, err := strconv.ParseInt(major, 10, 64)
+		if err != nil {
+			return 0, 0, fmt.Errorf("invalid device %q: %w", device, err)
+		}
+		mi, err := strconv.ParseInt(minor, 10, 64)
+		if err != nil {
+			return 0, 0, fmt.Errorf("invalid device %q: %w", device, err)
+		}
+		return ma, mi, nil
+	}
+	info, err := os.Stat(device)
+	if err != nil {
+		return 0, 0, err
+	}
+	stat, ok := info.Sys().(*syscall.Stat_t)
+	if !ok || info.Mode()&os.ModeDevice == 0 {
+		return 0, 0, fmt.Errorf("%s is not a device", device)
+	}
+	return int64(unix.Major(stat.Rdev)), int64(unix.Minor(stat.Rdev)), nil
+}
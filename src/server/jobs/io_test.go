@@ -0,0 +1,43 @@
+package jobs
+
+import (
+	"testing"
+
+	"github.com/containerd/cgroups/v3/cgroup2"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestParseDeviceIOLimits(t *testing.T) {
+	limits, err := ParseDeviceIOLimits("8:16", "rbps=10M,wbps=1K,riops=100,wiops=50")
+	assert.NoError(t, err)
+	assert.Equal(t, DeviceIOLimits{Major: 8, Minor: 16, ReadBPS: 10 << 20, WriteBPS: 1 << 10, ReadIOPS: 100, WriteIOPS: 50}, limits)
+
+	// character device, but numbers are obtained the same way
+	limits, err = ParseDeviceIOLimits("/dev/null", "wiops=10")
+	assert.NoError(t, err)
+	assert.Equal(t, DeviceIOLimits{Major: 1, Minor: 3, WriteIOPS: 10}, limits)
+
+	for _, invalid := range [][2]string{
+		{"8:x", "rbps=1M"},
+		{"/etc/passwd", "rbps=1M"},
+		{"8:0", "rbps"},
+		{"8:0", "speed=1M"},
+		{"8:0", "rbps=-1"},
+		{"8:0", "riops=-1"},
+	} {
+		_, err = ParseDeviceIOLimits(invalid[0], invalid[1])
+		assert.Error(t, err, invalid)
+	}
+}
+
+func TestIOEntries(t *testing.T) {
+	io := IOLimits{Devices: []DeviceIOLimits{
+		{Major: 8, Minor: 0, ReadBPS: 1000, WriteIOPS: 10},
+		{Major: 8, Minor: 16},
+	}}
+	assert.Equal(t, []cgroup2.Entry{
+		{Type: cgroup2.ReadBPS, Major: 8, Minor: 0, Rate: 1000},
+		{Type: cgroup2.WriteIOPS, Major: 8, Minor: 0, Rate: 10},
+	}, io.entries())
+	assert.Equal(t, "8:0 rbps=1000", io.entries()[0].String())
+}
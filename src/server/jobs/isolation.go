@@ -0,0 +1,123 @@
+// Isolation of jobs in Linux namespaces
+package jobs
+
+import (
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"syscall"
+)
+
+// Network available to a job
+type Network int
+
+const (
+	// The job shares the network of the server
+	NetworkHost Network = iota
+	// The job gets its own network with the loopback interface only
+	NetworkNone
+)
+
+// How a job is isolated from the server and from other jobs
+type Isolation struct {
+	// Runs the job in new PID, mount, UTS and IPC namespaces
+	Namespaces bool
+	// Network of the job, NetworkNone requires namespaces
+	Network Network
+}
+
+// Checks if the isolation can be applied
+func (isolation Isolation) validate() error {
+	switch isolation.Network {
+	case NetworkHost:
+		return nil
+	case NetworkNone:
+		if isolation.Namespaces {
+			return nil
+		}
+	}
+	return ErrInvalidSpec
+}
+
+// Names of the namespaces created for the job, as in /proc/<pid>/ns
+func (isolation Isolation) namespaces() []string {
+	if !isolation.Namespaces {
+		return nil
+	}
+	result := []string{"pid", "mnt", "uts", "ipc"}
+	if isolation.Network == NetworkNone {
+		result = append(result, "net")
+	}
+	return result
+}
+
+// Flags of clone() that create the namespaces
+func (isolation Isolation) cloneflags() uintptr {
+	if !isolation.Namespaces {
+		return 0
+	}
+	flags := uintptr(syscall.CLONE_NEWPID | syscall.CLONE_NEWNS | syscall.CLONE_NEWUTS | syscall.CLONE_NEWIPC)
+	if isolation.Network == NetworkNone {
+		flags |= syscall.CLONE_NEWNET
+	}
+	return flags
+}
+
+// Creates the command of the job, path is the resolved executable of the command.
+// An isolated command is started through the init process, which prepares its namespaces
+// and then starts the command as the given user, if any.
+func (isolation Isolation) command(path string, command []string, user *User) *exec.Cmd {
+	if !isolation.Namespaces {
+		cmd := exec.Command(path, command[1:]...)
+		cmd.Args[0] = command[0]
+		return cmd
+	}
+	args := []string{initName}
+	if isolation.Network == NetworkNone {
+		args = append(args, initLoopback)
+	}
+	if user != nil {
+		args = append(args, initUser+user.numbers())
+	}
+	args = append(args, "--", path)
+	args = append(args, command[1:]...)
+	cmd := exec.Command("/proc/self/exe")
+	cmd.Args = args
+	return cmd
+}
+
+// Finds the executable of the command the same way for isolated and not isolated jobs.
+// Names with a slash are relative to the working directory of the job, other names are searched for
+// in PATH of the job environment, or of the server if the job does not have any.
+func lookPath(name string, env []string, dir string) (string, error) {
+	if strings.Contains(name, "/") {
+		path := name
+		if dir != "" && !filepath.IsAbs(path) {
+			path = filepath.Join(dir, path)
+		}
+		// a name with a slash is checked directly
+		_, err := exec.LookPath(path)
+		if err != nil {
+			return "", err
+		}
+		return path, nil
+	}
+	search := os.Getenv("PATH")
+	for _, variable := range env {
+		if value, ok := strings.CutPrefix(variable, "PATH="); ok {
+			search = value
+		}
+	}
+	for _, entry := range filepath.SplitList(search) {
+		if !filepath.IsAbs(entry) {
+			// relative entries are ignored, as by exec
+			continue
+		}
+		path := filepath.Join(entry, name)
+		if _, err := exec.LookPath(path); err == nil {
+			return path, nil
+		}
+	}
+	return "", &exec.Error{Name: name, Err: exec.ErrNotFound}
+}
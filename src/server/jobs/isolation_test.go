@@ -0,0 +1,162 @@
+package jobs
+
+import (
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"syscall"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestMain(m *testing.M) {
+	// isolated jobs are started through the test binary
+	RunInit()
+	os.Exit(m.Run())
+}
+
+// Skips the test if namespaces cannot be created
+func requireNamespaces(t *testing.T) {
+	j, err := newJob(Spec{Command: []string{"true"}, Isolation: Isolation{Namespaces: true}}, Config{}, nil)
+	if err != nil {
+		t.Skip("namespaces are not available:", err)
+	}
+	<-j.killedSignal
+}
+
+func TestIsolationValidation(t *testing.T) {
+	cmd := []string{"true"}
+	assert.NoError(t, Spec{Command: cmd, Isolation: Isolation{Namespaces: true, Network: NetworkNone}}.validate())
+	assert.ErrorIs(t, Spec{Command: cmd, Isolation: Isolation{Network: NetworkNone}}.validate(), ErrInvalidSpec)
+	assert.ErrorIs(t, Spec{Command: cmd, Isolation: Isolation{Network: 7}}.validate(), ErrInvalidSpec)
+}
+
+func TestJobIsolation(t *testing.T) {
+	requireNamespaces(t)
+	cmd := []string{"bash", "-c", "tr '\\0' ' ' </proc/1/cmdline; echo; pids=(/proc/[0-9]*); echo ${#pids[@]}; hostname isolated && hostname"}
+	spec := Spec{Command: cmd, Isolation: Isolation{Namespaces: true}}
+	j, err := newJob(spec, Config{}, nil)
+	assert.NoError(t, err)
+	host, _ := os.Hostname()
+	// init is the first process and the command sees only processes of its namespace: init and bash
+	lines := allLines(j)
+	if assert.Len(t, lines, 3) {
+		assert.True(t, strings.HasPrefix(lines[0], initName+" -- "), lines[0])
+		assert.Equal(t, []string{"2", "isolated"}, lines[1:])
+	}
+	<-j.killedSignal
+	assert.Equal(t, 0, j.Status().Stopped.ExitCode)
+	assert.Equal(t, []string{"pid", "mnt", "uts", "ipc"}, j.Status().Namespaces)
+	after, _ := os.Hostname()
+	assert.Equal(t, host, after)
+}
+
+func TestJobIsolatedNetwork(t *testing.T) {
+	requireNamespaces(t)
+	// only the loopback interface exists and it is up - connections are refused instead of unreachable
+	cmd := []string{"bash", "-c", "tail -n +3 /proc/net/dev | cut -d: -f1; exec 3<>/dev/tcp/127.0.0.1/1"}
+	spec := Spec{Command: cmd, Isolation: Isolation{Namespaces: true, Network: NetworkNone}}
+	j, err := newJob(spec, Config{}, nil)
+	assert.NoError(t, err)
+	lines := allLines(j)
+	<-j.killedSignal
+	assert.Equal(t, []string{"pid", "mnt", "uts", "ipc", "net"}, j.Status().Namespaces)
+	if assert.NotEmpty(t, lines) {
+		assert.Equal(t, "lo", strings.TrimSpace(lines[0]))
+		assert.Contains(t, lines[len(lines)-1], "Connection refused")
+	}
+}
+
+func TestJobIsolatedStop(t *testing.T) {
+	requireNamespaces(t)
+	// the background child would survive without the namespace
+	cmd := []string{"bash", "-c", "setsid sleep 1000 & echo ready; wait"}
+	j, err := newJob(Spec{Command: cmd, Isolation: Isolation{Namespaces: true}}, Config{}, nil)
+	assert.NoError(t, err)
+	j.GetLogs(0, 1)
+	stopTime := time.Now()
+	assert.NoError(t, j.stop(StopOptions{GracePeriod: time.Second}))
+	assert.Less(t, time.Since(stopTime), time.Second)
+	assert.Empty(t, j.GetLogs(1, 1))
+	// init reports the signal that terminated the command
+	assert.Equal(t, 128+int(syscall.SIGTERM), j.Status().Stopped.ExitCode)
+}
+
+func TestJobIsolatedStopAfterExit(t *testing.T) {
+	requireNamespaces(t)
+	// init is already reaped while the job waits for its restart
+	spec := Spec{Command: []string{"true"}, Isolation: Isolation{Namespaces: true}, Restart: Restart{Policy: RestartAlways, Backoff: time.Hour}}
+	j, err := newJob(spec, Config{}, nil)
+	assert.NoError(t, err)
+	assert.Eventually(t, func() bool { return len(j.Status().Attempts) == 1 }, 5*time.Second, 10*time.Millisecond)
+	assert.NoError(t, j.stop(StopOptions{}))
+	<-j.killedSignal
+	assert.Equal(t, 0, j.Status().Stopped.ExitCode)
+}
+
+func TestJobIsolatedSignal(t *testing.T) {
+	requireNamespaces(t)
+	cmd := []string{"bash", "-c", "trap 'echo reloading' HUP; echo ready; while true; do sleep 0.1; done"}
+	j, err := newJob(Spec{Command: cmd, Isolation: Isolation{Namespaces: true}}, Config{}, nil)
+	assert.NoError(t, err)
+	defer j.stop(StopOptions{})
+	j.GetLogs(0, 1)
+	assert.NoError(t, j.Signal(syscall.SIGHUP, false))
+	// the signal reaches also the running sleep, bash may report that it was hung up first
+	var lines []string
+	for _, entry := range j.GetLogs(1, 2) {
+		lines = append(lines, entry.Line)
+	}
+	if len(lines) == 1 && lines[0] != "reloading" {
+		lines = append(lines, j.GetLogs(2, 1)[0].Line)
+	}
+	assert.Contains(t, lines, "reloading")
+}
+
+func TestLookPath(t *testing.T) {
+	dir := t.TempDir()
+	script := filepath.Join(dir, "script")
+	assert.NoError(t, os.WriteFile(script, []byte("#!/bin/sh\necho from job\n"), 0o755))
+
+	path, err := lookPath("./script", nil, dir)
+	assert.NoError(t, err)
+	assert.Equal(t, script, path)
+	path, err = lookPath("script", []string{"PATH=/nonexistent:" + dir}, "")
+	assert.NoError(t, err)
+	assert.Equal(t, script, path)
+	// without PATH of its own the job uses the one of the server
+	path, err = lookPath("sh", []string{"LANG=C"}, dir)
+	assert.NoError(t, err)
+	assert.True(t, filepath.IsAbs(path))
+	_, err = lookPath("script", []string{"PATH=/nonexistent"}, dir)
+	assert.ErrorIs(t, err, exec.ErrNotFound)
+	_, err = lookPath("./script", nil, "")
+	assert.Error(t, err)
+}
+
+// The executable is resolved against the job, not the server, whether the job is isolated or not
+func TestJobIsolatedLookPath(t *testing.T) {
+	requireNamespaces(t)
+	dir := t.TempDir()
+	assert.NoError(t, os.WriteFile(filepath.Join(dir, "script"), []byte("#!/bin/sh\necho from job\n"), 0o755))
+	for _, namespaces := range []bool{false, true} {
+		for _, spec := range []Spec{
+			{Command: []string{"./script"}, Dir: dir},
+			{Command: []string{"script"}, Env: map[string]string{"PATH": dir}},
+		} {
+			spec.Isolation.Namespaces = namespaces
+			j, err := newJob(spec, Config{}, nil)
+			if assert.NoError(t, err) {
+				assert.Equal(t, []string{"from job"}, allLines(j))
+			}
+		}
+	}
+}
+
+func TestJobIsolatedMissingCommand(t *testing.T) {
+	_, err := newJob(Spec{Command: []string{"barambaram"}, Isolation: Isolation{Namespaces: true}}, Config{}, nil)
+	assert.Error(t, err)
+}
@@ -4,11 +4,13 @@ package jobs
 import (
 	"errors"
 	"log"
+	"os"
 	"os/exec"
+	"slices"
 	"sync"
+	"syscall"
 	"time"
 
-	"github.com/containerd/cgroups/v3/cgroup2"
 	"github.com/google/uuid"
 	"github.com/struCoder/pidusage"
 )
@@ -16,21 +18,118 @@ import (
 // Waiting on the process to complete failed
 var ErrTimeout = errors.New("Timeout")
 
+// Time given to the killed job to finish
+const killTimeout = 5 * time.Second
+
+// Time given to the outputs of a finished process to be read
+const drainTimeout = time.Second
+
+// Time given to the process to consume data written to its standard input
+const stdinWriteTimeout = time.Minute
+
+// Time given to the job to finish after the stop signal if not requested otherwise
+const DefaultStopGracePeriod = 10 * time.Second
+
+// How a job should be stopped
+type StopOptions struct {
+	// Signal sent first, SIGTERM if zero
+	Signal syscall.Signal
+	// Time given to the job to finish after the signal before it gets killed, the default if zero
+	GracePeriod time.Duration
+	// set when the job is stopped because of a timeout
+	timeout Timeout
+}
+
+// The job already finished
+var ErrNotRunning = errors.New("Job is not running")
+
+// Standard input of the job was not requested or is already closed
+var ErrNoStdin = errors.New("Standard input is not available")
+
+// The job waits in the queue, its process is not started yet
+var ErrQueued = errors.New("Job is queued")
+
+// The main process of the job exited, but processes it started are still running
+var ErrMainExited = errors.New("Main process of the job exited, its descendants are still running")
+
 type Job struct {
-	mutex        sync.Mutex
-	ID           JobID
-	Command      []string
-	Started      time.Time
-	Stopped      time.Time
-	cmd          *exec.Cmd
+	mutex    sync.Mutex
+	ID       JobID
+	Spec     Spec
+	Limits   Limits
+	Timeouts Timeouts
+	// When the job was submitted, it may wait in the queue before it starts
+	Submitted time.Time
+	Started   time.Time
+	Stopped   time.Time
+	// nil while the job is queued, the first stage of a pipeline
+	cmd *exec.Cmd
+	// further stages of a pipeline, in the process group of the first stage
+	stages       []*exec.Cmd
 	logs         *logs
 	killedSignal chan struct{}
+	termination  Termination
+	// why the server stopped the job and the timeout that made it do so
+	reason  StopReason
+	timeout Timeout
+	// result of waiting for the current process
+	waitErr   error
+	oomKilled bool
+	// closed once the job is requested to stop, it does not get restarted any more
+	stopSignal chan struct{}
+	// serializes writers, writing may block until the process reads its input
+	stdinWriteMutex sync.Mutex
+	// guards stdin, never held while writing, so the input can be closed under a blocked writer
+	stdinMutex sync.Mutex
+	stdin      *os.File
+	terminal   *terminal
+	// cgroup of the current process, nil if limits are disabled
+	cgroup *jobCgroup
+	// used to start the command again
+	config Config
+	slice  *Slice
+	// finished runs of the command
+	attempts []Attempt
+	// current run of the command
+	attemptStarted  time.Time
+	attemptFirstLog int
+	// done once the outputs of the current process are fully read
+	outputs *sync.WaitGroup
+	// why the process could not be started
+	err error
+	// collection that may queue the job, nil if the job is started directly
+	jobs *Jobs
+	// recorded result of a job loaded from the store, nil if the job ran in this server
+	restored *StoppedJobStatus
 }
 
 // Stops the job and waits for it to finish.
+// The stop signal is sent first, if the job does not finish within the grace period it gets killed.
 // Thread safe.
-func (job *Job) stop() error {
-	err := job.kill()
+func (job *Job) stop(opts StopOptions) error {
+	sig := opts.Signal
+	if sig == 0 {
+		sig = syscall.SIGTERM
+	}
+	grace := opts.GracePeriod
+	if grace == 0 {
+		grace = DefaultStopGracePeriod
+	}
+	reason := StopReasonUser
+	if opts.timeout != TimeoutNone {
+		reason = StopReasonTimeout
+	}
+	err := job.terminate(sig, TerminationSignal, reason, opts.timeout)
+	if err != nil {
+		return err
+	}
+	select {
+	case <-job.killedSignal:
+		return nil
+	case <-time.After(grace):
+		log.Println("Job", job.ID, "did not stop within", grace, "killing it")
+	}
+	err = job.terminate(syscall.SIGKILL, TerminationKill, reason, opts.timeout)
 	if err != nil {
 		return err
 	}
@@ -38,27 +137,142 @@ func (job *Job) stop() error {
 	select {
 	case <-job.killedSignal:
 		return nil
-	case <-time.After(5 * time.Second):
+	case <-time.After(killTimeout):
 		return ErrTimeout
 	}
 }
 
-// Sends a kill signal to the job.
+// Sends a kill signal to the job, the server is shutting down.
 // Does not wait for the job to finish.
 // Thread safe.
 func (job *Job) kill() error {
+	return job.terminate(syscall.SIGKILL, TerminationKill, StopReasonShutdown, TimeoutNone)
+}
+
+// Sends the signal to the job and records the termination step together with the reason and the timeout that caused it.
+// Does nothing if the job already finished.
+// Thread safe.
+func (job *Job) terminate(sig syscall.Signal, termination Termination, reason StopReason, timeout Timeout) error {
 	job.mutex.Lock()
 	defer job.mutex.Unlock()
-	if !job.isStopped() {
-		err := job.cmd.Process.Kill()
-		if err != nil {
-			log.Println("Could not kill the job", job.ID, err)
-			return err
-		}
+	if job.isStopped() {
+		return nil
 	}
+	if job.cmd == nil {
+		// there is no process yet, the job leaves the queue
+		job.reason = reason
+		job.timeout = timeout
+		job.termination = TerminationCancel
+		job.finishQueued()
+		return nil
+	}
+	job.requestStop()
+	err := job.signalTree(sig)
+	if errors.Is(err, os.ErrProcessDone) || errors.Is(err, syscall.ESRCH) {
+		// finished, but not marked as stopped yet
+		return nil
+	}
+	if err != nil {
+		log.Println("Could not send", sig, "to the job", job.ID, err)
+		return err
+	}
+	if job.termination == TerminationExit {
+		// the first request to stop the job decides why it was stopped
+		job.reason = reason
+		job.timeout = timeout
+	}
+	job.termination = termination
 	return nil
 }
 
+// Prevents further restarts of the job.
+// NOT thread safe
+func (job *Job) requestStop() {
+	select {
+	case <-job.stopSignal:
+	default:
+		close(job.stopSignal)
+	}
+}
+
+// Sends the signal to the whole process tree of the job, not only to the direct child.
+// With a cgroup it reaches also processes that left the process group of the job.
+// NOT thread safe
+func (job *Job) signalTree(sig syscall.Signal) error {
+	if job.Spec.Isolation.Namespaces {
+		// init forwards the signal to the process group of the command,
+		// once it gets killed the kernel kills everything in its namespace
+		return job.cmd.Process.Signal(sig)
+	}
+	if job.cgroup == nil {
+		return signalGroup(job.cmd.Process.Pid, sig)
+	}
+	if sig == syscall.SIGKILL {
+		return job.cgroup.Kill()
+	}
+	procs, err := job.cgroup.Procs(true)
+	if err != nil {
+		return err
+	}
+	if len(procs) == 0 {
+		return syscall.ESRCH
+	}
+	for _, pid := range procs {
+		// may have finished in the meantime
+		syscall.Kill(int(pid), sig)
+	}
+	return nil
+}
+
+// Sends the signal to the job or to its whole process group.
+// Isolated jobs always receive it in the whole process group, init of their namespace forwards it there.
+// Every stage of a pipeline receives the signal.
+// Without the group ErrMainExited is returned once the main process exited while its descendants still run,
+// they can be reached only through the group.
+// Unlike stopping, it does not affect the way the job is managed.
+// Thread safe.
+func (job *Job) Signal(sig syscall.Signal, group bool) error {
+	job.mutex.Lock()
+	defer job.mutex.Unlock()
+	if job.isStopped() {
+		return ErrNotRunning
+	}
+	if job.cmd == nil {
+		return ErrQueued
+	}
+	var err error
+	if group && !job.Spec.Isolation.Namespaces {
+		// every job leads its own process group
+		err = signalGroup(job.cmd.Process.Pid, sig)
+	} else {
+		// stages that already finished are skipped, it is an error only if no stage got the signal
+		delivered := false
+		processes := []*os.Process{job.cmd.Process}
+		for _, stage := range job.stages {
+			processes = append(processes, stage.Process)
+		}
+		for _, process := range processes {
+			stageErr := process.Signal(sig)
+			if stageErr == nil {
+				delivered = true
+			} else {
+				err = stageErr
+			}
+		}
+		if delivered {
+			err = nil
+		}
+	}
+	if errors.Is(err, os.ErrProcessDone) || errors.Is(err, syscall.ESRCH) {
+		// the job is stopped once the whole tree finishes
+		if !group && job.signalTree(0) == nil {
+			return ErrMainExited
+		}
+		return ErrNotRunning
+	}
+	return err
+}
+
 // Returns true if the process is stopped.
 // NOT thread safe
 func (job *Job) isStopped() bool {
@@ -72,35 +286,78 @@ func (job *Job) IsStopped() bool {
 	return job.isStopped()
 }
 
+// Returns true if the job waits in the queue.
+// Thread safe
+func (job *Job) IsQueued() bool {
+	job.mutex.Lock()
+	defer job.mutex.Unlock()
+	return job.cmd == nil && !job.isStopped()
+}
+
 // Returns snapshot of status of the job.
 // Thread safe.
 func (job *Job) Status() JobStatus {
-
+	position := -1
+	if job.jobs != nil {
+		// the queue is locked before the job everywhere else
+		position = job.jobs.position(job)
+	}
 	job.mutex.Lock()
 	defer job.mutex.Unlock()
 	js := JobStatus{
-		ID:      job.ID,
-		Logs:    job.logs.size(),
-		Command: job.Command,
-		Started: job.Started,
+		ID:           job.ID,
+		Logs:         job.logs.size(),
+		RetainedLogs: job.logs.retained(),
+		Spec:         job.Spec,
+		Submitted:    job.Submitted,
+		Started:      job.Started,
+		Limits:       job.Limits,
+		Timeouts:     job.Timeouts,
+		Namespaces:   job.Spec.Isolation.namespaces(),
+		Attempts:     slices.Clone(job.attempts),
 	}
 
-	if job.isStopped() && job.cmd.ProcessState != nil {
+	if job.restored != nil {
+		stopped := *job.restored
+		stopped.StageExitCodes = slices.Clone(stopped.StageExitCodes)
+		js.Stopped = &stopped
+	} else if job.isStopped() {
 		js.Stopped = &StoppedJobStatus{
-			ExitCode: job.cmd.ProcessState.ExitCode(),
-			Stopped:  job.Stopped,
+			ExitCode:    -1,
+			Stopped:     job.Stopped,
+			Termination: job.termination,
+			Timeout:     job.timeout,
+			Reason:      job.reason,
+			OOMKilled:   job.oomKilled,
 		}
+		if job.cmd != nil && job.cmd.ProcessState != nil {
+			codes := job.exitCodes()
+			js.Stopped.ExitCode = pipelineExitCode(codes)
+			if len(job.stages) > 0 {
+				js.Stopped.StageExitCodes = codes
+			}
+			js.Stopped.Signal, js.Stopped.CoreDumped = processSignal(job.decisiveState(), job.Spec.Isolation.Namespaces)
+		}
+		if job.waitErr != nil {
+			js.Stopped.WaitError = job.waitErr.Error()
+		}
+		if job.err != nil {
+			js.Stopped.Error = job.err.Error()
+		}
+	} else if job.cmd == nil {
+		js.Queued = &QueuedJobStatus{Position: max(position, 0)}
 	} else {
-		stats, err := pidusage.GetStat(job.cmd.Process.Pid)
-		if err != nil {
-			log.Printf("error getting process statistics: %v", err)
-		} else {
-			js.Pending = &PendingJobStatus{
-				CPUPercentage: float32(stats.CPU),
-				Memory:        float32(stats.Memory),
+		js.Pending = &PendingJobStatus{}
+		for _, cmd := range append([]*exec.Cmd{job.cmd}, job.stages...) {
+			// fails when the direct child already exited but its descendants still run
+			stats, err := pidusage.GetStat(cmd.Process.Pid)
+			if err != nil {
+				log.Printf("error getting process statistics: %v", err)
+			} else {
+				js.Pending.CPUPercentage += float32(stats.CPU)
+				js.Pending.Memory += float32(stats.Memory)
 			}
 		}
-
 	}
 	return js
 }
@@ -113,17 +370,234 @@ func (job *Job) markStopped() {
 	job.Stopped = time.Now()
 }
 
-// Waits for the process to finish.
+// Waits for the process and everything it started in its process group to finish.
+// Starts the command again as long as the restart policy requires it.
 // Marks the job as stopped.
 // Sends a signal to the channel when the job is stopped.
 func (job *Job) wait() {
+	for {
+		job.waitAttempt()
+		delay, restart := job.finishAttempt()
+		if !restart {
+			break
+		}
+		log.Println("Restarting job", job.ID, "in", delay)
+		select {
+		case <-job.stopSignal:
+		case <-time.After(delay):
+		}
+		if !job.restart() {
+			break
+		}
+	}
+	job.markStopped()
+	job.logs.close()
+	// nobody is going to read it any more
+	job.closeInput()
+	close(job.killedSignal) // broadcast that the job is stopped
+}
+
+// Waits for the current process and for its descendants to finish
+func (job *Job) waitAttempt() {
 	err := job.cmd.Wait()
+	for _, stage := range job.stages {
+		// the last failure decides, as for the exit code
+		stageErr := stage.Wait()
+		if stageErr != nil {
+			err = stageErr
+		}
+	}
+	// children left behind may still run and hold the outputs open
+	if job.cgroup != nil {
+		waitCgroup(job.cgroup)
+	} else {
+		waitGroup(job.cmd.Process.Pid)
+	}
 	log.Println("Job", job.ID, "finished")
-	job.markStopped()
+	if job.terminal != nil {
+		job.terminal.processReaped()
+	}
+	// counters are gone together with the cgroup
+	oomKilled := oomKilled(job.cgroup)
+	deleteCgroup(job.cgroup)
 	if err != nil {
 		log.Println("Job", job.ID, "finished with error:", err)
 	}
-	close(job.killedSignal) // broadcast that the job is stopped
+	if oomKilled {
+		log.Println("Out of memory killer killed a process of job", job.ID)
+	}
+	job.mutex.Lock()
+	defer job.mutex.Unlock()
+	job.waitErr = err
+	job.oomKilled = oomKilled
+}
+
+// Records the finished attempt and decides if the command should be started again.
+// Returns the delay before the restart.
+// Thread safe
+func (job *Job) finishAttempt() (time.Duration, bool) {
+	drained := make(chan struct{})
+	go func() {
+		job.outputs.Wait()
+		close(drained)
+	}()
+	select {
+	case <-drained:
+	case <-time.After(drainTimeout):
+		// a process that left the job still holds the outputs open
+	}
+	job.mutex.Lock()
+	defer job.mutex.Unlock()
+	logs := job.logs.size()
+	job.attempts = append(job.attempts, Attempt{
+		Started:  job.attemptStarted,
+		Stopped:  time.Now(),
+		ExitCode: pipelineExitCode(job.exitCodes()),
+		FirstLog: job.attemptFirstLog,
+		Logs:     logs - job.attemptFirstLog,
+	})
+	select {
+	case <-job.stopSignal:
+		return 0, false
+	default:
+	}
+	return job.Spec.Restart.next(job.attempts)
+}
+
+// Exit codes of all stages of the finished process, -1 for stages that did not finish.
+// NOT thread safe
+func (job *Job) exitCodes() []int {
+	result := make([]int, 0, len(job.stages)+1)
+	for _, cmd := range append([]*exec.Cmd{job.cmd}, job.stages...) {
+		if cmd.ProcessState == nil {
+			result = append(result, -1)
+		} else {
+			result = append(result, cmd.ProcessState.ExitCode())
+		}
+	}
+	return result
+}
+
+// Process state that decides the result of the job - of the last stage that failed, of the last stage if all of them succeeded.
+// NOT thread safe
+func (job *Job) decisiveState() *os.ProcessState {
+	cmds := append([]*exec.Cmd{job.cmd}, job.stages...)
+	result := cmds[len(cmds)-1].ProcessState
+	for _, cmd := range cmds {
+		if cmd.ProcessState != nil && cmd.ProcessState.ExitCode() != 0 {
+			result = cmd.ProcessState
+		}
+	}
+	return result
+}
+
+// Starts the command again unless the job was requested to stop in the meantime.
+// Returns false if the job is not running.
+// Thread safe
+func (job *Job) restart() bool {
+	job.mutex.Lock()
+	defer job.mutex.Unlock()
+	select {
+	case <-job.stopSignal:
+		return false
+	default:
+	}
+	err := job.spawn()
+	if err != nil {
+		log.Println("Could not restart job", job.ID, err)
+		return false
+	}
+	return true
+}
+
+// Writes data to the standard input of the job.
+// In the terminal mode data is written to the terminal as if it was typed.
+// Blocks until the process consumes the data, at most for stdinWriteTimeout.
+// Returns ErrNoStdin if the input gets closed in the meantime.
+// Thread safe.
+func (job *Job) WriteStdin(data []byte) error {
+	if job.IsQueued() {
+		return ErrQueued
+	}
+	job.stdinWriteMutex.Lock()
+	defer job.stdinWriteMutex.Unlock()
+	if job.terminal != nil {
+		return job.terminal.write(data)
+	}
+	job.stdinMutex.Lock()
+	stdin := job.stdin
+	job.stdinMutex.Unlock()
+	if stdin == nil {
+		return ErrNoStdin
+	}
+	err := stdin.SetWriteDeadline(time.Now().Add(stdinWriteTimeout))
+	if err == nil {
+		_, err = stdin.Write(data)
+	}
+	if errors.Is(err, os.ErrClosed) {
+		return ErrNoStdin
+	}
+	return err
+}
+
+// Closes the standard input of the job, the process receives EOF.
+// In the terminal mode the end of input character is sent instead, the terminal stays open.
+// Thread safe.
+func (job *Job) CloseStdin() error {
+	if job.IsQueued() {
+		return ErrQueued
+	}
+	// data written before is consumed first
+	job.stdinWriteMutex.Lock()
+	defer job.stdinWriteMutex.Unlock()
+	if job.terminal != nil {
+		return job.terminal.write([]byte{terminalEOF})
+	}
+	job.stdinMutex.Lock()
+	defer job.stdinMutex.Unlock()
+	if job.stdin == nil {
+		return ErrNoStdin
+	}
+	err := job.stdin.Close()
+	job.stdin = nil
+	return err
+}
+
+// Releases the standard input of the finished job.
+// Does not wait for writers, a blocked writer gets an error.
+func (job *Job) closeInput() {
+	job.stdinMutex.Lock()
+	defer job.stdinMutex.Unlock()
+	if job.stdin != nil {
+		job.stdin.Close()
+		job.stdin = nil
+	}
+}
+
+// Attaches to the terminal of the job.
+// Returns a channel with the live terminal output and a function that detaches from the terminal.
+// The channel gets closed when the terminal is closed or when the client is too slow to read it.
+func (job *Job) Attach() (<-chan []byte, func(), error) {
+	if job.IsQueued() {
+		return nil, nil, ErrQueued
+	}
+	if job.terminal == nil {
+		return nil, nil, ErrNoTerminal
+	}
+	output, detach := job.terminal.attach()
+	return output, detach, nil
+}
+
+// Changes size of the terminal window of the job.
+// Thread safe.
+func (job *Job) ResizeTerminal(size WindowSize) error {
+	if job.IsQueued() {
+		return ErrQueued
+	}
+	if job.terminal == nil {
+		return ErrNoTerminal
+	}
+	return job.terminal.resize(size)
 }
 
 // Returns logs of the job.
@@ -135,50 +609,218 @@ func (job *Job) GetLogs(start, maxCount int) []LogEntry {
 	return job.logs.get(start, maxCount)
 }
 
-// Creates a new job.
-func newJob(command []string, cgroup *cgroup2.Manager) (*Job, error) {
-	cmd := exec.Command(command[0], command[1:]...)
-	// this is how process should be added to the group before it starts
-	// but there is no API that allows you to obtain this FD.
-	// if cgroup != nil {
-	// 	cmd.SysProcAttr.CgroupFD = cgroup.Fd()
-	// 	cmd.SysProcAttr.UseCgroupFD = true
-	// }
-	stdout, err := cmd.StdoutPipe()
+// Creates and starts a new job.
+// With a slice every job gets its own cgroup inside of it.
+func newJob(spec Spec, config Config, slice *Slice) (*Job, error) {
+	j, err := prepareJob(spec, config, slice)
 	if err != nil {
 		return nil, err
 	}
-	stderr, err := cmd.StderrPipe()
+	err = j.start()
 	if err != nil {
-		stdout.Close()
 		return nil, err
 	}
+	return j, nil
+}
 
-	err = cmd.Start()
+// Creates a new job without starting its process, the job is queued until start() is called.
+func prepareJob(spec Spec, config Config, slice *Slice) (*Job, error) {
+	err := spec.validate()
+	if err != nil {
+		return nil, err
+	}
+	limits, err := config.limits(spec)
+	if err != nil {
+		return nil, err
+	}
+	timeouts, err := config.timeouts(spec)
 	if err != nil {
-		stderr.Close()
-		stdout.Close()
 		return nil, err
 	}
+	if slice == nil {
+		// limits are not applied
+		limits = Limits{}
+	}
+	id := JobID(uuid.New().String())
+	jobLogs := newLogs(id, config.Logs, config.LogLimits)
+	jobLogs.raw = spec.Raw
+	return &Job{
+		ID:           id,
+		Spec:         spec,
+		Limits:       limits,
+		Timeouts:     timeouts,
+		Submitted:    time.Now(),
+		logs:         jobLogs,
+		killedSignal: make(chan struct{}),
+		stopSignal:   make(chan struct{}),
+		config:       config,
+		slice:        slice,
+	}, nil
+}
+
+// Starts the process of a queued job.
+// Returns ErrNotRunning if the job was stopped while queued.
+// Thread safe
+func (job *Job) start() error {
+	job.mutex.Lock()
+	defer job.mutex.Unlock()
+	if job.isStopped() {
+		return ErrNotRunning
+	}
+	err := job.spawn()
+	if err != nil {
+		return err
+	}
+	job.Started = job.attemptStarted
+	go job.wait()
+	if job.Timeouts != (Timeouts{}) {
+		go job.watch(job.Timeouts, job.config.StopGracePeriod)
+	}
+	return nil
+}
+
+// Marks a queued job whose process could not be started as stopped.
+// Thread safe
+func (job *Job) fail(err error) {
+	job.mutex.Lock()
+	defer job.mutex.Unlock()
+	if job.isStopped() {
+		return
+	}
+	job.err = err
+	job.finishQueued()
+}
+
+// Marks a job that never started as stopped.
+// NOT thread safe
+func (job *Job) finishQueued() {
+	job.requestStop()
+	job.Stopped = time.Now()
+	job.logs.close()
+	close(job.killedSignal)
+}
+
+// Starts a new process of the job as its current attempt.
+// Stages of a pipeline are started in the process group and the cgroup of the first stage.
+// NOT thread safe
+func (job *Job) spawn() error {
+	spec := job.Spec
+	cmd, err := job.command(spec.Isolation, spec.Command)
+	if err != nil {
+		return err
+	}
+	stages := make([]*exec.Cmd, 0, len(spec.Pipeline))
+	for _, command := range spec.Pipeline {
+		// pipelines are never isolated
+		stage, err := job.command(Isolation{}, command)
+		if err != nil {
+			return err
+		}
+		stages = append(stages, stage)
+	}
+	var cgroup *jobCgroup
+	if job.slice != nil {
+		cgroup, err = newJobGroup(job.slice, job.ID, job.Limits, job.config.IO)
+		if err != nil {
+			return err
+		}
+	}
+	var cgroupDir *os.File
 	if cgroup != nil {
-		err = cgroup.AddProc(uint64(cmd.Process.Pid))
+		cgroupDir, err = cloneIntoCgroup(cmd, cgroup)
+		if err != nil {
+			deleteCgroup(cgroup)
+			return err
+		}
+		for _, stage := range stages {
+			stage.SysProcAttr.CgroupFD = cmd.SysProcAttr.CgroupFD
+			stage.SysProcAttr.UseCgroupFD = cmd.SysProcAttr.UseCgroupFD
+		}
+	}
+	stdio, err := newStdio(cmd, spec, job.ID)
+	if err == nil {
+		err = stdio.connect(cmd, stages)
+		if err != nil {
+			stdio.close()
+		}
+	}
+	if err != nil {
+		// closing is safe also when nil
+		cgroupDir.Close()
+		deleteCgroup(cgroup)
+		return err
+	}
+	// the job and its children can be signalled together,
+	// a new session started for a terminal is also a new process group
+	cmd.SysProcAttr.Setpgid = !cmd.SysProcAttr.Setsid
+
+	err = cmd.Start()
+	if err == nil {
+		err = startStages(cmd, stages)
+	}
+	stdio.closeChild()
+	cgroupDir.Close()
+	if err != nil {
+		stdio.close()
+		deleteCgroup(cgroup)
+		if cgroupDir != nil && cloneIntoCgroupUnsupported(err) {
+			// a command cannot be started twice, start over
+			return job.spawn()
+		}
+		return err
+	}
+	if cgroup != nil && cgroupDir == nil {
+		// started outside of the cgroup
+		for _, c := range append([]*exec.Cmd{cmd}, stages...) {
+			err = cgroup.AddProc(uint64(c.Process.Pid))
+			if err != nil {
+				break
+			}
+		}
 		if err != nil {
 			// cleanup
-			cmd.Process.Kill()
-			stderr.Close()
-			stdout.Close()
-			return nil, err
+			signalGroup(cmd.Process.Pid, syscall.SIGKILL)
+			cmd.Wait()
+			for _, stage := range stages {
+				stage.Wait()
+			}
+			stdio.close()
+			deleteCgroup(cgroup)
+			return err
 		}
 	}
-	id := JobID(uuid.New().String())
-	j := &Job{
-		ID:           id,
-		cmd:          cmd,
-		Started:      time.Now(),
-		Command:      command,
-		logs:         newLogs(stdout, stderr, id),
-		killedSignal: make(chan struct{}),
+	job.cmd = cmd
+	job.stages = stages
+	job.cgroup = cgroup
+	job.attemptStarted = time.Now()
+	job.attemptFirstLog = job.logs.size()
+	job.stdinMutex.Lock()
+	job.stdin = stdio.stdin
+	job.stdinMutex.Unlock()
+	if stdio.terminal != nil {
+		job.terminal = stdio.terminal
 	}
-	go j.wait()
-	return j, nil
+	job.outputs = stdio.start(job.logs)
+	return nil
+}
+
+// Creates a process of the command with the environment, working directory and user of the job.
+// NOT thread safe
+func (job *Job) command(isolation Isolation, command []string) (*exec.Cmd, error) {
+	spec := job.Spec
+	env := spec.environ(job.config.EnvAllowlist)
+	// fails early, before any process starts
+	path, err := lookPath(command[0], env, spec.Dir)
+	if err != nil {
+		return nil, err
+	}
+	cmd := isolation.command(path, command, spec.User)
+	cmd.Env = env
+	cmd.Dir = spec.Dir
+	cmd.SysProcAttr = &syscall.SysProcAttr{Cloneflags: isolation.cloneflags()}
+	if spec.User != nil && !isolation.Namespaces {
+		// init of an isolated job needs the privileges to prepare the namespaces and switches the user itself
+		cmd.SysProcAttr.Credential = spec.User.credential()
+	}
+	return cmd, nil
 }
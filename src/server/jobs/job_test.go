@@ -1,6 +1,10 @@
 package jobs
 
 import (
+	"errors"
+	"os"
+	"strconv"
+	"syscall"
 	"testing"
 	"time"
 
@@ -8,10 +12,10 @@ import (
 )
 
 func TestJobCreateStop(t *testing.T) {
-	js, err := newJob([]string{"sleep", "10000"}, nil)
+	js, err := newJob(Spec{Command: []string{"sleep", "10000"}}, Config{}, nil)
 	assert.NoError(t, err)
 	stopTime := time.Now()
-	err = js.stop()
+	err = js.stop(StopOptions{})
 	assert.NoError(t, err)
 	stoppedTime := time.Now()
 	assert.Less(t, stoppedTime, stopTime.Add(time.Second))
@@ -19,24 +23,228 @@ func TestJobCreateStop(t *testing.T) {
 }
 
 func TestJobStatus(t *testing.T) {
-	js, err := newJob([]string{"sleep", "10"}, nil)
+	js, err := newJob(Spec{Command: []string{"sleep", "10"}}, Config{}, nil)
 	defer js.kill()
 	assert.NoError(t, err)
 
 	assert.NotNil(t, js)
 	status := js.Status()
 	assert.Equal(t, js.ID, status.ID)
-	assert.Equal(t, js.Command, status.Command)
+	assert.Equal(t, js.Spec, status.Spec)
 	assert.Equal(t, js.Started, status.Started)
 	assert.Nil(t, status.Stopped)
 	assert.NotNil(t, status.Pending)
 
-	err = js.stop()
+	err = js.stop(StopOptions{})
 	assert.NoError(t, err)
 	status = js.Status()
 	assert.Equal(t, js.ID, status.ID)
-	assert.Equal(t, js.Command, status.Command)
+	assert.Equal(t, js.Spec, status.Spec)
 	assert.Equal(t, js.Started, status.Started)
 	assert.NotNil(t, status.Stopped)
 	assert.Nil(t, status.Pending)
 }
+
+func TestJobEnvironment(t *testing.T) {
+	t.Setenv("TELEPORT_ALLOWED", "yes")
+	t.Setenv("TELEPORT_SECRET", "no")
+	config := Config{EnvAllowlist: []string{"TELEPORT_ALLOWED"}}
+	spec := Spec{
+		Command: []string{"env"},
+		Env:     map[string]string{"GOFLAGS": "-mod=mod"},
+	}
+	j, err := newJob(spec, config, nil)
+	assert.NoError(t, err)
+	defer j.stop(StopOptions{})
+	assert.ElementsMatch(t, []string{"GOFLAGS=-mod=mod", "TELEPORT_ALLOWED=yes"}, allLines(j))
+}
+
+func TestJobCleanEnvironment(t *testing.T) {
+	t.Setenv("TELEPORT_ALLOWED", "yes")
+	config := Config{EnvAllowlist: []string{"TELEPORT_ALLOWED"}}
+	spec := Spec{
+		Command:  []string{"env"},
+		Env:      map[string]string{"HOME": "/tmp"},
+		CleanEnv: true,
+	}
+	j, err := newJob(spec, config, nil)
+	assert.NoError(t, err)
+	defer j.stop(StopOptions{})
+	assert.Equal(t, []string{"HOME=/tmp"}, allLines(j))
+}
+
+func TestJobWorkingDirectory(t *testing.T) {
+	dir := t.TempDir()
+	j, err := newJob(Spec{Command: []string{"pwd"}, Dir: dir}, Config{}, nil)
+	assert.NoError(t, err)
+	defer j.stop(StopOptions{})
+	assert.Equal(t, []string{dir}, allLines(j))
+}
+
+func TestInvalidSpec(t *testing.T) {
+	_, err := newJob(Spec{}, Config{}, nil)
+	assert.ErrorIs(t, err, ErrInvalidSpec)
+	_, err = newJob(Spec{Command: []string{"env"}, Env: map[string]string{"A=B": "C"}}, Config{}, nil)
+	assert.ErrorIs(t, err, ErrInvalidSpec)
+}
+
+// Reads all lines of output until the job closes its output
+func allLines(j *Job) []string {
+	lines := []string{}
+	for {
+		logs := j.GetLogs(len(lines), 10)
+		if len(logs) == 0 {
+			return lines
+		}
+		for _, entry := range logs {
+			lines = append(lines, entry.Line)
+		}
+	}
+}
+
+func TestJobStdin(t *testing.T) {
+	j, err := newJob(Spec{Command: []string{"cat"}, Stdin: true}, Config{}, nil)
+	assert.NoError(t, err)
+	defer j.stop(StopOptions{})
+	assert.NoError(t, j.WriteStdin([]byte("first\nsec")))
+	assert.NoError(t, j.WriteStdin([]byte("ond\n")))
+	assert.NoError(t, j.CloseStdin())
+	assert.Equal(t, []string{"first", "second"}, allLines(j))
+	<-j.killedSignal
+	assert.Equal(t, 0, j.Status().Stopped.ExitCode)
+	assert.ErrorIs(t, j.WriteStdin([]byte("late")), ErrNoStdin)
+}
+
+func TestJobWithoutStdin(t *testing.T) {
+	j, err := newJob(Spec{Command: []string{"cat"}}, Config{}, nil)
+	assert.NoError(t, err)
+	defer j.stop(StopOptions{})
+	assert.ErrorIs(t, j.WriteStdin([]byte("data")), ErrNoStdin)
+	assert.ErrorIs(t, j.CloseStdin(), ErrNoStdin)
+	// stdin is empty, so cat finishes immediately
+	assert.Empty(t, allLines(j))
+}
+
+func TestJobGracefulStop(t *testing.T) {
+	j, err := newJob(Spec{Command: []string{"sleep", "10"}}, Config{}, nil)
+	assert.NoError(t, err)
+	err = j.stop(StopOptions{Signal: syscall.SIGINT, GracePeriod: time.Second})
+	assert.NoError(t, err)
+	status := j.Status()
+	assert.Equal(t, TerminationSignal, status.Stopped.Termination)
+	assert.Equal(t, -1, status.Stopped.ExitCode)
+}
+
+func TestJobStopEscalation(t *testing.T) {
+	// ignores SIGTERM
+	cmd := []string{"bash", "-c", "trap '' TERM; echo ready; while true; do sleep 0.1; done"}
+	j, err := newJob(Spec{Command: cmd}, Config{}, nil)
+	assert.NoError(t, err)
+	// make sure the trap is set
+	j.GetLogs(0, 1)
+	stopTime := time.Now()
+	err = j.stop(StopOptions{GracePeriod: 200 * time.Millisecond})
+	assert.NoError(t, err)
+	assert.GreaterOrEqual(t, time.Since(stopTime), 200*time.Millisecond)
+	assert.Equal(t, TerminationKill, j.Status().Stopped.Termination)
+}
+
+func TestJobExitTermination(t *testing.T) {
+	j, err := newJob(Spec{Command: []string{"true"}}, Config{}, nil)
+	assert.NoError(t, err)
+	<-j.killedSignal
+	assert.NoError(t, j.stop(StopOptions{}))
+	assert.Equal(t, TerminationExit, j.Status().Stopped.Termination)
+}
+
+func TestJobSignal(t *testing.T) {
+	cmd := []string{"bash", "-c", "trap 'echo reloading' HUP; echo ready; while true; do sleep 0.1; done"}
+	j, err := newJob(Spec{Command: cmd}, Config{}, nil)
+	assert.NoError(t, err)
+	defer j.stop(StopOptions{})
+	j.GetLogs(0, 1)
+	assert.NoError(t, j.Signal(syscall.SIGHUP, false))
+	assert.Equal(t, "reloading", j.GetLogs(1, 1)[0].Line)
+	assert.False(t, j.IsStopped())
+}
+
+func TestJobSignalGroup(t *testing.T) {
+	// the background child keeps the output open until it gets the signal too
+	cmd := []string{"bash", "-c", "trap 'echo trapped' USR1; sleep 10 & sleep 0.1; echo ready; wait; echo done"}
+	j, err := newJob(Spec{Command: cmd}, Config{}, nil)
+	assert.NoError(t, err)
+	defer j.stop(StopOptions{})
+	j.GetLogs(0, 1)
+	signalled := time.Now()
+	assert.NoError(t, j.Signal(syscall.SIGUSR1, true))
+	assert.Equal(t, []string{"ready", "trapped", "done"}, allLines(j))
+	assert.Less(t, time.Since(signalled), time.Second)
+	<-j.killedSignal
+	assert.Equal(t, 0, j.Status().Stopped.ExitCode)
+	assert.ErrorIs(t, j.Signal(syscall.SIGUSR1, true), ErrNotRunning)
+}
+
+func TestJobStopKillsProcessTree(t *testing.T) {
+	// the background child keeps the output open
+	cmd := []string{"bash", "-c", "sleep 1000 & echo $!; wait"}
+	j, err := newJob(Spec{Command: cmd}, Config{}, nil)
+	assert.NoError(t, err)
+	child, err := strconv.Atoi(j.GetLogs(0, 1)[0].Line)
+	assert.NoError(t, err)
+	assert.NoError(t, j.stop(StopOptions{GracePeriod: time.Second}))
+	// logs are complete, nobody holds the output any more
+	assert.Empty(t, j.GetLogs(1, 1))
+	// the child may stay a zombie until its new parent reaps it
+	stat, err := os.ReadFile("/proc/" + strconv.Itoa(child) + "/stat")
+	if err == nil {
+		state, _, _ := parseStat(string(stat))
+		assert.Equal(t, "Z", state)
+	}
+}
+
+func TestJobWaitsForProcessTree(t *testing.T) {
+	// the direct child exits immediately, its own child keeps running
+	cmd := []string{"bash", "-c", "sleep 0.5 >/dev/null 2>&1 &"}
+	j, err := newJob(Spec{Command: cmd}, Config{}, nil)
+	assert.NoError(t, err)
+	defer j.stop(StopOptions{})
+	time.Sleep(200 * time.Millisecond)
+	assert.False(t, j.IsStopped())
+	assert.NotNil(t, j.Status().Pending)
+	<-j.killedSignal
+	assert.GreaterOrEqual(t, j.Status().Stopped.Stopped.Sub(j.Started), 500*time.Millisecond)
+}
+
+func TestJobStdinNotRead(t *testing.T) {
+	// a descendant outside of the process group keeps the input open without reading it
+	j, err := newJob(Spec{Command: []string{"sh", "-c", "exec 3<&0; setsid sleep 3 <&3 3<&- & sleep 0.2"}, Stdin: true}, Config{}, nil)
+	assert.NoError(t, err)
+	defer j.stop(StopOptions{})
+	written := make(chan error)
+	go func() {
+		// more than the pipe buffer
+		written <- j.WriteStdin(make([]byte, 1<<20))
+	}()
+	select {
+	case <-j.killedSignal:
+	case <-time.After(2 * time.Second):
+		t.Fatal("the job did not finish")
+	}
+	assert.ErrorIs(t, <-written, ErrNoStdin)
+}
+
+func TestJobSignalAfterMainExited(t *testing.T) {
+	// the background child keeps the job running after the main process exits
+	j, err := newJob(Spec{Command: []string{"sh", "-c", "sleep 10 & exit 0"}}, Config{}, nil)
+	assert.NoError(t, err)
+	defer j.stop(StopOptions{})
+	// the main process is signalled until it is reaped
+	assert.Eventually(t, func() bool {
+		return errors.Is(j.Signal(syscall.SIGHUP, false), ErrMainExited)
+	}, 5*time.Second, 10*time.Millisecond)
+	assert.False(t, j.IsStopped())
+	// the group still reaches the descendants
+	assert.NoError(t, j.Signal(syscall.SIGKILL, true))
+	<-j.killedSignal
+	assert.ErrorIs(t, j.Signal(syscall.SIGHUP, false), ErrNotRunning)
+}
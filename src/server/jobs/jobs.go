@@ -4,13 +4,15 @@ package jobs
 import (
 	"errors"
 	"log"
+	"slices"
 	"sync"
-
-	"github.com/containerd/cgroups/v3/cgroup2"
 )
 
 var ErrNotFound = errors.New("Job was not found")
 
+// Only finished jobs can be removed
+var ErrRunning = errors.New("Job is still running")
+
 // Type safe Job identifier
 // Actually UUID
 type JobID string
@@ -18,24 +20,178 @@ type JobID string
 // Thread safe collection of jobs
 type Jobs struct {
 	pending map[JobID]*Job
-	cgroup  *cgroup2.Manager
+	slice   *Slice
+	config  Config
 	mutex   sync.Mutex
+	// jobs waiting for their start, ordered by priority and then by submission
+	queue []*Job
+	// number of started jobs that did not finish yet, in total and per owner
+	running        int
+	runningByOwner map[string]int
+	// closed when the collection shuts down, stops removing finished jobs
+	closed    chan struct{}
+	closeOnce sync.Once
+	// keeps records in the store in the order of changes of the jobs, locked before the collection
+	storeMutex sync.Mutex
 }
 
-// Create creates a new job with the given command.
+// Create creates a new job with the given specification.
 // Adds it to the internal collection.
-func (jobs *Jobs) Create(command []string) (*Job, error) {
-	j, err := newJob(command, jobs.cgroup)
+// The job starts right away if the limits of running jobs allow it, otherwise it is queued.
+func (jobs *Jobs) Create(spec Spec) (*Job, error) {
+	j, err := prepareJob(spec, jobs.config, jobs.slice)
 	if err != nil {
 		log.Println("Could not create a job", err)
 		return nil, err
 	}
+	j.jobs = jobs
+	jobs.mutex.Lock()
+	if !jobs.available(j.Spec.Owner) {
+		log.Println("Queueing job", j.ID)
+		jobs.pending[j.ID] = j
+		jobs.enqueue(j)
+		jobs.mutex.Unlock()
+		jobs.save(j)
+		return j, nil
+	}
+	jobs.reserve(j)
+	jobs.mutex.Unlock()
+	err = j.start()
+	if err != nil {
+		log.Println("Could not create a job", err)
+		jobs.release(j)
+		return nil, err
+	}
 	jobs.mutex.Lock()
-	defer jobs.mutex.Unlock()
 	jobs.pending[j.ID] = j
+	jobs.mutex.Unlock()
+	jobs.save(j)
+	go jobs.track(j)
 	return j, nil
 }
 
+// Returns true if another job of the owner may start.
+// NOT thread safe
+func (jobs *Jobs) available(owner string) bool {
+	if jobs.config.MaxRunning != 0 && jobs.running >= jobs.config.MaxRunning {
+		return false
+	}
+	if jobs.config.MaxRunningPerOwner != 0 && jobs.runningByOwner[owner] >= jobs.config.MaxRunningPerOwner {
+		return false
+	}
+	return true
+}
+
+// Counts the job as running before its process starts.
+// NOT thread safe
+func (jobs *Jobs) reserve(j *Job) {
+	jobs.running++
+	jobs.runningByOwner[j.Spec.Owner]++
+}
+
+// Stops counting the job as running and starts queued jobs in its place.
+// Thread safe
+func (jobs *Jobs) release(j *Job) {
+	jobs.mutex.Lock()
+	jobs.running--
+	jobs.runningByOwner[j.Spec.Owner]--
+	if jobs.runningByOwner[j.Spec.Owner] == 0 {
+		delete(jobs.runningByOwner, j.Spec.Owner)
+	}
+	next := jobs.dequeue()
+	jobs.mutex.Unlock()
+	jobs.startQueued(next)
+}
+
+// Waits for a started job to finish, records its result and releases its place
+func (jobs *Jobs) track(j *Job) {
+	<-j.killedSignal
+	jobs.save(j)
+	jobs.release(j)
+}
+
+// Adds the job to the queue behind all jobs with the same or a higher priority.
+// NOT thread safe
+func (jobs *Jobs) enqueue(j *Job) {
+	i := slices.IndexFunc(jobs.queue, func(queued *Job) bool { return queued.Spec.Priority < j.Spec.Priority })
+	if i < 0 {
+		i = len(jobs.queue)
+	}
+	jobs.queue = slices.Insert(jobs.queue, i, j)
+}
+
+// Takes the jobs that may start now out of the queue and reserves their places.
+// Jobs of owners that reached their limit let the following jobs of other owners pass.
+// NOT thread safe
+func (jobs *Jobs) dequeue() []*Job {
+	var result []*Job
+	for i := 0; i < len(jobs.queue); {
+		j := jobs.queue[i]
+		if !jobs.available(j.Spec.Owner) {
+			if jobs.config.MaxRunning != 0 && jobs.running >= jobs.config.MaxRunning {
+				break
+			}
+			i++
+			continue
+		}
+		jobs.queue = slices.Delete(jobs.queue, i, i+1)
+		jobs.reserve(j)
+		result = append(result, j)
+	}
+	return result
+}
+
+// Starts processes of jobs taken out of the queue.
+// Jobs that cannot be started are marked as failed.
+func (jobs *Jobs) startQueued(queued []*Job) {
+	for _, j := range queued {
+		log.Println("Starting queued job", j.ID)
+		err := j.start()
+		if err != nil {
+			if err != ErrNotRunning {
+				log.Println("Could not start queued job", j.ID, err)
+				j.fail(err)
+			}
+			jobs.save(j)
+			jobs.release(j)
+			continue
+		}
+		jobs.save(j)
+		go jobs.track(j)
+	}
+}
+
+// Returns the number of jobs that leave the queue before the given one, -1 if the job is not queued.
+func (jobs *Jobs) position(j *Job) int {
+	jobs.mutex.Lock()
+	defer jobs.mutex.Unlock()
+	return slices.Index(jobs.queue, j)
+}
+
+// Removes the job from the queue if it is still there.
+func (jobs *Jobs) cancel(j *Job) {
+	jobs.mutex.Lock()
+	defer jobs.mutex.Unlock()
+	i := slices.Index(jobs.queue, j)
+	if i >= 0 {
+		jobs.queue = slices.Delete(jobs.queue, i, i+1)
+	}
+}
+
+// Checks if a job with the given specification could be created, does not start it.
+func (jobs *Jobs) check(spec Spec) error {
+	err := spec.validate()
+	if err != nil {
+		return err
+	}
+	_, err = jobs.config.limits(spec)
+	if err != nil {
+		return err
+	}
+	_, err = jobs.config.timeouts(spec)
+	return err
+}
+
 // Find returns a job by its ID.
 func (jobs *Jobs) Find(id JobID) *Job {
 	jobs.mutex.Lock()
@@ -44,20 +200,44 @@ func (jobs *Jobs) Find(id JobID) *Job {
 }
 
 // Stop stops a job by its ID.
-// Job is removed from the collection.
+// A queued job is canceled before it starts.
+// The job stays in the collection together with its logs until it is removed.
 // On success Job instance is returned and can be used to obtain job information.
-func (jobs *Jobs) Stop(id JobID) (*Job, error) {
+func (jobs *Jobs) Stop(id JobID, opts StopOptions) (*Job, error) {
 	job := jobs.Find(id)
 	if job == nil {
 		return nil, ErrNotFound
 	}
-	err := job.stop()
+	if opts.GracePeriod == 0 {
+		opts.GracePeriod = jobs.config.StopGracePeriod
+	}
+	jobs.cancel(job)
+	err := job.stop(opts)
 	if err != nil {
 		return nil, err
 	}
+	jobs.save(job)
+	return job, nil
+}
+
+// Remove removes a finished job by its ID together with its logs.
+// Returns ErrRunning if the job did not finish yet.
+// On success Job instance is returned and can be used to obtain job information.
+func (jobs *Jobs) Remove(id JobID) (*Job, error) {
+	jobs.storeMutex.Lock()
+	defer jobs.storeMutex.Unlock()
 	jobs.mutex.Lock()
 	defer jobs.mutex.Unlock()
+	job := jobs.pending[id]
+	if job == nil {
+		return nil, ErrNotFound
+	}
+	if !job.IsStopped() {
+		return nil, ErrRunning
+	}
 	delete(jobs.pending, id)
+	jobs.forget(id)
+	job.logs.release()
 	return job, nil
 }
 
@@ -72,24 +252,41 @@ func (jobs *Jobs) List() []*Job {
 	return result
 }
 
-// Kills all running processes.
-// Does not remove processes from the collection (cleaned by GC anyway).
+// Kills all running processes together with their descendants.
+// Does not remove processes from the collection (cleaned by GC anyway) and stops removing finished jobs.
 // Does not wait until processes fully complete.
 func (jobs *Jobs) KillAll() {
+	jobs.closeOnce.Do(func() { close(jobs.closed) })
 	jobs.mutex.Lock()
 	defer jobs.mutex.Unlock()
+	// queued jobs must not start any more
+	jobs.queue = nil
 	for _, job := range jobs.pending {
 		job.kill()
 	}
-	if jobs.cgroup != nil {
-		jobs.cgroup.DeleteSystemd()
+	if jobs.slice != nil {
+		// catches also processes that escaped their jobs
+		err := jobs.slice.kill()
+		if err != nil {
+			log.Println("Could not kill processes in the cgroup", err)
+		}
+		jobs.slice.delete()
 	}
 }
 
 // NewJobs creates a new collection of jobs.
-func NewJobs(cgroup *cgroup2.Manager) *Jobs {
-	return &Jobs{
-		pending: make(map[JobID]*Job),
-		cgroup:  cgroup,
+// Jobs run in their own cgroups inside of the slice, no cgroups are used if nil.
+// Finished jobs are removed in the background according to the retention policy of the configuration.
+func NewJobs(slice *Slice, config Config) *Jobs {
+	result := &Jobs{
+		pending:        make(map[JobID]*Job),
+		slice:          slice,
+		config:         config,
+		runningByOwner: make(map[string]int),
+		closed:         make(chan struct{}),
+	}
+	if config.Retention != (Retention{}) {
+		go result.collectPeriodically()
 	}
+	return result
 }
@@ -1,6 +1,8 @@
 package jobs
 
 import (
+	"slices"
+	"syscall"
 	"testing"
 	"time"
 
@@ -8,10 +10,10 @@ import (
 )
 
 func TestJobsFind(t *testing.T) {
-	js := NewJobs(nil)
+	js := NewJobs(nil, Config{})
 	assert.NotNil(t, js)
-	j1, err := js.Create([]string{"echo", "hello"})
-	defer j1.stop()
+	j1, err := js.Create(Spec{Command: []string{"echo", "hello"}})
+	defer j1.stop(StopOptions{})
 	assert.NoError(t, err)
 	assert.NotNil(t, j1)
 
@@ -20,42 +22,152 @@ func TestJobsFind(t *testing.T) {
 }
 
 func TestCreateInvalidJob(t *testing.T) {
-	js := NewJobs(nil)
+	js := NewJobs(nil, Config{})
 	assert.NotNil(t, js)
-	j, err := js.Create([]string{"barambaram"})
+	j, err := js.Create(Spec{Command: []string{"barambaram"}})
 	assert.Nil(t, j)
 	assert.Error(t, err)
 	assert.Equal(t, len(js.List()), 0)
 }
 
 func TestStopJobByID(t *testing.T) {
-	js := NewJobs(nil)
-	j, err := js.Create([]string{"sleep", "10"})
-	defer j.stop()
+	js := NewJobs(nil, Config{})
+	j, err := js.Create(Spec{Command: []string{"sleep", "10"}})
+	defer j.stop(StopOptions{})
 	assert.NoError(t, err)
 	assert.NotNil(t, j)
-	stopped, err := js.Stop(j.ID)
+	stopped, err := js.Stop(j.ID, StopOptions{})
 	assert.Equal(t, j, stopped)
 	assert.NoError(t, err)
-	assert.Equal(t, len(js.List()), 0)
+	// the stopped job is kept until it is removed
+	assert.Equal(t, len(js.List()), 1)
+	assert.True(t, j.IsStopped())
+}
+
+func TestRemoveJob(t *testing.T) {
+	js := NewJobs(nil, Config{})
+	defer js.KillAll()
+	j, err := js.Create(Spec{Command: []string{"sleep", "10"}})
+	assert.NoError(t, err)
+	_, err = js.Remove(j.ID)
+	assert.ErrorIs(t, err, ErrRunning)
+	assert.Same(t, j, js.Find(j.ID))
+
+	_, err = js.Stop(j.ID, StopOptions{})
+	assert.NoError(t, err)
+	removed, err := js.Remove(j.ID)
+	assert.NoError(t, err)
+	assert.Same(t, j, removed)
+	assert.Nil(t, js.Find(j.ID))
+	_, err = js.Remove(j.ID)
+	assert.ErrorIs(t, err, ErrNotFound)
 }
 
 func TestListKillAll(t *testing.T) {
-	js := NewJobs(nil)
-	j1, err := js.Create([]string{"sleep", "10"})
-	defer j1.stop()
+	js := NewJobs(nil, Config{})
+	j1, err := js.Create(Spec{Command: []string{"sleep", "10"}})
+	defer j1.stop(StopOptions{})
 	assert.NoError(t, err)
-	j2, err := js.Create([]string{"sleep", "10"})
-	defer j2.stop()
+	j2, err := js.Create(Spec{Command: []string{"sleep", "10"}})
+	defer j2.stop(StopOptions{})
 	assert.NoError(t, err)
 
 	// list
 	pending := js.List()
-	assert.Contains(t, pending, j1)
-	assert.Contains(t, pending, j1)
+	// compared by identity, deep comparison would read jobs while they change
+	assert.True(t, slices.Contains(pending, j1))
+	assert.True(t, slices.Contains(pending, j2))
 
 	js.KillAll()
 	time.Sleep(time.Millisecond * 100)
 	assert.True(t, j1.IsStopped())
 	assert.True(t, j2.IsStopped())
 }
+
+func TestJobsQueue(t *testing.T) {
+	js := NewJobs(nil, Config{MaxRunning: 1})
+	defer js.KillAll()
+	j1, err := js.Create(Spec{Command: []string{"sleep", "10"}})
+	assert.NoError(t, err)
+	j2, err := js.Create(Spec{Command: []string{"echo", "low"}})
+	assert.NoError(t, err)
+	j3, err := js.Create(Spec{Command: []string{"echo", "high"}, Priority: 1})
+	assert.NoError(t, err)
+	assert.False(t, j1.IsQueued())
+	assert.True(t, j2.IsQueued())
+	// the job with a higher priority goes first
+	assert.Equal(t, 1, j2.Status().Queued.Position)
+	assert.Equal(t, 0, j3.Status().Queued.Position)
+	assert.True(t, j2.Status().Started.IsZero())
+	assert.ErrorIs(t, j2.Signal(syscall.SIGHUP, false), ErrQueued)
+
+	_, err = js.Stop(j1.ID, StopOptions{})
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"high"}, allLines(j3))
+	assert.Equal(t, []string{"low"}, allLines(j2))
+	assert.True(t, j2.Status().Started.After(j3.Status().Started))
+}
+
+func TestJobsQueuePerOwner(t *testing.T) {
+	js := NewJobs(nil, Config{MaxRunningPerOwner: 1})
+	defer js.KillAll()
+	j1, err := js.Create(Spec{Command: []string{"sleep", "10"}, Owner: "ci"})
+	assert.NoError(t, err)
+	j2, err := js.Create(Spec{Command: []string{"sleep", "10"}, Owner: "ci"})
+	assert.NoError(t, err)
+	// other owners are not held back
+	j3, err := js.Create(Spec{Command: []string{"sleep", "10"}, Owner: "admin"})
+	assert.NoError(t, err)
+	assert.False(t, j1.IsQueued())
+	assert.True(t, j2.IsQueued())
+	assert.False(t, j3.IsQueued())
+
+	_, err = js.Stop(j1.ID, StopOptions{})
+	assert.NoError(t, err)
+	// the place is released in the background
+	assert.Eventually(t, func() bool { return !j2.IsQueued() }, time.Second, 10*time.Millisecond)
+	assert.NotNil(t, j2.Status().Pending)
+}
+
+func TestJobsCancelQueued(t *testing.T) {
+	js := NewJobs(nil, Config{MaxRunning: 1})
+	defer js.KillAll()
+	j1, err := js.Create(Spec{Command: []string{"sleep", "10"}})
+	assert.NoError(t, err)
+	j2, err := js.Create(Spec{Command: []string{"echo", "never"}})
+	assert.NoError(t, err)
+
+	stopped, err := js.Stop(j2.ID, StopOptions{})
+	assert.NoError(t, err)
+	status := stopped.Status()
+	if assert.NotNil(t, status.Stopped) {
+		assert.Equal(t, TerminationCancel, status.Stopped.Termination)
+		assert.Equal(t, -1, status.Stopped.ExitCode)
+	}
+	assert.Empty(t, allLines(j2))
+
+	// the canceled job does not take the place of the running one
+	_, err = js.Stop(j1.ID, StopOptions{})
+	assert.NoError(t, err)
+	assert.True(t, j2.Status().Started.IsZero())
+}
+
+func TestJobsQueuedStartFailure(t *testing.T) {
+	js := NewJobs(nil, Config{MaxRunning: 1})
+	defer js.KillAll()
+	j1, err := js.Create(Spec{Command: []string{"sleep", "10"}})
+	assert.NoError(t, err)
+	// fails only once it leaves the queue
+	j2, err := js.Create(Spec{Command: []string{"barambaram"}})
+	assert.NoError(t, err)
+	j3, err := js.Create(Spec{Command: []string{"echo", "next"}})
+	assert.NoError(t, err)
+
+	_, err = js.Stop(j1.ID, StopOptions{})
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"next"}, allLines(j3))
+	status := j2.Status()
+	if assert.NotNil(t, status.Stopped) {
+		assert.Contains(t, status.Stopped.Error, "barambaram")
+	}
+}
@@ -0,0 +1,153 @@
+// Resource limits of jobs
+package jobs
+
+import (
+	"errors"
+	"fmt"
+	"math"
+	"strconv"
+	"strings"
+)
+
+// The requested limit class is not configured on the server
+var ErrUnknownLimitClass = errors.New("Unknown limit class")
+
+// The requested limits are above the server maximums
+var ErrLimitsExceeded = errors.New("Limits exceed the server maximums")
+
+// Resource limits of a single job, zero means unlimited
+type Limits struct {
+	// Maximal memory usage in bytes
+	Memory int64
+	// Share of the CPU time as a number of CPUs, 0.5 is a half of a single CPU
+	CPUs float64
+	// Maximal number of processes and threads
+	Pids int64
+}
+
+// Limit classes available if nothing else is configured
+var DefaultLimitClasses = map[string]Limits{
+	"small": {Memory: 64 << 20, CPUs: 0.5, Pids: 64},
+	"large": {Memory: 1 << 30, CPUs: 2, Pids: 1024},
+}
+
+// Class used for jobs that do not request any if nothing else is configured
+const DefaultLimitClass = "small"
+
+// Maximal limits a job can request if nothing else is configured
+var DefaultMaxLimits = Limits{Memory: 4 << 30, CPUs: 4, Pids: 4096}
+
+// Limits of a job with the given specification.
+// The class provides the base limits, explicitly requested limits override them.
+// Limits of the class are capped at the maximums, explicit limits above the maximums are rejected.
+func (config Config) limits(spec Spec) (Limits, error) {
+	requested := spec.Limits
+	if requested.Memory < 0 || requested.CPUs < 0 || !finite(requested.CPUs) || requested.Pids < 0 {
+		return Limits{}, ErrInvalidSpec
+	}
+	max := config.MaxLimits
+	if exceeds(requested.Memory, max.Memory) || exceeds(requested.CPUs, max.CPUs) || exceeds(requested.Pids, max.Pids) {
+		return Limits{}, ErrLimitsExceeded
+	}
+	class := spec.LimitClass
+	if class == "" {
+		class = config.DefaultLimitClass
+	}
+	var result Limits
+	if class != "" {
+		var ok bool
+		result, ok = config.LimitClasses[class]
+		if !ok {
+			return Limits{}, ErrUnknownLimitClass
+		}
+	}
+	result.Memory = limit(requested.Memory, result.Memory, max.Memory)
+	result.CPUs = limit(requested.CPUs, result.CPUs, max.CPUs)
+	result.Pids = limit(requested.Pids, result.Pids, max.Pids)
+	return result, nil
+}
+
+// Returns true if the value is neither NaN nor infinite, those pass every comparison with a maximum
+func finite(value float64) bool {
+	return !math.IsNaN(value) && !math.IsInf(value, 0)
+}
+
+// Returns true if the value is above the maximum, zero maximum means unlimited
+func exceeds[T ~int64 | float64](value, max T) bool {
+	return max != 0 && value > max
+}
+
+// Chooses a single limit - the requested one, otherwise the one from the class, capped at the maximum
+func limit[T ~int64 | float64](requested, class, max T) T {
+	if requested != 0 {
+		return requested
+	}
+	// unlimited class is unlimited only up to the maximum
+	if class == 0 || exceeds(class, max) {
+		return max
+	}
+	return class
+}
+
+// Parses limits in the form of "memory=64M,cpus=0.5,pids=100", missing limits are zero.
+// Memory accepts K, M and G suffixes.
+func ParseLimits(text string) (Limits, error) {
+	var result Limits
+	if text == "" {
+		return result, nil
+	}
+	for _, item := range strings.Split(text, ",") {
+		name, value, ok := strings.Cut(item, "=")
+		if !ok {
+			return Limits{}, fmt.Errorf("invalid limit %q", item)
+		}
+		var err error
+		switch strings.TrimSpace(name) {
+		case "memory":
+			result.Memory, err = parseBytes(value)
+		case "cpus":
+			result.CPUs, err = strconv.ParseFloat(value, 64)
+			if err == nil && (result.CPUs <= 0 || !finite(result.CPUs)) {
+				err = errors.New("not a positive finite number")
+			}
+		case "pids":
+			result.Pids, err = strconv.ParseInt(value, 10, 64)
+		default:
+			return Limits{}, fmt.Errorf("unknown limit %q", name)
+		}
+		if err != nil {
+			return Limits{}, fmt.Errorf("invalid value of limit %q: %w", name, err)
+		}
+	}
+	if result.Memory < 0 || result.CPUs < 0 || result.Pids < 0 {
+		return Limits{}, errors.New("limits cannot be negative")
+	}
+	return result, nil
+}
+
+// Parses a non-negative number of bytes with an optional K, M or G suffix
+func parseBytes(text string) (int64, error) {
+	multiplier := int64(1)
+	switch {
+	case strings.HasSuffix(text, "K"):
+		multiplier = 1 << 10
+	case strings.HasSuffix(text, "M"):
+		multiplier = 1 << 20
+	case strings.HasSuffix(text, "G"):
+		multiplier = 1 << 30
+	}
+	if multiplier != 1 {
+		text = text[:len(text)-1]
+	}
+	value, err := strconv.ParseInt(text, 10, 64)
+	if err != nil {
+		return 0, err
+	}
+	if value < 0 {
+		return 0, errors.New("negative number of bytes")
+	}
+	if value > math.MaxInt64/multiplier {
+		return 0, errors.New("number of bytes is too large")
+	}
+	return value * multiplier, nil
+}
@@ -0,0 +1,85 @@
+package jobs
+
+import (
+	"math"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestLimitsResolution(t *testing.T) {
+	config := Config{
+		LimitClasses: map[string]Limits{
+			"small": {Memory: 64 << 20, CPUs: 0.5},
+			"huge":  {Memory: 16 << 30, CPUs: 8, Pids: 10000},
+		},
+		DefaultLimitClass: "small",
+		MaxLimits:         Limits{Memory: 4 << 30, CPUs: 4, Pids: 4096},
+	}
+	cmd := []string{"true"}
+
+	// default class, unlimited pids capped at the maximum
+	limits, err := config.limits(Spec{Command: cmd})
+	assert.NoError(t, err)
+	assert.Equal(t, Limits{Memory: 64 << 20, CPUs: 0.5, Pids: 4096}, limits)
+
+	// class capped at the maximums
+	limits, err = config.limits(Spec{Command: cmd, LimitClass: "huge"})
+	assert.NoError(t, err)
+	assert.Equal(t, config.MaxLimits, limits)
+
+	// explicit limits override the class
+	limits, err = config.limits(Spec{Command: cmd, Limits: Limits{CPUs: 1, Pids: 10}})
+	assert.NoError(t, err)
+	assert.Equal(t, Limits{Memory: 64 << 20, CPUs: 1, Pids: 10}, limits)
+
+	_, err = config.limits(Spec{Command: cmd, LimitClass: "medium"})
+	assert.ErrorIs(t, err, ErrUnknownLimitClass)
+	_, err = config.limits(Spec{Command: cmd, Limits: Limits{Memory: 8 << 30}})
+	assert.ErrorIs(t, err, ErrLimitsExceeded)
+	_, err = config.limits(Spec{Command: cmd, Limits: Limits{Pids: -1}})
+	assert.ErrorIs(t, err, ErrInvalidSpec)
+	for _, cpus := range []float64{math.NaN(), math.Inf(1), math.Inf(-1)} {
+		_, err = config.limits(Spec{Command: cmd, Limits: Limits{CPUs: cpus}})
+		assert.ErrorIs(t, err, ErrInvalidSpec)
+		// also without maximums
+		_, err = Config{}.limits(Spec{Command: cmd, Limits: Limits{CPUs: cpus}})
+		assert.ErrorIs(t, err, ErrInvalidSpec)
+	}
+
+	// nothing configured
+	limits, err = Config{}.limits(Spec{Command: cmd})
+	assert.NoError(t, err)
+	assert.Equal(t, Limits{}, limits)
+}
+
+func TestParseLimits(t *testing.T) {
+	limits, err := ParseLimits("memory=64M,cpus=0.25,pids=100")
+	assert.NoError(t, err)
+	assert.Equal(t, Limits{Memory: 64 << 20, CPUs: 0.25, Pids: 100}, limits)
+
+	limits, err = ParseLimits("memory=2G")
+	assert.NoError(t, err)
+	assert.Equal(t, Limits{Memory: 2 << 30}, limits)
+
+	limits, err = ParseLimits("")
+	assert.NoError(t, err)
+	assert.Equal(t, Limits{}, limits)
+
+	for _, invalid := range []string{"memory", "disk=1G", "memory=1T", "cpus=many", "pids=-1", "cpus=NaN", "cpus=+Inf", "cpus=-Inf", "cpus=0", "cpus=-0.5", "memory=9999999999G", "memory=-1M", "memory=9223372036854775807K"} {
+		_, err = ParseLimits(invalid)
+		assert.Error(t, err, invalid)
+	}
+}
+
+func TestParseBytes(t *testing.T) {
+	for text, want := range map[string]int64{"0": 0, "1000": 1000, "4K": 4 << 10, "64M": 64 << 20, "8589934591G": 8589934591 << 30} {
+		value, err := parseBytes(text)
+		assert.NoError(t, err, text)
+		assert.Equal(t, want, value, text)
+	}
+	for _, invalid := range []string{"", "G", "1T", "-1", "-1K", "8589934592G", "9999999999G", "9223372036854775807K"} {
+		_, err := parseBytes(invalid)
+		assert.Error(t, err, invalid)
+	}
+}
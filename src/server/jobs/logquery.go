@@ -0,0 +1,148 @@
+// Selection of logs for readers - where reading starts, where it stops and which streams are read
+package jobs
+
+import (
+	"sort"
+	"time"
+)
+
+// Number of lines passed to a reader at once
+const readBatch = 10
+
+// Number of lines read at once while looking for the beginning of a tail
+const tailBatch = 1000
+
+// Logs of a job that are read, zero values select everything
+type LogQuery struct {
+	// Index of the first line
+	Start int
+	// Only the given number of the last selected lines produced before the query, all lines if zero
+	Tail int
+	// Only lines produced at or after the time, if not zero
+	Since time.Time
+	// Only lines produced at or before the time, if not zero
+	Until time.Time
+	// Waits for new lines until the job finishes, otherwise stops after the lines produced before the query
+	Follow bool
+	// Selected output streams, both if neither is set
+	Stdout bool
+	Stderr bool
+}
+
+// Returns true if the line comes from a selected stream
+func (query LogQuery) selects(entry LogEntry) bool {
+	if query.Stdout == query.Stderr {
+		return true
+	}
+	return entry.Stdout == query.Stdout
+}
+
+// ReadLogs passes logs selected by the query to send, one entry at a time, until the end of the selection.
+// Markers of dropped lines are passed regardless of the selected streams.
+// Returns the first error of send.
+// Thread safe
+func (job *Job) ReadLogs(query LogQuery, send func(LogEntry) error) error {
+	return job.logs.query(query, send)
+}
+
+// Implementation of ReadLogs.
+// Thread safe
+func (logs *logs) query(query LogQuery, send func(LogEntry) error) error {
+	end := -1
+	if !query.Follow {
+		end = logs.size()
+	}
+	position := max(query.Start, 0)
+	if !query.Since.IsZero() {
+		position = max(position, logs.search(func(entry LogEntry) bool {
+			return !entry.Timestamp.Before(query.Since)
+		}))
+	}
+	if query.Tail > 0 {
+		limit := logs.size()
+		if !query.Until.IsZero() {
+			limit = logs.search(func(entry LogEntry) bool {
+				return entry.Timestamp.After(query.Until)
+			})
+		}
+		position = max(position, logs.tailStart(limit, query.Tail, query.selects))
+	}
+	for end < 0 || position < end {
+		entries := logs.get(position, readBatch)
+		if len(entries) == 0 {
+			return nil
+		}
+		// a marker of dropped lines skips them
+		position = entries[len(entries)-1].Index + 1
+		for _, entry := range entries {
+			if entry.Dropped == 0 {
+				if end >= 0 && entry.Index >= end {
+					return nil
+				}
+				if !query.Until.IsZero() && entry.Timestamp.After(query.Until) {
+					return nil
+				}
+				if !query.selects(entry) {
+					continue
+				}
+			}
+			err := send(entry)
+			if err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// Index of the first line produced so far that meets the condition, the number of lines if there is none.
+// Lines are ordered by time, a condition on time that holds for a line holds also for all following lines.
+// Dropped lines do not meet the condition.
+// Thread safe
+func (logs *logs) search(condition func(LogEntry) bool) int {
+	return sort.Search(logs.size(), func(i int) bool {
+		entries := logs.get(i, 1)
+		return len(entries) == 1 && entries[0].Dropped == 0 && condition(entries[0])
+	})
+}
+
+// Index of the first of the last count selected lines before the end.
+// Dropped lines are not part of the tail, it starts after them.
+// Thread safe
+func (logs *logs) tailStart(end, count int, selected func(LogEntry) bool) int {
+	for end > 0 {
+		from := max(end-tailBatch, 0)
+		entries := logs.getRange(from, end)
+		for i := len(entries) - 1; i >= 0; i-- {
+			entry := entries[i]
+			if entry.Dropped > 0 {
+				return entry.Index + 1
+			}
+			if selected(entry) {
+				count--
+				if count == 0 {
+					return entry.Index
+				}
+			}
+		}
+		end = from
+	}
+	return 0
+}
+
+// Returns lines and markers of dropped lines from the start up to the end.
+// The end must not exceed the number of lines produced so far, lines are not waited for.
+// Thread safe
+func (logs *logs) getRange(start, end int) []LogEntry {
+	var result []LogEntry
+	for start < end {
+		// lines in segments are read one segment at a time
+		entries := logs.get(start, end-start)
+		if len(entries) == 0 {
+			break
+		}
+		result = append(result, entries...)
+		start = entries[len(entries)-1].Index + 1
+	}
+	return result
+}
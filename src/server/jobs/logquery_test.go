@@ -0,0 +1,104 @@
+package jobs
+
+import (
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+var queryTime = time.Date(2024, 1, 1, 12, 0, 0, 0, time.UTC)
+
+// Appends lines produced one per second, every third line goes to stderr
+func appendTimedLines(logs *logs, from, to int) {
+	for i := from; i < to; i++ {
+		logs.append(LogEntry{Line: fmt.Sprint(i), Stdout: i%3 != 0, Timestamp: queryTime.Add(time.Duration(i) * time.Second)})
+	}
+}
+
+// Returns lines selected by the query, markers of dropped lines as "-N"
+func queryLines(t *testing.T, logs *logs, query LogQuery) []string {
+	var result []string
+	err := logs.query(query, func(entry LogEntry) error {
+		if entry.Dropped > 0 {
+			result = append(result, fmt.Sprint(-entry.Dropped))
+		} else {
+			result = append(result, entry.Line)
+		}
+		return nil
+	})
+	assert.NoError(t, err)
+	return result
+}
+
+func TestQueryLogs(t *testing.T) {
+	storage, err := NewLogStorage(t.TempDir(), LogLimits{Memory: 100, Segment: 200})
+	assert.NoError(t, err)
+	logs := newLogs("c5b7b4a0-5d3e-4f8e-9a4b-0d1e2f3a4b5c", storage, LogLimits{})
+	appendTimedLines(logs, 0, 100)
+
+	assert.Len(t, queryLines(t, logs, LogQuery{}), 100)
+	assert.Equal(t, []string{"98", "99"}, queryLines(t, logs, LogQuery{Start: 98}))
+	assert.Equal(t, []string{"95", "96", "97", "98", "99"}, queryLines(t, logs, LogQuery{Tail: 5}))
+	assert.Equal(t, []string{"87", "90", "93", "96", "99"}, queryLines(t, logs, LogQuery{Tail: 5, Stderr: true}))
+	assert.Len(t, queryLines(t, logs, LogQuery{Stdout: true}), 66)
+	assert.Len(t, queryLines(t, logs, LogQuery{Tail: 200}), 100)
+
+	since := queryTime.Add(50 * time.Second)
+	until := queryTime.Add(59 * time.Second)
+	assert.Equal(t, []string{"50", "51", "52"}, queryLines(t, logs, LogQuery{Since: since, Until: queryTime.Add(52 * time.Second)}))
+	assert.Equal(t, []string{"57", "58", "59"}, queryLines(t, logs, LogQuery{Since: since, Until: until, Tail: 3}))
+	assert.Equal(t, []string{"51", "54", "57"}, queryLines(t, logs, LogQuery{Since: since, Until: until, Tail: 20, Stderr: true}))
+	assert.Empty(t, queryLines(t, logs, LogQuery{Since: queryTime.Add(time.Hour)}))
+}
+
+func TestFollowLogs(t *testing.T) {
+	logs := newLogs("c5b7b4a0-5d3e-4f8e-9a4b-0d1e2f3a4b5c", nil, LogLimits{})
+	appendTimedLines(logs, 0, 10)
+	assert.Equal(t, []string{"8", "9"}, queryLines(t, logs, LogQuery{Tail: 2}))
+
+	lines := make(chan string)
+	go func() {
+		logs.query(LogQuery{Tail: 2, Follow: true}, func(entry LogEntry) error {
+			lines <- entry.Line
+			return nil
+		})
+		close(lines)
+	}()
+	assert.Equal(t, "8", <-lines)
+	assert.Equal(t, "9", <-lines)
+	appendTimedLines(logs, 10, 12)
+	logs.close()
+	var rest []string
+	for line := range lines {
+		rest = append(rest, line)
+	}
+	assert.Equal(t, []string{"10", "11"}, rest)
+}
+
+func TestQueryDroppedLogs(t *testing.T) {
+	logs := newLogs("c5b7b4a0-5d3e-4f8e-9a4b-0d1e2f3a4b5c", nil, LogLimits{JobLines: 10})
+	appendTimedLines(logs, 0, 100)
+	assert.Equal(t, []string{"-90", "90", "91"}, queryLines(t, logs, LogQuery{Until: queryTime.Add(91 * time.Second)}))
+	// the tail starts after dropped lines
+	assert.Len(t, queryLines(t, logs, LogQuery{Tail: 20}), 10)
+	assert.Equal(t, []string{"95"}, queryLines(t, logs, LogQuery{Since: queryTime.Add(95 * time.Second), Until: queryTime.Add(95 * time.Second)}))
+}
+
+func TestLogTimestampsDoNotDecrease(t *testing.T) {
+	logs := newLogs("c5b7b4a0-5d3e-4f8e-9a4b-0d1e2f3a4b5c", nil, LogLimits{})
+	// a line of the other output stamped earlier, but appended later
+	logs.append(LogEntry{Line: "0", Stdout: true, Timestamp: queryTime.Add(2 * time.Second)})
+	logs.append(LogEntry{Line: "1", Timestamp: queryTime.Add(time.Second)})
+	logs.append(LogEntry{Line: "2", Stdout: true, Timestamp: queryTime.Add(3 * time.Second)})
+	entries := logs.get(0, 3)
+	assert.Equal(t, queryTime.Add(2*time.Second), entries[1].Timestamp)
+	assert.Equal(t, []string{"0", "1", "2"}, queryLines(t, logs, LogQuery{Since: queryTime.Add(2 * time.Second)}))
+	assert.Equal(t, []string{"2"}, queryLines(t, logs, LogQuery{Since: queryTime.Add(3 * time.Second)}))
+
+	// lines read from outputs are stamped when they are appended
+	before := time.Now()
+	logs.append(LogEntry{Line: "3"})
+	assert.False(t, logs.get(3, 1)[0].Timestamp.Before(before))
+}
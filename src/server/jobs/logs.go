@@ -5,82 +5,539 @@ import (
 	"bufio"
 	"io"
 	"log"
+	"slices"
 	"strings"
 	"sync"
 	"time"
+	"unicode/utf8"
 )
 
+// Maximum size of a chunk of output captured in the raw mode
+const maxChunkSize = 32 << 10
+
 // Represents a single obtained log line with metadata
 type LogEntry struct {
 	Line      string
 	Timestamp time.Time
 	Stdout    bool
+	// Position of the line among all lines of the job, a sequence number shared by stdout and stderr.
+	// For a marker of dropped lines the position of the last of them.
+	Index int
+	// Number of dropped lines that the entry stands for instead of a line, zero for a line
+	Dropped int
+	// Chunk of output preserved exactly, set instead of the line in the raw mode
+	Data []byte
+	// Position of the first byte of the chunk in its output stream, only in the raw mode
+	Offset int64
+}
+
+// Number of bytes of output that the entry holds
+func (entry LogEntry) size() int64 {
+	return int64(len(entry.Line) + len(entry.Data))
 }
 
-// Repository of logs
+// Repository of logs.
+// The newest lines are kept in memory, older ones are spilled to segment files if a storage is configured.
 type logs struct {
 	sync.Mutex
 	cond         *sync.Cond
 	readingCoros int
-	logs         []LogEntry
-	jobID        JobID
+	// the newest lines, the first of them has the index memFirst
+	logs     []LogEntry
+	memFirst int
+	memBytes int64
+	// lines spilled to disk, oldest first
+	segments []*segment
+	// a spill writes lines to segment files without holding the lock, only one runs at a time
+	spilling bool
+	// index of the first kept line, older lines were dropped
+	first int
+	// number of kept lines
+	kept  int
+	jobID JobID
+	// the job may still start processes that produce more logs
+	open bool
+	// when the last line was appended
+	last time.Time
+	// total length of the kept lines
+	bytes int64
+	// nil if all lines are kept in memory
+	storage *LogStorage
+	// limits of kept lines of the job
+	limits LogLimits
+	// the job was removed, lines are not available any more
+	released bool
+	// output is captured as chunks of bytes instead of lines
+	raw bool
+	// bytes produced so far on stdout and stderr in the raw mode
+	stdoutBytes int64
+	stderrBytes int64
 }
 
-// Bacground job that reads lines from n output process stream
-func (logs *logs) read(pipe io.ReadCloser, stdout bool) {
-	reader := bufio.NewReader(pipe)
+// Bacground job that reads lines or chunks from n output process stream
+func (logs *logs) read(pipe io.ReadCloser, stdout bool, done *sync.WaitGroup) {
+	defer done.Done()
+	defer pipe.Close()
 	name := "stderr"
 	if stdout {
 		name = "stdout"
 	}
-	for {
-		line, err := reader.ReadString('\n')
-		if err != nil {
-			log.Println("pipe", name, "of job", logs.jobID, "got closed")
-			break
-		}
-		line = strings.TrimSuffix(line, "\n")
-		entry := LogEntry{Line: line, Timestamp: time.Now(), Stdout: stdout}
-		logs.append(entry)
+	if logs.raw {
+		logs.readChunks(pipe, stdout)
+	} else {
+		logs.readLines(pipe, stdout)
 	}
+	log.Println("pipe", name, "of job", logs.jobID, "got closed")
 	logs.Lock()
 	defer logs.Unlock()
 	logs.readingCoros -= 1
 	logs.cond.Broadcast()
 }
 
-// Appends a line to the repository of logs
+// Reads lines until the stream ends, the last line may miss the line end.
+// Invalid UTF-8 sequences are replaced, text of lines must be valid in the protocol.
+func (logs *logs) readLines(pipe io.Reader, stdout bool) {
+	reader := bufio.NewReader(pipe)
+	for {
+		line, err := reader.ReadString('\n')
+		if line != "" {
+			line = strings.TrimSuffix(line, "\n")
+			// terminals end lines with "\r\n"
+			line = strings.TrimSuffix(line, "\r")
+			if !utf8.ValidString(line) {
+				line = strings.ToValidUTF8(line, string(utf8.RuneError))
+			}
+			logs.append(LogEntry{Line: line, Stdout: stdout})
+		}
+		if err != nil {
+			return
+		}
+	}
+}
+
+// Reads chunks of at most maxChunkSize bytes as they come until the stream ends
+func (logs *logs) readChunks(pipe io.Reader, stdout bool) {
+	buffer := make([]byte, maxChunkSize)
+	for {
+		n, err := pipe.Read(buffer)
+		if n > 0 {
+			// the buffer is reused, a chunk must not keep all of it
+			data := slices.Clone(buffer[:n])
+			logs.append(LogEntry{Data: data, Stdout: stdout})
+		}
+		if err != nil {
+			return
+		}
+	}
+}
+
+// Appends a line to the repository of logs.
+// A line without a timestamp is stamped now. Timestamps never decrease, readers search lines by time.
+// Lines are spilled to disk without holding the lock, readers and other writers are not blocked meanwhile.
 // Thread safe
 func (logs *logs) append(entry LogEntry) {
 	logs.Lock()
 	defer logs.Unlock()
+	if logs.released {
+		return
+	}
+	entry.Index = logs.memFirst + len(logs.logs)
+	// stamped under the lock, so that lines of both outputs are in the order of their times
+	if entry.Timestamp.IsZero() {
+		entry.Timestamp = time.Now()
+	}
+	if entry.Timestamp.Before(logs.last) {
+		// the wall clock may step back
+		entry.Timestamp = logs.last
+	}
+	size := entry.size()
+	if entry.Data != nil {
+		if entry.Stdout {
+			entry.Offset = logs.stdoutBytes
+			logs.stdoutBytes += size
+		} else {
+			entry.Offset = logs.stderrBytes
+			logs.stderrBytes += size
+		}
+	}
 	logs.logs = append(logs.logs, entry)
+	logs.kept++
+	logs.memBytes += size
+	logs.bytes += size
+	logs.last = entry.Timestamp
+	if logs.storage != nil {
+		logs.storage.memory.Add(size)
+		if !logs.spilling && logs.storage.spillNeeded(logs.memBytes) {
+			logs.spill()
+		}
+	}
+	logs.drop()
 	logs.cond.Broadcast()
 }
 
+// Lines of a spill written to a segment, not visible to readers until committed
+type segmentWrite struct {
+	seg *segment
+	// the segment was created by the spill
+	created bool
+	// offsets of the written lines in the file
+	offsets []int64
+	// total length of the written lines
+	bytes int64
+}
+
+// Outcome of writing lines kept in memory to segment files
+type spillResult struct {
+	// the last segment before the spill, nil if there was none
+	current *segment
+	writes  []segmentWrite
+	// number of lines that left memory, either written or lost
+	done int
+	// bytes of lines moved to disk and of lines that could not be written
+	spilled int64
+	lost    int64
+	// number of lines that could not be written
+	lostLines int
+}
+
+// Moves lines kept in memory to segment files, a new segment is started once the current one is full.
+// The lock is released while the files are written and held again on return.
+// Readers get the lines from memory until the spill commits, lines appended meanwhile wait for the next spill.
+// Must be called with the lock held
+func (logs *logs) spill() {
+	var current *segment
+	if len(logs.segments) > 0 {
+		current = logs.segments[len(logs.segments)-1]
+	}
+	// entries are never modified, the slice stays valid without the lock
+	batch := logs.logs
+	logs.spilling = true
+	logs.Unlock()
+	result := logs.write(current, batch)
+	logs.Lock()
+	logs.spilling = false
+	logs.commit(result)
+}
+
+// Writes lines to the current segment and to new segments once it is full.
+// Lines stay in memory if no segment can be created for them.
+// Lines that cannot be written are lost, readers skip them.
+// Touches only segment files and the writing state of segments, runs without the lock
+func (logs *logs) write(current *segment, batch []LogEntry) spillResult {
+	result := spillResult{current: current}
+	for _, entry := range batch {
+		if current == nil || current.file == nil || current.size >= logs.storage.limits.Segment {
+			if current != nil {
+				err := current.seal()
+				if err != nil {
+					log.Println("Could not write logs of job", logs.jobID, "to disk", err)
+				}
+			}
+			next, err := logs.storage.createSegment(logs.jobID, entry.Index)
+			if err != nil {
+				log.Println("Could not create a log segment of job", logs.jobID, err)
+				break
+			}
+			current = next
+			result.writes = append(result.writes, segmentWrite{seg: current, created: true})
+		} else if len(result.writes) == 0 {
+			result.writes = append(result.writes, segmentWrite{seg: current})
+		}
+		write := &result.writes[len(result.writes)-1]
+		offset, err := current.append(entry)
+		if err != nil {
+			log.Println("Could not write logs of job", logs.jobID, "to disk", err)
+			// the segment may be partially written, nothing more goes there
+			current.seal()
+			result.lost += entry.size()
+			result.lostLines++
+		} else {
+			write.offsets = append(write.offsets, offset)
+			write.bytes += entry.size()
+			result.spilled += entry.size()
+		}
+		result.done++
+	}
+	if current != nil {
+		err := current.flush()
+		if err != nil {
+			log.Println("Could not write logs of job", logs.jobID, "to disk", err)
+			current.seal()
+		}
+	}
+	return result
+}
+
+// Makes lines written by a spill visible to readers and removes them from memory.
+// Segments of a job removed during the spill are removed as well.
+// NOT thread safe
+func (logs *logs) commit(result spillResult) {
+	if logs.released {
+		// the usage was already cleared, the segment that was being written was left here
+		if result.current != nil {
+			result.current.remove()
+		}
+		for _, write := range result.writes {
+			if write.created {
+				write.seg.remove()
+			}
+		}
+		return
+	}
+	for _, write := range result.writes {
+		write.seg.offsets = append(write.seg.offsets, write.offsets...)
+		write.seg.bytes += write.bytes
+		if write.created {
+			logs.segments = append(logs.segments, write.seg)
+		}
+	}
+	// readers may still hold the previous lines
+	logs.logs = slices.Clone(logs.logs[result.done:])
+	logs.memFirst += result.done
+	logs.memBytes -= result.spilled + result.lost
+	logs.bytes -= result.lost
+	logs.kept -= result.lostLines
+	logs.storage.memory.Add(-result.spilled - result.lost)
+	logs.storage.disk.Add(result.spilled)
+}
+
+// Drops the oldest lines while the job keeps more logs than allowed.
+// Whole segments are dropped first, lines in memory only if there are no segments left.
+// Above the total limit of the storage only segments are dropped.
+// During a spill the last segment and lines in memory are kept, they are dropped once the spill commits.
+// NOT thread safe
+func (logs *logs) drop() {
+	for len(logs.segments) > logs.writtenSegments() && (logs.overLimits() || logs.storage.overTotal()) {
+		seg := logs.segments[0]
+		logs.segments = logs.segments[1:]
+		seg.remove()
+		logs.first = seg.end()
+		logs.kept -= len(seg.offsets)
+		logs.bytes -= seg.bytes
+		logs.storage.disk.Add(-seg.bytes)
+	}
+	if logs.spilling {
+		return
+	}
+	dropped := 0
+	var size int64
+	for dropped < len(logs.logs) && logs.overLimits() {
+		// the entries are not cleared, readers may still hold them
+		lineSize := logs.logs[dropped].size()
+		size += lineSize
+		logs.bytes -= lineSize
+		logs.kept--
+		dropped++
+	}
+	if dropped == 0 {
+		return
+	}
+	logs.logs = logs.logs[dropped:]
+	logs.memFirst += dropped
+	logs.first = logs.memFirst
+	logs.memBytes -= size
+	if logs.storage != nil {
+		logs.storage.memory.Add(-size)
+	}
+}
+
+// Number of the last segments that a running spill may write to.
+// NOT thread safe
+func (logs *logs) writtenSegments() int {
+	if logs.spilling && len(logs.segments) > 0 {
+		return 1
+	}
+	return 0
+}
+
+// Returns true if the job keeps more lines or bytes than allowed.
+// NOT thread safe
+func (logs *logs) overLimits() bool {
+	return (logs.limits.JobLines != 0 && logs.kept > logs.limits.JobLines) ||
+		(logs.limits.Job != 0 && logs.bytes > logs.limits.Job)
+}
+
+// Returns when the last line was appended, zero if there are no lines yet.
+// Thread safe
+func (logs *logs) lastAppend() time.Time {
+	logs.Lock()
+	defer logs.Unlock()
+	return logs.last
+}
+
 // Gets a slice with logs or waits until they are generated.
-// Returning 0 length indicates that there are no more logs to return
+// If the requested line was dropped, a single marker that stands for it and for the following dropped lines is returned.
+// Returning 0 length indicates that there are no more logs to return.
+// Lines spilled to disk are read without holding the lock.
+// Thread safe
 func (logs *logs) get(start, maxCount int) []LogEntry {
+	result, read := logs.locate(start, maxCount)
+	if read == nil {
+		return result
+	}
+	result, err := read.read()
+	if err == nil {
+		return result
+	}
+	logs.Lock()
+	defer logs.Unlock()
+	if logs.released {
+		return nil
+	}
+	if start < logs.first {
+		// the segment was dropped meanwhile
+		return droppedMarker(start, logs.first)
+	}
+	log.Println("Could not read logs of job", logs.jobID, err)
+	return droppedMarker(start, read.end)
+}
+
+// Returns the requested lines if they are in memory or were dropped, otherwise the part of a segment to read.
+// Waits until the lines are generated.
+// Thread safe
+func (logs *logs) locate(start, maxCount int) ([]LogEntry, *segmentRead) {
 	logs.Lock()
 	defer logs.Unlock()
-	for start >= len(logs.logs) && logs.readingCoros > 0 {
+	for start >= logs.count() && (logs.readingCoros > 0 || logs.open) && !logs.released {
 		logs.cond.Wait()
 	}
-	return logs.logs[start:min(start+maxCount, len(logs.logs))]
+	if logs.released {
+		return nil, nil
+	}
+	if start < logs.first {
+		return droppedMarker(start, logs.first), nil
+	}
+	for _, seg := range logs.segments {
+		if start >= seg.end() {
+			continue
+		}
+		if start < seg.first {
+			// lines that could not be written
+			return droppedMarker(start, seg.first), nil
+		}
+		read := seg.reader(start, maxCount)
+		return nil, &read
+	}
+	if start < logs.memFirst {
+		return droppedMarker(start, logs.memFirst), nil
+	}
+	start -= logs.memFirst
+	return logs.logs[min(start, len(logs.logs)):min(start+maxCount, len(logs.logs))], nil
+}
+
+// Creates a marker that stands for dropped lines from start up to the next kept line
+func droppedMarker(start, next int) []LogEntry {
+	return []LogEntry{{Index: next - 1, Dropped: next - start}}
+}
+
+// Number of lines produced so far, including the dropped ones.
+// NOT thread safe
+func (logs *logs) count() int {
+	return logs.memFirst + len(logs.logs)
 }
 
-// Returns the number of kept logs
+// Returns the number of lines produced so far, including the dropped ones
 func (logs *logs) size() int {
 	logs.Lock()
 	defer logs.Unlock()
-	return len(logs.logs)
+	return logs.count()
+}
+
+// Returns the number of kept lines, older lines were dropped
+func (logs *logs) retained() int {
+	logs.Lock()
+	defer logs.Unlock()
+	return logs.kept
+}
+
+// Returns the total length of the kept lines in bytes
+func (logs *logs) byteSize() int64 {
+	logs.Lock()
+	defer logs.Unlock()
+	return logs.bytes
 }
 
-// Creates a new instance of "logs"
-func newLogs(stdout, stderr io.ReadCloser, jobID JobID) *logs {
-	result := &logs{readingCoros: 2, jobID: jobID}
+// Creates a new instance of "logs", open until the job finishes.
+// Lines are spilled to the storage if it is not nil, the oldest lines are dropped above the limits of the job.
+func newLogs(jobID JobID, storage *LogStorage, limits LogLimits) *logs {
+	result := &logs{jobID: jobID, open: true, storage: storage, limits: limits}
 	result.cond = sync.NewCond(result)
-	go result.read(stdout, true)
-	go result.read(stderr, false)
 	return result
 }
+
+// Creates finished logs of a job restored after a restart of the server from the segments it left on disk.
+// Lines that were only in memory are lost, they are reported as dropped up to the number of produced lines.
+func restoreLogs(jobID JobID, storage *LogStorage, limits LogLimits, produced int) *logs {
+	result := newLogs(jobID, storage, limits)
+	result.open = false
+	end := produced
+	if storage != nil {
+		result.segments = storage.loadSegments(jobID)
+	}
+	for _, seg := range result.segments {
+		result.kept += len(seg.offsets)
+		result.bytes += seg.bytes
+		end = max(end, seg.end())
+	}
+	result.first = end
+	if len(result.segments) > 0 {
+		result.first = result.segments[0].first
+	}
+	result.memFirst = end
+	return result
+}
+
+// Frees memory and segment files of a removed job, readers get the end of logs.
+// Thread safe
+func (logs *logs) release() {
+	logs.Lock()
+	defer logs.Unlock()
+	if logs.released {
+		return
+	}
+	logs.released = true
+	// a running spill removes the segment it writes to once it is done
+	for _, seg := range logs.segments[:len(logs.segments)-logs.writtenSegments()] {
+		seg.remove()
+	}
+	if logs.storage != nil {
+		logs.storage.memory.Add(-logs.memBytes)
+		logs.storage.disk.Add(-(logs.bytes - logs.memBytes))
+	}
+	logs.segments = nil
+	logs.memFirst += len(logs.logs)
+	logs.first = logs.memFirst
+	logs.logs = nil
+	logs.memBytes = 0
+	logs.bytes = 0
+	logs.kept = 0
+	logs.cond.Broadcast()
+}
+
+// Starts reading outputs of a process.
+// stderr may be nil if the process has only one output (a terminal).
+// Returns a wait group that is done once both outputs are fully read.
+// Thread safe
+func (logs *logs) readFrom(stdout, stderr io.ReadCloser) *sync.WaitGroup {
+	logs.Lock()
+	defer logs.Unlock()
+	done := &sync.WaitGroup{}
+	done.Add(1)
+	logs.readingCoros += 1
+	go logs.read(stdout, true, done)
+	if stderr != nil {
+		done.Add(1)
+		logs.readingCoros += 1
+		go logs.read(stderr, false, done)
+	}
+	return done
+}
+
+// Marks that the job finished, readers get all remaining logs and then the end of logs.
+// Thread safe
+func (logs *logs) close() {
+	logs.Lock()
+	defer logs.Unlock()
+	logs.open = false
+	logs.cond.Broadcast()
+}
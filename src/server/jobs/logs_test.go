@@ -1,6 +1,9 @@
 package jobs
 
 import (
+	"bytes"
+	"io"
+	"strings"
 	"testing"
 	"time"
 
@@ -8,8 +11,8 @@ import (
 )
 
 func TestGetSimpleLog(t *testing.T) {
-	j, err := newJob([]string{"echo", "blah", "uf", "uf!"}, nil)
-	defer j.stop()
+	j, err := newJob(Spec{Command: []string{"echo", "blah", "uf", "uf!"}}, Config{}, nil)
+	defer j.stop(StopOptions{})
 	assert.NoError(t, err)
 	logs := j.GetLogs(0, 5)
 	t.Log(logs)
@@ -21,10 +24,82 @@ func TestGetSimpleLog(t *testing.T) {
 }
 
 func TestGetLogOutsideOfRange(t *testing.T) {
-	j, err := newJob([]string{"echo", "blah", "uf", "uf!"}, nil)
-	defer j.stop()
+	j, err := newJob(Spec{Command: []string{"echo", "blah", "uf", "uf!"}}, Config{}, nil)
+	defer j.stop(StopOptions{})
 	assert.NoError(t, err)
 	logs := j.GetLogs(1, 5)
 
 	assert.Equal(t, len(logs), 0)
 }
+
+func TestLogLimitsWithoutStorage(t *testing.T) {
+	logs := newLogs("c5b7b4a0-5d3e-4f8e-9a4b-0d1e2f3a4b5c", nil, LogLimits{JobLines: 50, Job: 400})
+	appendLines(logs, 0, 30)
+	assert.Equal(t, 30, logs.retained())
+	// the byte limit is reached first
+	appendLines(logs, 30, 100)
+	assert.Equal(t, 100, logs.size())
+	assert.Equal(t, 40, logs.retained())
+	assert.Equal(t, int64(400), logs.byteSize())
+
+	assert.Equal(t, []LogEntry{{Index: 59, Dropped: 50}}, logs.get(10, 5))
+	entries := logs.get(60, 5)
+	assert.Len(t, entries, 5)
+	assert.Equal(t, "line 00060", entries[0].Line)
+
+	logs = newLogs("c5b7b4a0-5d3e-4f8e-9a4b-0d1e2f3a4b5c", nil, LogLimits{JobLines: 50})
+	appendLines(logs, 0, 100)
+	assert.Equal(t, 50, logs.retained())
+	assert.Equal(t, []LogEntry{{Index: 49, Dropped: 50}}, logs.get(0, 5))
+}
+
+func TestJobStatusReportsRetainedLogs(t *testing.T) {
+	j, err := newJob(Spec{Command: []string{"seq", "100"}}, Config{LogLimits: LogLimits{JobLines: 10}}, nil)
+	assert.NoError(t, err)
+	defer j.stop(StopOptions{})
+	<-j.killedSignal
+	status := j.Status()
+	assert.Equal(t, 100, status.Logs)
+	assert.Equal(t, 10, status.RetainedLogs)
+}
+
+func TestReadLines(t *testing.T) {
+	logs := newLogs("c5b7b4a0-5d3e-4f8e-9a4b-0d1e2f3a4b5c", nil, LogLimits{})
+	output := "first\r\nlatin \xe9\nno line end"
+	logs.readFrom(io.NopCloser(strings.NewReader(output)), nil).Wait()
+	logs.close()
+	entries := logs.get(0, 5)
+	assert.Len(t, entries, 3)
+	assert.Equal(t, "first", entries[0].Line)
+	assert.Equal(t, "latin �", entries[1].Line)
+	assert.Equal(t, "no line end", entries[2].Line)
+}
+
+func TestReadChunks(t *testing.T) {
+	storage, err := NewLogStorage(t.TempDir(), LogLimits{Memory: 1000})
+	assert.NoError(t, err)
+	logs := newLogs("c5b7b4a0-5d3e-4f8e-9a4b-0d1e2f3a4b5c", storage, LogLimits{})
+	logs.raw = true
+	output := bytes.Repeat([]byte("\x00\xff 50%\r"), maxChunkSize/3)
+	logs.readFrom(io.NopCloser(bytes.NewReader(output)), io.NopCloser(strings.NewReader("\xe9"))).Wait()
+	logs.close()
+
+	var stdout []byte
+	var entries []LogEntry
+	for len(entries) < logs.size() {
+		// spilled chunks are read one segment at a time
+		entries = append(entries, logs.get(len(entries), logs.size())...)
+	}
+	for _, entry := range entries {
+		assert.LessOrEqual(t, len(entry.Data), maxChunkSize)
+		assert.Empty(t, entry.Line)
+		if entry.Stdout {
+			assert.Equal(t, int64(len(stdout)), entry.Offset)
+			stdout = append(stdout, entry.Data...)
+		} else {
+			assert.Equal(t, LogEntry{Data: []byte("\xe9"), Index: entry.Index, Timestamp: entry.Timestamp}, entry)
+		}
+	}
+	assert.Equal(t, output, stdout)
+	assert.Equal(t, int64(len(output)+1), logs.byteSize())
+}
@@ -0,0 +1,317 @@
+// Logs spilled from memory to segment files on disk
+package jobs
+
+import (
+	"bufio"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"path/filepath"
+	"slices"
+	"strconv"
+	"strings"
+	"sync/atomic"
+
+	"github.com/google/uuid"
+)
+
+// Bytes of the newest lines of a job kept in memory if not configured otherwise
+const DefaultLogMemory = 1 << 20
+
+// Size of a segment file after which the next one is started if not configured otherwise
+const DefaultLogSegment = 16 << 20
+
+// Extension of segment files
+const segmentExt = ".log"
+
+// Length of job IDs in names of segment files
+const uuidLength = 36
+
+// When logs are spilled from memory to disk and when they are dropped, zero means no limit
+type LogLimits struct {
+	// Bytes of the newest lines of a single job kept in memory, DefaultLogMemory if zero
+	Memory int64
+	// Bytes of lines of all jobs kept in memory
+	TotalMemory int64
+	// Size of a segment file after which the next one is started, DefaultLogSegment if zero
+	Segment int64
+	// Bytes of kept lines of a single job, the oldest lines are dropped above it, applies also without a storage
+	Job int64
+	// Number of kept lines of a single job, the oldest lines are dropped above it, applies also without a storage
+	JobLines int
+	// Bytes of kept lines of all jobs together, the job that appends drops its oldest segments above it
+	Total int64
+}
+
+// Parses log limits in the form of "memory=1M,total-memory=256M,segment=16M,job=1G,job-lines=100000,total=10G", missing limits are zero
+func ParseLogLimits(text string) (LogLimits, error) {
+	var result LogLimits
+	if text == "" {
+		return result, nil
+	}
+	for _, item := range strings.Split(text, ",") {
+		name, value, ok := strings.Cut(item, "=")
+		if !ok {
+			return LogLimits{}, fmt.Errorf("invalid log limit %q", item)
+		}
+		var err error
+		switch strings.TrimSpace(name) {
+		case "memory":
+			result.Memory, err = parseBytes(value)
+		case "total-memory":
+			result.TotalMemory, err = parseBytes(value)
+		case "segment":
+			result.Segment, err = parseBytes(value)
+		case "job":
+			result.Job, err = parseBytes(value)
+		case "job-lines":
+			result.JobLines, err = strconv.Atoi(value)
+		case "total":
+			result.Total, err = parseBytes(value)
+		default:
+			return LogLimits{}, fmt.Errorf("unknown log limit %q", name)
+		}
+		if err != nil {
+			return LogLimits{}, fmt.Errorf("invalid value of log limit %q: %w", name, err)
+		}
+	}
+	if result.Memory < 0 || result.TotalMemory < 0 || result.Segment < 0 || result.Job < 0 || result.JobLines < 0 || result.Total < 0 {
+		return LogLimits{}, errors.New("log limits cannot be negative")
+	}
+	return result, nil
+}
+
+// Directory with segment files of all jobs together with usage of memory and disk by their logs.
+// Thread safe
+type LogStorage struct {
+	dir    string
+	limits LogLimits
+	memory atomic.Int64
+	disk   atomic.Int64
+}
+
+// Creates a storage of logs in the directory, the directory is created if it does not exist.
+// Segment files left by a previous run of the server are kept until the jobs are restored.
+func NewLogStorage(dir string, limits LogLimits) (*LogStorage, error) {
+	err := os.MkdirAll(dir, 0o700)
+	if err != nil {
+		return nil, fmt.Errorf("could not create log directory: %w", err)
+	}
+	if limits.Memory == 0 {
+		limits.Memory = DefaultLogMemory
+	}
+	if limits.Segment == 0 {
+		limits.Segment = DefaultLogSegment
+	}
+	return &LogStorage{dir: dir, limits: limits}, nil
+}
+
+// Removes segment files left by a previous run of the server for jobs that are not kept.
+func (s *LogStorage) clean(keep func(JobID) bool) {
+	files, err := filepath.Glob(filepath.Join(s.dir, "*"+segmentExt))
+	if err != nil {
+		log.Println("Could not list log segments", err)
+		return
+	}
+	for _, file := range files {
+		// only files named like segments are removed, the directory may be shared
+		name := filepath.Base(file)
+		if len(name) > uuidLength && name[uuidLength] == '-' && uuid.Validate(name[:uuidLength]) == nil && !keep(JobID(name[:uuidLength])) {
+			os.Remove(file)
+		}
+	}
+}
+
+// Loads segment files of a job left by a previous run of the server, ordered by their first lines.
+// A segment ends with its last completely written line.
+func (s *LogStorage) loadSegments(jobID JobID) []*segment {
+	files, err := filepath.Glob(filepath.Join(s.dir, string(jobID)+"-*"+segmentExt))
+	if err != nil {
+		log.Println("Could not list log segments of job", jobID, err)
+		return nil
+	}
+	var result []*segment
+	for _, file := range files {
+		first, err := strconv.Atoi(strings.TrimSuffix(filepath.Base(file)[uuidLength+1:], segmentExt))
+		if err != nil {
+			continue
+		}
+		seg := &segment{path: file, first: first}
+		err = seg.load()
+		if err != nil {
+			log.Println("Could not load log segment", file, err)
+			os.Remove(file)
+			continue
+		}
+		s.disk.Add(seg.bytes)
+		result = append(result, seg)
+	}
+	slices.SortFunc(result, func(a, b *segment) int { return a.first - b.first })
+	return result
+}
+
+// Returns true if lines of a job that keeps the given bytes in memory should be spilled to disk
+func (s *LogStorage) spillNeeded(memory int64) bool {
+	return memory > s.limits.Memory || (s.limits.TotalMemory != 0 && s.memory.Load() > s.limits.TotalMemory)
+}
+
+// Returns true if logs of all jobs together take more than allowed
+func (s *LogStorage) overTotal() bool {
+	return s.limits.Total != 0 && s.memory.Load()+s.disk.Load() > s.limits.Total
+}
+
+// A file with consecutive lines of a job, encoded as JSON lines.
+// Lines become visible to readers once they are written and committed by the logs.
+type segment struct {
+	path string
+	// index of the first line in the segment
+	first int
+	// byte offsets of the committed lines in the file, guarded by the lock of the logs
+	offsets []int64
+	bytes   int64
+	// kept open for appending, nil once the next segment is started, used by one spill at a time
+	file   *os.File
+	writer *bufio.Writer
+	// size of the file
+	size int64
+}
+
+// Creates a new segment file starting with the line with the given index
+func (s *LogStorage) createSegment(jobID JobID, first int) (*segment, error) {
+	path := filepath.Join(s.dir, fmt.Sprintf("%s-%d%s", jobID, first, segmentExt))
+	file, err := os.OpenFile(path, os.O_CREATE|os.O_EXCL|os.O_WRONLY, 0o600)
+	if err != nil {
+		return nil, err
+	}
+	return &segment{path: path, first: first, file: file, writer: bufio.NewWriter(file)}, nil
+}
+
+// Reads offsets and sizes of the lines of a segment file.
+// The rest of the file after a line that was not completely written is ignored.
+func (seg *segment) load() error {
+	file, err := os.Open(seg.path)
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+	reader := bufio.NewReader(file)
+	for {
+		data, err := reader.ReadBytes('\n')
+		if err == io.EOF {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+		var entry LogEntry
+		if json.Unmarshal(data, &entry) != nil {
+			return nil
+		}
+		seg.offsets = append(seg.offsets, seg.size)
+		seg.size += int64(len(data))
+		seg.bytes += entry.size()
+	}
+}
+
+// Index of the line after the last one in the segment
+func (seg *segment) end() int {
+	return seg.first + len(seg.offsets)
+}
+
+// Appends the line to the segment and returns its offset in the file.
+// It is not visible in the file until flushed.
+func (seg *segment) append(entry LogEntry) (int64, error) {
+	data, err := json.Marshal(entry)
+	if err != nil {
+		return 0, err
+	}
+	data = append(data, '\n')
+	_, err = seg.writer.Write(data)
+	if err != nil {
+		return 0, err
+	}
+	offset := seg.size
+	seg.size += int64(len(data))
+	return offset, nil
+}
+
+// Writes appended lines to the file
+func (seg *segment) flush() error {
+	if seg.writer == nil {
+		return nil
+	}
+	return seg.writer.Flush()
+}
+
+// Stops appending to the segment, it stays readable
+func (seg *segment) seal() error {
+	if seg.file == nil {
+		return nil
+	}
+	err := seg.writer.Flush()
+	closeErr := seg.file.Close()
+	seg.file = nil
+	seg.writer = nil
+	if err != nil {
+		return err
+	}
+	return closeErr
+}
+
+// Closes and removes the segment file
+func (seg *segment) remove() {
+	seg.seal()
+	err := os.Remove(seg.path)
+	if err != nil {
+		log.Println("Could not remove log segment", seg.path, err)
+	}
+}
+
+// Lines of a segment to be read, stays valid without the lock of the logs
+type segmentRead struct {
+	path string
+	// offset of the first line in the file
+	offset int64
+	count  int
+	// index of the line after the last one in the segment
+	end int
+}
+
+// Selects at most maxCount lines starting with the line with the given index.
+// NOT thread safe
+func (seg *segment) reader(start, maxCount int) segmentRead {
+	return segmentRead{
+		path:   seg.path,
+		offset: seg.offsets[start-seg.first],
+		count:  min(maxCount, seg.end()-start),
+		end:    seg.end(),
+	}
+}
+
+// Reads the selected lines, fails if the segment was removed meanwhile
+func (read segmentRead) read() ([]LogEntry, error) {
+	file, err := os.Open(read.path)
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+	_, err = file.Seek(read.offset, io.SeekStart)
+	if err != nil {
+		return nil, err
+	}
+	count := read.count
+	result := make([]LogEntry, 0, count)
+	decoder := json.NewDecoder(bufio.NewReader(file))
+	for range count {
+		var entry LogEntry
+		err = decoder.Decode(&entry)
+		if err != nil {
+			return nil, err
+		}
+		result = append(result, entry)
+	}
+	return result, nil
+}
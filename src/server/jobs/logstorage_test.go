@@ -0,0 +1,227 @@
+package jobs
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestParseLogLimits(t *testing.T) {
+	limits, err := ParseLogLimits("memory=1M,total-memory=256M,segment=16M,job=1G,job-lines=1000,total=10G")
+	assert.NoError(t, err)
+	assert.Equal(t, LogLimits{Memory: 1 << 20, TotalMemory: 256 << 20, Segment: 16 << 20, Job: 1 << 30, JobLines: 1000, Total: 10 << 30}, limits)
+
+	limits, err = ParseLogLimits("")
+	assert.NoError(t, err)
+	assert.Equal(t, LogLimits{}, limits)
+
+	for _, text := range []string{"memory", "memory=lots", "disk=1G", "job=-1", "job-lines=1K"} {
+		_, err = ParseLogLimits(text)
+		assert.Error(t, err, text)
+	}
+}
+
+// Appends lines of 10 bytes each
+func appendLines(logs *logs, from, to int) {
+	for i := from; i < to; i++ {
+		logs.append(LogEntry{Line: fmt.Sprintf("line %05d", i), Stdout: true})
+	}
+}
+
+func TestSpillLogs(t *testing.T) {
+	storage, err := NewLogStorage(t.TempDir(), LogLimits{Memory: 100, Segment: 1000})
+	assert.NoError(t, err)
+	logs := newLogs("c5b7b4a0-5d3e-4f8e-9a4b-0d1e2f3a4b5c", storage, LogLimits{})
+	appendLines(logs, 0, 105)
+	files, err := filepath.Glob(filepath.Join(storage.dir, "*.log"))
+	assert.NoError(t, err)
+	// segments are rotated
+	assert.Greater(t, len(files), 2)
+	assert.LessOrEqual(t, logs.memBytes, int64(100))
+	assert.Equal(t, int64(1050), logs.byteSize())
+	assert.Equal(t, 105, logs.size())
+
+	// reading crosses segments and the lines in memory
+	for start := 0; start < 105; {
+		entries := logs.get(start, 7)
+		assert.NotEmpty(t, entries)
+		for i, entry := range entries {
+			assert.Equal(t, start+i, entry.Index)
+			assert.Equal(t, fmt.Sprintf("line %05d", start+i), entry.Line)
+		}
+		start += len(entries)
+	}
+
+	// followers wait for new lines
+	read := make(chan []LogEntry)
+	go func() { read <- logs.get(105, 10) }()
+	time.Sleep(10 * time.Millisecond)
+	appendLines(logs, 105, 106)
+	assert.Equal(t, "line 00105", (<-read)[0].Line)
+	logs.close()
+	assert.Empty(t, logs.get(106, 10))
+
+	logs.release()
+	files, err = filepath.Glob(filepath.Join(storage.dir, "*.log"))
+	assert.NoError(t, err)
+	assert.Empty(t, files)
+	assert.Empty(t, logs.get(0, 10))
+	assert.Zero(t, storage.memory.Load())
+	assert.Zero(t, storage.disk.Load())
+}
+
+// Both outputs append while a follower reads, spills run without blocking the others
+func TestSpillWhileReading(t *testing.T) {
+	storage, err := NewLogStorage(t.TempDir(), LogLimits{Memory: 100, Segment: 300})
+	assert.NoError(t, err)
+	logs := newLogs("c5b7b4a0-5d3e-4f8e-9a4b-0d1e2f3a4b5c", storage, LogLimits{})
+	var writers sync.WaitGroup
+	for _, stdout := range []bool{true, false} {
+		writers.Add(1)
+		go func() {
+			defer writers.Done()
+			for i := range 500 {
+				logs.append(LogEntry{Line: fmt.Sprintf("line %05d", i), Stdout: stdout})
+			}
+		}()
+	}
+	go func() {
+		writers.Wait()
+		logs.close()
+	}()
+
+	position := 0
+	for {
+		entries := logs.get(position, 7)
+		if len(entries) == 0 {
+			break
+		}
+		for _, entry := range entries {
+			assert.Zero(t, entry.Dropped)
+			assert.Equal(t, position, entry.Index)
+			position++
+		}
+	}
+	assert.Equal(t, 1000, position)
+	assert.Equal(t, int64(10000), logs.byteSize())
+	assert.Equal(t, logs.memBytes, storage.memory.Load())
+	assert.Equal(t, logs.bytes-logs.memBytes, storage.disk.Load())
+}
+
+func TestDropSegments(t *testing.T) {
+	limits := LogLimits{Memory: 100, Segment: 200, Job: 500}
+	storage, err := NewLogStorage(t.TempDir(), limits)
+	assert.NoError(t, err)
+	logs := newLogs("c5b7b4a0-5d3e-4f8e-9a4b-0d1e2f3a4b5c", storage, limits)
+	appendLines(logs, 0, 200)
+	assert.LessOrEqual(t, logs.byteSize(), int64(500))
+	assert.Equal(t, 200, logs.size())
+	assert.Equal(t, logs.retained(), 200-logs.first)
+	// dropped lines are replaced by a marker
+	marker := logs.get(0, 10)
+	assert.Equal(t, []LogEntry{{Index: logs.first - 1, Dropped: logs.first}}, marker)
+	next := logs.get(marker[0].Index+1, 1)
+	assert.Equal(t, fmt.Sprintf("line %05d", logs.first), next[0].Line)
+	assert.Equal(t, 199, logs.get(199, 10)[0].Index)
+}
+
+func TestTotalLogLimits(t *testing.T) {
+	storage, err := NewLogStorage(t.TempDir(), LogLimits{Memory: 1000, TotalMemory: 150, Segment: 200, Total: 600})
+	assert.NoError(t, err)
+	first := newLogs("c5b7b4a0-5d3e-4f8e-9a4b-0d1e2f3a4b5c", storage, LogLimits{})
+	second := newLogs("9d8e7f6a-5b4c-4d3e-8f2a-1b0c9d8e7f6a", storage, LogLimits{})
+	appendLines(first, 0, 10)
+	appendLines(second, 0, 10)
+	// both jobs together exceed the total memory
+	assert.LessOrEqual(t, storage.memory.Load(), int64(150))
+	appendLines(first, 10, 100)
+	// the job that appends drops its own lines
+	assert.LessOrEqual(t, storage.memory.Load()+storage.disk.Load(), int64(600))
+	assert.Equal(t, 0, second.get(0, 1)[0].Index)
+}
+
+func TestLogStorageCleanup(t *testing.T) {
+	dir := t.TempDir()
+	stale := filepath.Join(dir, "c5b7b4a0-5d3e-4f8e-9a4b-0d1e2f3a4b5c-0.log")
+	other := filepath.Join(dir, "server.log")
+	assert.NoError(t, os.WriteFile(stale, nil, 0o600))
+	assert.NoError(t, os.WriteFile(other, nil, 0o600))
+	kept := filepath.Join(dir, "9d8e7f6a-5b4c-4d3e-8f2a-1b0c9d8e7f6a-0.log")
+	assert.NoError(t, os.WriteFile(kept, nil, 0o600))
+	storage, err := NewLogStorage(dir, LogLimits{})
+	assert.NoError(t, err)
+	// segments stay until it is known which jobs were restored
+	assert.FileExists(t, stale)
+	storage.clean(func(id JobID) bool { return id == "9d8e7f6a-5b4c-4d3e-8f2a-1b0c9d8e7f6a" })
+	assert.NoFileExists(t, stale)
+	assert.FileExists(t, kept)
+	assert.FileExists(t, other)
+}
+
+func TestRestoreLogs(t *testing.T) {
+	dir := t.TempDir()
+	limits := LogLimits{Memory: 100, Segment: 200}
+	storage, err := NewLogStorage(dir, limits)
+	assert.NoError(t, err)
+	logs := newLogs("c5b7b4a0-5d3e-4f8e-9a4b-0d1e2f3a4b5c", storage, limits)
+	appendLines(logs, 0, 100)
+	spilled := logs.memFirst
+	assert.Greater(t, spilled, 0)
+	// the server dies with the last segment partially written
+	last := logs.segments[len(logs.segments)-1]
+	file, err := os.OpenFile(last.path, os.O_APPEND|os.O_WRONLY, 0)
+	assert.NoError(t, err)
+	_, err = file.WriteString(`{"Line":"torn`)
+	assert.NoError(t, err)
+	assert.NoError(t, file.Close())
+
+	storage, err = NewLogStorage(dir, limits)
+	assert.NoError(t, err)
+	restored := restoreLogs("c5b7b4a0-5d3e-4f8e-9a4b-0d1e2f3a4b5c", storage, limits, 100)
+	assert.Equal(t, 100, restored.size())
+	assert.Equal(t, spilled, restored.retained())
+	assert.Equal(t, int64(10*spilled), restored.byteSize())
+	assert.Equal(t, int64(10*spilled), storage.disk.Load())
+	for start := 0; start < spilled; {
+		entries := restored.get(start, 7)
+		for i, entry := range entries {
+			assert.Equal(t, fmt.Sprintf("line %05d", start+i), entry.Line)
+		}
+		start += len(entries)
+	}
+	// lines that were only in memory are lost
+	assert.Equal(t, []LogEntry{{Index: 99, Dropped: 100 - spilled}}, restored.get(spilled, 10))
+	assert.Empty(t, restored.get(100, 10))
+
+	restored.release()
+	files, err := filepath.Glob(filepath.Join(dir, "*.log"))
+	assert.NoError(t, err)
+	assert.Empty(t, files)
+	assert.Zero(t, storage.disk.Load())
+}
+
+func TestJobLogsOnDisk(t *testing.T) {
+	storage, err := NewLogStorage(t.TempDir(), LogLimits{Memory: 50, Segment: 100})
+	assert.NoError(t, err)
+	js := NewJobs(nil, Config{Logs: storage})
+	j, err := js.Create(Spec{Command: []string{"seq", "1000"}})
+	assert.NoError(t, err)
+	lines := allLines(j)
+	assert.Len(t, lines, 1000)
+	assert.Equal(t, "1000", lines[999])
+	<-j.killedSignal
+	files, err := filepath.Glob(filepath.Join(storage.dir, "*.log"))
+	assert.NoError(t, err)
+	assert.NotEmpty(t, files)
+
+	_, err = js.Remove(j.ID)
+	assert.NoError(t, err)
+	files, err = filepath.Glob(filepath.Join(storage.dir, "*.log"))
+	assert.NoError(t, err)
+	assert.Empty(t, files)
+}
@@ -0,0 +1,60 @@
+// Pipelines - jobs made of several commands connected with pipes
+package jobs
+
+import (
+	"os/exec"
+	"syscall"
+)
+
+// Connects further stages of a pipeline to the first one.
+// Every stage reads the standard output of the previous one, the last stage takes over the standard output of the job.
+// All stages share the standard error of the job.
+func (s *stdio) connect(first *exec.Cmd, stages []*exec.Cmd) error {
+	output := first.Stdout
+	previous := first
+	for _, stage := range stages {
+		r, w, err := s.pipe()
+		if err != nil {
+			return err
+		}
+		previous.Stdout = w
+		stage.Stdin = r
+		stage.Stderr = first.Stderr
+		s.child = append(s.child, r, w)
+		previous = stage
+	}
+	previous.Stdout = output
+	return nil
+}
+
+// Starts further stages of a pipeline in the process group of the first stage, which already started.
+// On failure kills the whole process group and reaps the stages that started.
+func startStages(first *exec.Cmd, stages []*exec.Cmd) error {
+	for i, stage := range stages {
+		// an exited but not reaped first stage keeps the group alive
+		stage.SysProcAttr.Setpgid = true
+		stage.SysProcAttr.Pgid = first.Process.Pid
+		err := stage.Start()
+		if err != nil {
+			signalGroup(first.Process.Pid, syscall.SIGKILL)
+			first.Wait()
+			for _, started := range stages[:i] {
+				started.Wait()
+			}
+			return err
+		}
+	}
+	return nil
+}
+
+// Exit code of the whole pipeline - of the last stage that failed, zero if all of them succeeded.
+// Like with the pipefail option of shells, failures of the earlier stages are not hidden.
+func pipelineExitCode(codes []int) int {
+	result := 0
+	for _, code := range codes {
+		if code != 0 {
+			result = code
+		}
+	}
+	return result
+}
@@ -0,0 +1,93 @@
+package jobs
+
+import (
+	"syscall"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestPipeline(t *testing.T) {
+	spec := Spec{
+		Command:  []string{"cat"},
+		Pipeline: [][]string{{"sort"}, {"uniq", "-c"}},
+		Stdin:    true,
+	}
+	j, err := newJob(spec, Config{}, nil)
+	assert.NoError(t, err)
+	defer j.stop(StopOptions{})
+	assert.NoError(t, j.WriteStdin([]byte("b\na\nb\n")))
+	assert.NoError(t, j.CloseStdin())
+	lines := allLines(j)
+	<-j.killedSignal
+	assert.Len(t, lines, 2)
+	assert.Regexp(t, `^ *1 a$`, lines[0])
+	assert.Regexp(t, `^ *2 b$`, lines[1])
+	status := j.Status()
+	assert.Equal(t, 0, status.Stopped.ExitCode)
+	assert.Equal(t, []int{0, 0, 0}, status.Stopped.StageExitCodes)
+}
+
+func TestPipelineExitCodes(t *testing.T) {
+	spec := Spec{
+		Command:  []string{"sh", "-c", "echo first >&2; exit 3"},
+		Pipeline: [][]string{{"sh", "-c", "cat; echo second >&2"}},
+	}
+	j, err := newJob(spec, Config{}, nil)
+	assert.NoError(t, err)
+	defer j.stop(StopOptions{})
+	// standard errors of all stages are logged
+	assert.ElementsMatch(t, []string{"first", "second"}, allLines(j))
+	<-j.killedSignal
+	status := j.Status()
+	// a failure of an earlier stage is not hidden
+	assert.Equal(t, 3, status.Stopped.ExitCode)
+	assert.Equal(t, []int{3, 0}, status.Stopped.StageExitCodes)
+	assert.Equal(t, 3, status.Attempts[0].ExitCode)
+}
+
+func TestPipelineStartFailure(t *testing.T) {
+	_, err := newJob(Spec{Command: []string{"sleep", "10"}, Pipeline: [][]string{{"barambaram"}}}, Config{}, nil)
+	assert.Error(t, err)
+
+	for _, spec := range []Spec{
+		{Command: []string{"cat"}, Pipeline: [][]string{{}}},
+		{Command: []string{"cat"}, Pipeline: [][]string{{"sort"}}, Tty: true},
+		{Command: []string{"cat"}, Pipeline: [][]string{{"sort"}}, Isolation: Isolation{Namespaces: true}},
+	} {
+		assert.ErrorIs(t, spec.validate(), ErrInvalidSpec)
+	}
+}
+
+func TestPipelineExitCode(t *testing.T) {
+	assert.Equal(t, 0, pipelineExitCode([]int{0, 0}))
+	assert.Equal(t, 1, pipelineExitCode([]int{1, 0}))
+	assert.Equal(t, -1, pipelineExitCode([]int{1, -1}))
+}
+
+func TestPipelineStop(t *testing.T) {
+	j, err := newJob(Spec{Command: []string{"sleep", "100"}, Pipeline: [][]string{{"sleep", "100"}}}, Config{}, nil)
+	assert.NoError(t, err)
+	// every stage gets the stop signal
+	assert.NoError(t, j.stop(StopOptions{GracePeriod: 5 * time.Second}))
+	status := j.Status()
+	assert.Equal(t, TerminationSignal, status.Stopped.Termination)
+	assert.Equal(t, []int{-1, -1}, status.Stopped.StageExitCodes)
+}
+
+func TestPipelineSignalAfterStageExited(t *testing.T) {
+	spec := Spec{
+		Command:  []string{"true"},
+		Pipeline: [][]string{{"sleep", "10"}},
+	}
+	j, err := newJob(spec, Config{}, nil)
+	assert.NoError(t, err)
+	defer j.stop(StopOptions{})
+	// the first stage exits and gets reaped
+	time.Sleep(200 * time.Millisecond)
+	assert.NoError(t, j.Signal(syscall.SIGKILL, false))
+	<-j.killedSignal
+	// the signal reached the running stage
+	assert.Equal(t, []int{0, -1}, j.Status().Stopped.StageExitCodes)
+}
@@ -0,0 +1,76 @@
+// Process groups of the jobs
+package jobs
+
+import (
+	"os"
+	"strconv"
+	"strings"
+	"syscall"
+	"time"
+)
+
+// How often the process group is checked for remaining processes at first
+const groupPollInterval = 50 * time.Millisecond
+
+// Longest interval between checks of the process group
+const maxGroupPollInterval = time.Second
+
+// Sends the signal to every process in the group.
+func signalGroup(pgid int, sig syscall.Signal) error {
+	return syscall.Kill(-pgid, sig)
+}
+
+// Returns true if any live process still belongs to the group.
+// Zombies are ignored - they are already dead and only wait for their parent to reap them.
+func groupAlive(pgid int) bool {
+	entries, err := os.ReadDir("/proc")
+	if err != nil {
+		// cannot tell, rely on the kernel, zombies included
+		return signalGroup(pgid, 0) == nil
+	}
+	for _, entry := range entries {
+		if _, err := strconv.Atoi(entry.Name()); err != nil {
+			continue
+		}
+		stat, err := os.ReadFile("/proc/" + entry.Name() + "/stat")
+		if err != nil {
+			// the process is already gone
+			continue
+		}
+		state, group, ok := parseStat(string(stat))
+		if ok && group == pgid && state != "Z" {
+			return true
+		}
+	}
+	return false
+}
+
+// Extracts the state and the process group from the content of /proc/<pid>/stat.
+// The command name is in parentheses and may contain spaces, so fields are counted after the last one.
+func parseStat(stat string) (string, int, bool) {
+	end := strings.LastIndexByte(stat, ')')
+	if end < 0 {
+		return "", 0, false
+	}
+	// state ppid pgrp ...
+	fields := strings.Fields(stat[end+1:])
+	if len(fields) < 3 {
+		return "", 0, false
+	}
+	pgid, err := strconv.Atoi(fields[2])
+	if err != nil {
+		return "", 0, false
+	}
+	return fields[0], pgid, true
+}
+
+// Blocks until no live process remains in the group.
+// Used only for jobs without a cgroup. Every check reads all processes of the host,
+// so checks get rarer while descendants keep running.
+func waitGroup(pgid int) {
+	interval := groupPollInterval
+	for groupAlive(pgid) {
+		time.Sleep(interval)
+		interval = min(2*interval, maxGroupPollInterval)
+	}
+}
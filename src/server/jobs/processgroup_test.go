@@ -0,0 +1,24 @@
+package jobs
+
+import (
+	"syscall"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestParseStat(t *testing.T) {
+	state, pgid, ok := parseStat("1234 (my (odd) name) S 1 1230 1230 0 -1 4194560")
+	assert.True(t, ok)
+	assert.Equal(t, "S", state)
+	assert.Equal(t, 1230, pgid)
+
+	_, _, ok = parseStat("1234 (broken")
+	assert.False(t, ok)
+}
+
+func TestGroupAlive(t *testing.T) {
+	assert.True(t, groupAlive(syscall.Getpgrp()))
+	// above the maximal pid
+	assert.False(t, groupAlive(1<<23))
+}
@@ -0,0 +1,89 @@
+// Restart policies of jobs that are supervised by the server
+package jobs
+
+import (
+	"time"
+)
+
+// When the command of a job is started again after it exits
+type RestartPolicy int
+
+const (
+	// The command runs once
+	RestartNever RestartPolicy = iota
+	// The command is started again if it exits with a non-zero exit code or gets killed
+	RestartOnFailure
+	// The command is started again whenever it exits
+	RestartAlways
+)
+
+// Delay before the first restart if not requested otherwise
+const DefaultRestartBackoff = time.Second
+
+// Maximal delay between restarts if not requested otherwise
+const DefaultMaxRestartBackoff = time.Minute
+
+// How the command of a job is restarted.
+// Restarts end once the job is stopped.
+type Restart struct {
+	Policy RestartPolicy
+	// Maximal number of restarts, unlimited if zero
+	MaxRetries int
+	// Delay before the first restart, doubled after every restart, DefaultRestartBackoff if zero
+	Backoff time.Duration
+	// Maximal delay between restarts, DefaultMaxRestartBackoff if zero
+	MaxBackoff time.Duration
+}
+
+// Checks if the restart policy can be applied
+func (restart Restart) validate(tty bool) error {
+	switch restart.Policy {
+	case RestartNever:
+		return nil
+	case RestartOnFailure, RestartAlways:
+	default:
+		return ErrInvalidSpec
+	}
+	if restart.MaxRetries < 0 || restart.Backoff < 0 || restart.MaxBackoff < 0 {
+		return ErrInvalidSpec
+	}
+	if tty {
+		// a terminal belongs to a single process and its attached clients
+		return ErrInvalidSpec
+	}
+	return nil
+}
+
+// Decides if the command should be started again after the given attempt.
+// Returns the delay before the restart.
+func (restart Restart) next(attempts []Attempt) (time.Duration, bool) {
+	last := attempts[len(attempts)-1]
+	switch restart.Policy {
+	case RestartAlways:
+	case RestartOnFailure:
+		if last.ExitCode == 0 {
+			return 0, false
+		}
+	default:
+		return 0, false
+	}
+	restarts := len(attempts) - 1
+	if restart.MaxRetries != 0 && restarts >= restart.MaxRetries {
+		return 0, false
+	}
+	delay := restart.Backoff
+	if delay == 0 {
+		delay = DefaultRestartBackoff
+	}
+	max := restart.MaxBackoff
+	if max == 0 {
+		max = DefaultMaxRestartBackoff
+	}
+	for range restarts {
+		delay *= 2
+		if delay >= max {
+			break
+		}
+	}
+	return min(delay, max), true
+}
@@ -0,0 +1,119 @@
+package jobs
+
+import (
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestRestartNext(t *testing.T) {
+	failed := []Attempt{{ExitCode: 1}}
+	succeeded := []Attempt{{ExitCode: 0}}
+
+	_, ok := Restart{}.next(failed)
+	assert.False(t, ok)
+	_, ok = Restart{Policy: RestartOnFailure}.next(succeeded)
+	assert.False(t, ok)
+	delay, ok := Restart{Policy: RestartOnFailure}.next(failed)
+	assert.True(t, ok)
+	assert.Equal(t, DefaultRestartBackoff, delay)
+	delay, ok = Restart{Policy: RestartAlways, Backoff: time.Millisecond}.next(succeeded)
+	assert.True(t, ok)
+	assert.Equal(t, time.Millisecond, delay)
+
+	// exponential backoff capped at the maximum
+	restart := Restart{Policy: RestartAlways, Backoff: time.Second, MaxBackoff: 5 * time.Second}
+	attempts := []Attempt{}
+	var delays []time.Duration
+	for range 5 {
+		attempts = append(attempts, Attempt{})
+		delay, ok := restart.next(attempts)
+		assert.True(t, ok)
+		delays = append(delays, delay)
+	}
+	assert.Equal(t, []time.Duration{time.Second, 2 * time.Second, 4 * time.Second, 5 * time.Second, 5 * time.Second}, delays)
+
+	// the first attempt is not a retry
+	restart.MaxRetries = 2
+	_, ok = restart.next(attempts[:2])
+	assert.True(t, ok)
+	_, ok = restart.next(attempts[:3])
+	assert.False(t, ok)
+}
+
+func TestRestartValidation(t *testing.T) {
+	cmd := []string{"true"}
+	assert.NoError(t, Spec{Command: cmd, Restart: Restart{Policy: RestartAlways, MaxRetries: 3}}.validate())
+	assert.ErrorIs(t, Spec{Command: cmd, Restart: Restart{Policy: 7}}.validate(), ErrInvalidSpec)
+	assert.ErrorIs(t, Spec{Command: cmd, Restart: Restart{Policy: RestartOnFailure, Backoff: -time.Second}}.validate(), ErrInvalidSpec)
+	assert.ErrorIs(t, Spec{Command: cmd, Tty: true, Restart: Restart{Policy: RestartAlways}}.validate(), ErrInvalidSpec)
+}
+
+func TestJobRestartOnFailure(t *testing.T) {
+	cmd := []string{"bash", "-c", "echo run; exit 3"}
+	restart := Restart{Policy: RestartOnFailure, MaxRetries: 2, Backoff: 10 * time.Millisecond}
+	j, err := newJob(Spec{Command: cmd, Restart: restart}, Config{}, nil)
+	assert.NoError(t, err)
+	// logs of all attempts are kept together
+	assert.Equal(t, []string{"run", "run", "run"}, allLines(j))
+	<-j.killedSignal
+	status := j.Status()
+	assert.Equal(t, 3, status.Stopped.ExitCode)
+	if assert.Len(t, status.Attempts, 3) {
+		for i, a := range status.Attempts {
+			assert.Equal(t, 3, a.ExitCode)
+			assert.Equal(t, i, a.FirstLog)
+			assert.Equal(t, 1, a.Logs)
+			assert.False(t, a.Stopped.Before(a.Started))
+		}
+		assert.Equal(t, status.Started, status.Attempts[0].Started)
+	}
+}
+
+func TestJobRestartUntilSuccess(t *testing.T) {
+	// fails only the first time
+	marker := filepath.Join(t.TempDir(), "marker")
+	cmd := []string{"bash", "-c", "if [ -e $MARKER ]; then echo ok; else touch $MARKER; exit 1; fi"}
+	spec := Spec{
+		Command: cmd,
+		Env:     map[string]string{"MARKER": marker},
+		Restart: Restart{Policy: RestartOnFailure, Backoff: 10 * time.Millisecond},
+	}
+	j, err := newJob(spec, Config{EnvAllowlist: DefaultEnvAllowlist}, nil)
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"ok"}, allLines(j))
+	<-j.killedSignal
+	status := j.Status()
+	assert.Equal(t, 0, status.Stopped.ExitCode)
+	if assert.Len(t, status.Attempts, 2) {
+		assert.Equal(t, 1, status.Attempts[0].ExitCode)
+		assert.Equal(t, 0, status.Attempts[1].ExitCode)
+	}
+}
+
+func TestJobRestartStopped(t *testing.T) {
+	spec := Spec{Command: []string{"sleep", "10"}, Restart: Restart{Policy: RestartAlways}}
+	j, err := newJob(spec, Config{}, nil)
+	assert.NoError(t, err)
+	assert.NoError(t, j.stop(StopOptions{}))
+	status := j.Status()
+	assert.Equal(t, TerminationSignal, status.Stopped.Termination)
+	assert.Len(t, status.Attempts, 1)
+}
+
+func TestJobStoppedDuringBackoff(t *testing.T) {
+	spec := Spec{Command: []string{"true"}, Restart: Restart{Policy: RestartAlways, Backoff: time.Hour}}
+	j, err := newJob(spec, Config{}, nil)
+	assert.NoError(t, err)
+	assert.Eventually(t, func() bool { return len(j.Status().Attempts) == 1 }, time.Second, 10*time.Millisecond)
+	assert.False(t, j.IsStopped())
+	// the pending restart is cancelled
+	start := time.Now()
+	assert.NoError(t, j.stop(StopOptions{}))
+	assert.Less(t, time.Since(start), time.Second)
+	status := j.Status()
+	assert.Equal(t, 0, status.Stopped.ExitCode)
+	assert.Len(t, status.Attempts, 1)
+}
@@ -0,0 +1,171 @@
+// Retention of finished jobs - which of them are removed from the collection and when
+package jobs
+
+import (
+	"fmt"
+	"log"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// How often finished jobs and workflows are checked against the retention policy
+const collectInterval = 10 * time.Second
+
+// When finished jobs are removed together with their logs, zero means no limit.
+// Finished workflows are removed by age and count, their jobs follow the policy on their own.
+type Retention struct {
+	// Time since the job finished
+	MaxAge time.Duration
+	// Number of finished jobs, the ones that finished first are removed first
+	MaxCount int
+	// Total size of logs of finished jobs in bytes, the ones that finished first are removed first
+	MaxLogBytes int64
+}
+
+// A finished job or workflow as seen by the retention policy
+type finishedEntry[ID ~string] struct {
+	id       ID
+	stopped  time.Time
+	logBytes int64
+}
+
+// Selects finished jobs or workflows that exceed the retention policy.
+// The ones that finished first are removed first.
+func expired[ID ~string](r Retention, finished []finishedEntry[ID], now time.Time) []ID {
+	finished = slices.Clone(finished)
+	slices.SortFunc(finished, func(a, b finishedEntry[ID]) int { return a.stopped.Compare(b.stopped) })
+	count := len(finished)
+	var bytes int64
+	for _, f := range finished {
+		bytes += f.logBytes
+	}
+	var result []ID
+	for _, f := range finished {
+		tooOld := r.MaxAge != 0 && now.Sub(f.stopped) > r.MaxAge
+		tooMany := r.MaxCount != 0 && count > r.MaxCount
+		tooLarge := r.MaxLogBytes != 0 && bytes > r.MaxLogBytes
+		if !tooOld && !tooMany && !tooLarge {
+			// the following jobs finished later
+			break
+		}
+		result = append(result, f.id)
+		count--
+		bytes -= f.logBytes
+	}
+	return result
+}
+
+// Parses a retention policy in the form of "age=24h,count=1000,logs=1G", missing limits are zero
+func ParseRetention(text string) (Retention, error) {
+	var result Retention
+	if text == "" {
+		return result, nil
+	}
+	for _, item := range strings.Split(text, ",") {
+		name, value, ok := strings.Cut(item, "=")
+		if !ok {
+			return Retention{}, fmt.Errorf("invalid retention %q", item)
+		}
+		var err error
+		switch strings.TrimSpace(name) {
+		case "age":
+			result.MaxAge, err = time.ParseDuration(value)
+			if err == nil && result.MaxAge < 0 {
+				err = fmt.Errorf("negative value")
+			}
+		case "count":
+			result.MaxCount, err = strconv.Atoi(value)
+			if err == nil && result.MaxCount < 0 {
+				err = fmt.Errorf("negative value")
+			}
+		case "logs":
+			result.MaxLogBytes, err = parseBytes(value)
+			if err == nil && result.MaxLogBytes < 0 {
+				err = fmt.Errorf("negative value")
+			}
+		default:
+			return Retention{}, fmt.Errorf("unknown retention limit %q", name)
+		}
+		if err != nil {
+			return Retention{}, fmt.Errorf("invalid value of retention limit %q: %w", name, err)
+		}
+	}
+	return result, nil
+}
+
+// Removes finished jobs that exceed the retention policy.
+// Thread safe
+func (jobs *Jobs) collect(now time.Time) {
+	jobs.storeMutex.Lock()
+	defer jobs.storeMutex.Unlock()
+	jobs.mutex.Lock()
+	defer jobs.mutex.Unlock()
+	var finished []finishedEntry[JobID]
+	for id, job := range jobs.pending {
+		job.mutex.Lock()
+		stopped := job.Stopped
+		job.mutex.Unlock()
+		if !stopped.IsZero() {
+			finished = append(finished, finishedEntry[JobID]{id: id, stopped: stopped, logBytes: job.logs.byteSize()})
+		}
+	}
+	for _, id := range expired(jobs.config.Retention, finished, now) {
+		log.Println("Removing finished job", id)
+		jobs.pending[id].logs.release()
+		delete(jobs.pending, id)
+		jobs.forget(id)
+	}
+}
+
+// Periodically removes finished jobs until the collection is closed
+func (jobs *Jobs) collectPeriodically() {
+	ticker := time.NewTicker(collectInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-jobs.closed:
+			return
+		case now := <-ticker.C:
+			jobs.collect(now)
+		}
+	}
+}
+
+// Removes finished workflows that exceed the retention policy.
+// Thread safe
+func (workflows *Workflows) collect(now time.Time) {
+	workflows.mutex.Lock()
+	defer workflows.mutex.Unlock()
+	var finished []finishedEntry[WorkflowID]
+	for id, w := range workflows.workflows {
+		w.mutex.Lock()
+		stopped := w.Finished
+		w.mutex.Unlock()
+		if !stopped.IsZero() {
+			finished = append(finished, finishedEntry[WorkflowID]{id: id, stopped: stopped})
+		}
+	}
+	// workflows do not have logs of their own
+	retention := workflows.jobs.config.Retention
+	retention.MaxLogBytes = 0
+	for _, id := range expired(retention, finished, now) {
+		log.Println("Removing finished workflow", id)
+		delete(workflows.workflows, id)
+	}
+}
+
+// Periodically removes finished workflows until the collection of jobs is closed
+func (workflows *Workflows) collectPeriodically() {
+	ticker := time.NewTicker(collectInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-workflows.jobs.closed:
+			return
+		case now := <-ticker.C:
+			workflows.collect(now)
+		}
+	}
+}
@@ -0,0 +1,78 @@
+package jobs
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestRetentionExpired(t *testing.T) {
+	now := time.Date(2024, 1, 1, 12, 0, 0, 0, time.UTC)
+	finished := []finishedEntry[JobID]{
+		{id: "c", stopped: now.Add(-time.Minute), logBytes: 100},
+		{id: "a", stopped: now.Add(-3 * time.Hour), logBytes: 10},
+		{id: "b", stopped: now.Add(-2 * time.Hour), logBytes: 1000},
+	}
+	assert.Empty(t, expired(Retention{}, finished, now))
+	assert.Equal(t, []JobID{"a", "b"}, expired(Retention{MaxAge: time.Hour}, finished, now))
+	assert.Equal(t, []JobID{"a"}, expired(Retention{MaxCount: 2}, finished, now))
+	// the oldest jobs go first, even if they have hardly any logs
+	assert.Equal(t, []JobID{"a", "b"}, expired(Retention{MaxLogBytes: 500}, finished, now))
+	assert.Equal(t, []JobID{"a", "b", "c"}, expired(Retention{MaxCount: 5, MaxLogBytes: 50}, finished, now))
+}
+
+func TestParseRetention(t *testing.T) {
+	retention, err := ParseRetention("age=24h,count=1000,logs=1G")
+	assert.NoError(t, err)
+	assert.Equal(t, Retention{MaxAge: 24 * time.Hour, MaxCount: 1000, MaxLogBytes: 1 << 30}, retention)
+
+	retention, err = ParseRetention("")
+	assert.NoError(t, err)
+	assert.Equal(t, Retention{}, retention)
+
+	for _, invalid := range []string{"age", "age=1", "count=-1", "logs=x", "size=1G"} {
+		_, err = ParseRetention(invalid)
+		assert.Error(t, err, invalid)
+	}
+}
+
+func TestJobsCollect(t *testing.T) {
+	js := NewJobs(nil, Config{Retention: Retention{MaxCount: 1}})
+	defer js.KillAll()
+	running, err := js.Create(Spec{Command: []string{"sleep", "10"}})
+	assert.NoError(t, err)
+	first, err := js.Create(Spec{Command: []string{"echo", "first"}})
+	assert.NoError(t, err)
+	<-first.killedSignal
+	second, err := js.Create(Spec{Command: []string{"echo", "second"}})
+	assert.NoError(t, err)
+	<-second.killedSignal
+	assert.Equal(t, int64(len("second")), second.logs.byteSize())
+
+	js.collect(time.Now())
+	// running jobs are never removed
+	assert.Same(t, running, js.Find(running.ID))
+	assert.Nil(t, js.Find(first.ID))
+	assert.Same(t, second, js.Find(second.ID))
+}
+
+func TestWorkflowsCollect(t *testing.T) {
+	js := NewJobs(nil, Config{Retention: Retention{MaxCount: 1, MaxLogBytes: 1}})
+	defer js.KillAll()
+	workflows := NewWorkflows(js)
+	running, err := workflows.Create([]Step{{Name: "build", Job: Spec{Command: []string{"sleep", "10"}}}})
+	assert.NoError(t, err)
+	first, err := workflows.Create([]Step{{Name: "build", Job: Spec{Command: []string{"true"}}}})
+	assert.NoError(t, err)
+	waitWorkflow(t, first)
+	second, err := workflows.Create([]Step{{Name: "build", Job: Spec{Command: []string{"true"}}}})
+	assert.NoError(t, err)
+	waitWorkflow(t, second)
+
+	workflows.collect(time.Now())
+	// running workflows are never removed, the limit of logs does not apply to workflows
+	assert.Same(t, running, workflows.Find(running.ID))
+	assert.Nil(t, workflows.Find(first.ID))
+	assert.Same(t, second, workflows.Find(second.ID))
+}
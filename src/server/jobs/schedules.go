@@ -0,0 +1,338 @@
+// Schedules that start jobs at given times
+package jobs
+
+import (
+	"errors"
+	"log"
+	"slices"
+	"sync"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/robfig/cron/v3"
+)
+
+// The provided schedule is not valid
+var ErrInvalidSchedule = errors.New("Invalid schedule")
+
+var ErrScheduleNotFound = errors.New("Schedule was not found")
+
+// How late a run may be started before it is considered missed
+const missedRunTolerance = time.Minute
+
+// Number of the most recent runs kept by a schedule
+const scheduleRunsKept = 100
+
+// Type safe schedule identifier
+// Actually UUID
+type ScheduleID string
+
+// What happens with runs missed while the schedule was paused or the server could not start them in time
+type MissedRuns int
+
+const (
+	// Missed runs are skipped, the schedule waits for its next run time
+	MissedSkip MissedRuns = iota
+	// All missed runs are made up for by a single run right away
+	MissedRunOnce
+)
+
+// Specification of a schedule
+type ScheduleSpec struct {
+	// Cron expression with 5 fields or a descriptor like @daily, optionally prefixed with CRON_TZ=<zone>
+	Cron string
+	// Time of a single run, used if there is no cron expression
+	RunAt  time.Time
+	Missed MissedRuns
+	// Specification of the started jobs
+	Job Spec
+}
+
+// A single run of a schedule
+type ScheduledRun struct {
+	// When the run was planned
+	Planned time.Time
+	Started time.Time
+	// Empty if the job could not be started
+	JobID JobID
+	// Why the job could not be started
+	Error string
+}
+
+// Snapshot of the status of a schedule
+type ScheduleStatus struct {
+	ID      ScheduleID
+	Spec    ScheduleSpec
+	Created time.Time
+	Paused  bool
+	// Planned time of the next run, zero if there are no more runs
+	Next time.Time
+	// The most recent runs
+	Runs []ScheduledRun
+}
+
+// Starts jobs at times given by a cron expression or once at a given time
+type Schedule struct {
+	mutex   sync.Mutex
+	ID      ScheduleID
+	Spec    ScheduleSpec
+	Created time.Time
+	// nil for a single run
+	cron   cron.Schedule
+	paused bool
+	// planned time of the next run, zero if there are no more runs
+	next  time.Time
+	timer *time.Timer
+	// increased whenever the timer is replaced, timers of older generations do nothing
+	generation int
+	runs       []ScheduledRun
+	// starts jobs of the schedule
+	start func(Spec) (*Job, error)
+	// runs that start their jobs without holding the lock, registered under the lock
+	running sync.WaitGroup
+}
+
+// Creates a schedule and arms it.
+// start is used for starting jobs of the schedule.
+func newSchedule(spec ScheduleSpec, start func(Spec) (*Job, error)) (*Schedule, error) {
+	s := &Schedule{
+		ID:      ScheduleID(uuid.New().String()),
+		Spec:    spec,
+		Created: time.Now(),
+		start:   start,
+	}
+	switch spec.Missed {
+	case MissedSkip, MissedRunOnce:
+	default:
+		return nil, ErrInvalidSchedule
+	}
+	if (spec.Cron == "") == spec.RunAt.IsZero() {
+		// exactly one of them is required
+		return nil, ErrInvalidSchedule
+	}
+	if spec.Cron != "" {
+		var err error
+		s.cron, err = cron.ParseStandard(spec.Cron)
+		if err != nil {
+			return nil, ErrInvalidSchedule
+		}
+		s.next = s.cron.Next(s.Created)
+	} else {
+		// a time in the past means right away, the single run is never skipped as missed
+		s.next = spec.RunAt
+	}
+	s.Spec.Job.Schedule = s.ID
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	s.arm()
+	return s, nil
+}
+
+// Starts the timer of the next run.
+// NOT thread safe
+func (s *Schedule) arm() {
+	s.generation++
+	if s.timer != nil {
+		s.timer.Stop()
+		s.timer = nil
+	}
+	if s.paused || s.next.IsZero() {
+		return
+	}
+	generation := s.generation
+	s.timer = time.AfterFunc(time.Until(s.next), func() { s.fire(generation) })
+}
+
+// Runs the job planned for now, arms the next run.
+// Thread safe
+func (s *Schedule) fire(generation int) {
+	s.mutex.Lock()
+	if generation != s.generation {
+		// paused or deleted in the meantime
+		s.mutex.Unlock()
+		return
+	}
+	planned := s.next
+	now := time.Now()
+	s.next = s.following(now)
+	// a one-shot schedule makes its single run however late it is
+	due := s.cron == nil || now.Sub(planned) <= missedRunTolerance || s.Spec.Missed == MissedRunOnce
+	if due {
+		s.running.Add(1)
+	} else {
+		log.Println("Schedule", s.ID, "missed its run planned at", planned)
+	}
+	spec := s.Spec.Job
+	s.arm()
+	s.mutex.Unlock()
+	if due {
+		s.run(spec, planned, now)
+	}
+}
+
+// Returns the run time that follows the given time, zero if there is none
+// NOT thread safe
+func (s *Schedule) following(t time.Time) time.Time {
+	if s.cron == nil {
+		return time.Time{}
+	}
+	return s.cron.Next(t)
+}
+
+// Starts a job of the schedule and records the run.
+// Must be called without the lock, starting a job may take a while. The run must be added to running under the lock.
+// Thread safe
+func (s *Schedule) run(spec Spec, planned, now time.Time) {
+	defer s.running.Done()
+	run := ScheduledRun{Planned: planned, Started: now}
+	job, err := s.start(spec)
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	if err != nil {
+		log.Println("Schedule", s.ID, "could not start a job", err)
+		run.Error = err.Error()
+	} else {
+		log.Println("Schedule", s.ID, "started job", job.ID)
+		run.JobID = job.ID
+	}
+	s.runs = append(s.runs, run)
+	if len(s.runs) > scheduleRunsKept {
+		s.runs = slices.Clone(s.runs[len(s.runs)-scheduleRunsKept:])
+	}
+}
+
+// Stops starting jobs until the schedule is resumed.
+// Thread safe
+func (s *Schedule) Pause() {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	if s.paused {
+		return
+	}
+	s.paused = true
+	s.arm()
+}
+
+// Continues starting jobs.
+// Runs planned while the schedule was paused are handled according to its missed runs policy.
+// Thread safe
+func (s *Schedule) Resume() {
+	s.mutex.Lock()
+	if !s.paused {
+		s.mutex.Unlock()
+		return
+	}
+	s.paused = false
+	now := time.Now()
+	var missed time.Time
+	if !s.next.IsZero() && s.next.Before(now) {
+		if s.Spec.Missed == MissedRunOnce {
+			missed = s.next
+			s.running.Add(1)
+		} else {
+			log.Println("Schedule", s.ID, "missed its run planned at", s.next)
+		}
+		s.next = s.following(now)
+	}
+	spec := s.Spec.Job
+	s.arm()
+	s.mutex.Unlock()
+	if !missed.IsZero() {
+		s.run(spec, missed, now)
+	}
+}
+
+// Stops the schedule for good, jobs that it started keep running.
+// Waits for runs that are starting their jobs, no job starts after it returns.
+// Thread safe
+func (s *Schedule) stop() {
+	s.mutex.Lock()
+	s.paused = true
+	s.next = time.Time{}
+	s.arm()
+	s.mutex.Unlock()
+	s.running.Wait()
+}
+
+// Returns snapshot of status of the schedule.
+// Thread safe
+func (s *Schedule) Status() ScheduleStatus {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	return ScheduleStatus{
+		ID:      s.ID,
+		Spec:    s.Spec,
+		Created: s.Created,
+		Paused:  s.paused,
+		Next:    s.next,
+		Runs:    slices.Clone(s.runs),
+	}
+}
+
+// Thread safe collection of schedules
+type Schedules struct {
+	schedules map[ScheduleID]*Schedule
+	jobs      *Jobs
+	mutex     sync.Mutex
+}
+
+// Creates an empty collection of schedules that start jobs in the given collection
+func NewSchedules(jobs *Jobs) *Schedules {
+	return &Schedules{schedules: make(map[ScheduleID]*Schedule), jobs: jobs}
+}
+
+// Creates a new schedule with the given specification.
+// The job specification is checked right away, not only when the first job starts.
+func (schedules *Schedules) Create(spec ScheduleSpec) (*Schedule, error) {
+	err := schedules.jobs.check(spec.Job)
+	if err != nil {
+		return nil, err
+	}
+	s, err := newSchedule(spec, schedules.jobs.Create)
+	if err != nil {
+		return nil, err
+	}
+	schedules.mutex.Lock()
+	defer schedules.mutex.Unlock()
+	schedules.schedules[s.ID] = s
+	return s, nil
+}
+
+// Find returns a schedule by its ID.
+func (schedules *Schedules) Find(id ScheduleID) *Schedule {
+	schedules.mutex.Lock()
+	defer schedules.mutex.Unlock()
+	return schedules.schedules[id]
+}
+
+// Creates a snapshot of the current collection of the schedules.
+func (schedules *Schedules) List() []*Schedule {
+	schedules.mutex.Lock()
+	defer schedules.mutex.Unlock()
+	result := make([]*Schedule, 0, len(schedules.schedules))
+	for _, s := range schedules.schedules {
+		result = append(result, s)
+	}
+	return result
+}
+
+// Stops the schedule and removes it from the collection.
+// Jobs started by the schedule keep running.
+func (schedules *Schedules) Delete(id ScheduleID) (*Schedule, error) {
+	schedules.mutex.Lock()
+	s, ok := schedules.schedules[id]
+	delete(schedules.schedules, id)
+	schedules.mutex.Unlock()
+	if !ok {
+		return nil, ErrScheduleNotFound
+	}
+	s.stop()
+	return s, nil
+}
+
+// Stops all schedules, no more jobs are started.
+func (schedules *Schedules) StopAll() {
+	for _, s := range schedules.List() {
+		s.stop()
+	}
+}
@@ -0,0 +1,170 @@
+package jobs
+
+import (
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// Records specifications of started jobs instead of starting them
+type fakeStarts struct {
+	sync.Mutex
+	specs []Spec
+}
+
+func (starts *fakeStarts) start(spec Spec) (*Job, error) {
+	starts.Lock()
+	defer starts.Unlock()
+	starts.specs = append(starts.specs, spec)
+	return &Job{ID: JobID("job")}, nil
+}
+
+func (starts *fakeStarts) count() int {
+	starts.Lock()
+	defer starts.Unlock()
+	return len(starts.specs)
+}
+
+func TestScheduleValidation(t *testing.T) {
+	starts := &fakeStarts{}
+	job := Spec{Command: []string{"true"}}
+	for _, spec := range []ScheduleSpec{
+		{Job: job},
+		{Cron: "* * *", Job: job},
+		{Cron: "@daily", RunAt: time.Now(), Job: job},
+		{Cron: "@daily", Missed: 7, Job: job},
+	} {
+		_, err := newSchedule(spec, starts.start)
+		assert.ErrorIs(t, err, ErrInvalidSchedule)
+	}
+	s, err := newSchedule(ScheduleSpec{Cron: "CRON_TZ=Europe/Warsaw 30 4 * * 1-5", Job: job}, starts.start)
+	assert.NoError(t, err)
+	defer s.stop()
+	status := s.Status()
+	assert.True(t, status.Next.After(time.Now()))
+	assert.Equal(t, 30, status.Next.Minute())
+	assert.Equal(t, s.ID, status.Spec.Job.Schedule)
+}
+
+func TestScheduleRunAt(t *testing.T) {
+	starts := &fakeStarts{}
+	s, err := newSchedule(ScheduleSpec{RunAt: time.Now().Add(50 * time.Millisecond), Job: Spec{Command: []string{"true"}}}, starts.start)
+	assert.NoError(t, err)
+	assert.Eventually(t, func() bool { return starts.count() == 1 }, time.Second, 10*time.Millisecond)
+	status := s.Status()
+	assert.True(t, status.Next.IsZero())
+	assert.Len(t, status.Runs, 1)
+	assert.Equal(t, JobID("job"), status.Runs[0].JobID)
+	// the started job knows its schedule
+	assert.Equal(t, s.ID, starts.specs[0].Schedule)
+}
+
+func TestScheduleRunAtInPast(t *testing.T) {
+	starts := &fakeStarts{}
+	// far beyond the tolerance of missed runs, but it is the only run
+	s, err := newSchedule(ScheduleSpec{RunAt: time.Now().Add(-time.Hour), Job: Spec{Command: []string{"true"}}}, starts.start)
+	assert.NoError(t, err)
+	defer s.stop()
+	assert.Eventually(t, func() bool { return starts.count() == 1 }, time.Second, 10*time.Millisecond)
+	assert.True(t, s.Status().Next.IsZero())
+}
+
+func TestSchedulePause(t *testing.T) {
+	starts := &fakeStarts{}
+	s, err := newSchedule(ScheduleSpec{RunAt: time.Now().Add(50 * time.Millisecond), Job: Spec{Command: []string{"true"}}}, starts.start)
+	assert.NoError(t, err)
+	s.Pause()
+	time.Sleep(100 * time.Millisecond)
+	assert.Equal(t, 0, starts.count())
+	assert.True(t, s.Status().Paused)
+	// the run was missed while paused
+	s.Resume()
+	assert.Equal(t, 0, starts.count())
+	assert.True(t, s.Status().Next.IsZero())
+}
+
+func TestScheduleMissedRunOnce(t *testing.T) {
+	starts := &fakeStarts{}
+	s, err := newSchedule(ScheduleSpec{Cron: "@every 1h", Missed: MissedRunOnce, Job: Spec{Command: []string{"true"}}}, starts.start)
+	assert.NoError(t, err)
+	defer s.stop()
+	s.Pause()
+	// pretend that several runs were planned while paused
+	s.mutex.Lock()
+	s.next = time.Now().Add(-3 * time.Hour)
+	s.mutex.Unlock()
+	s.Resume()
+	assert.Equal(t, 1, starts.count())
+	status := s.Status()
+	assert.False(t, status.Paused)
+	assert.True(t, status.Next.After(time.Now()))
+}
+
+func TestScheduleStartError(t *testing.T) {
+	start := func(Spec) (*Job, error) { return nil, ErrInvalidSpec }
+	s, err := newSchedule(ScheduleSpec{RunAt: time.Now(), Job: Spec{Command: []string{"true"}}}, start)
+	assert.NoError(t, err)
+	assert.Eventually(t, func() bool { return len(s.Status().Runs) == 1 }, time.Second, 10*time.Millisecond)
+	run := s.Status().Runs[0]
+	assert.Empty(t, run.JobID)
+	assert.Equal(t, ErrInvalidSpec.Error(), run.Error)
+}
+
+func TestScheduleSlowStart(t *testing.T) {
+	started := make(chan struct{})
+	release := make(chan struct{})
+	start := func(Spec) (*Job, error) {
+		close(started)
+		<-release
+		return &Job{ID: JobID("job")}, nil
+	}
+	s, err := newSchedule(ScheduleSpec{RunAt: time.Now(), Job: Spec{Command: []string{"true"}}}, start)
+	assert.NoError(t, err)
+	<-started
+	// the schedule is not locked while its job starts
+	assert.Empty(t, s.Status().Runs)
+	s.Pause()
+
+	stopped := make(chan struct{})
+	go func() {
+		s.stop()
+		close(stopped)
+	}()
+	select {
+	case <-stopped:
+		t.Fatal("stopped before the starting job was recorded")
+	case <-time.After(50 * time.Millisecond):
+	}
+	close(release)
+	<-stopped
+	assert.Len(t, s.Status().Runs, 1)
+}
+
+func TestSchedulesCreateDelete(t *testing.T) {
+	jobs := NewJobs(nil, Config{})
+	defer jobs.KillAll()
+	schedules := NewSchedules(jobs)
+	defer schedules.StopAll()
+
+	// the job specification is checked when the schedule is created
+	_, err := schedules.Create(ScheduleSpec{Cron: "@daily", Job: Spec{}})
+	assert.ErrorIs(t, err, ErrInvalidSpec)
+
+	s, err := schedules.Create(ScheduleSpec{RunAt: time.Now(), Job: Spec{Command: []string{"echo", "scheduled"}}})
+	assert.NoError(t, err)
+	assert.Same(t, s, schedules.Find(s.ID))
+	assert.Len(t, schedules.List(), 1)
+	assert.Eventually(t, func() bool { return len(s.Status().Runs) == 1 }, time.Second, 10*time.Millisecond)
+	j := jobs.Find(s.Status().Runs[0].JobID)
+	assert.NotNil(t, j)
+	assert.Equal(t, s.ID, j.Spec.Schedule)
+	assert.Equal(t, []string{"scheduled"}, allLines(j))
+
+	_, err = schedules.Delete(s.ID)
+	assert.NoError(t, err)
+	assert.Nil(t, schedules.Find(s.ID))
+	_, err = schedules.Delete(s.ID)
+	assert.ErrorIs(t, err, ErrScheduleNotFound)
+}
@@ -0,0 +1,33 @@
+// Signals that can be sent to jobs
+package jobs
+
+import (
+	"errors"
+	"strconv"
+	"strings"
+	"syscall"
+
+	"golang.org/x/sys/unix"
+)
+
+// The provided signal name is not known
+var ErrInvalidSignal = errors.New("Invalid signal")
+
+// Parses a signal given by its name ("TERM", "SIGTERM", "term") or number ("15").
+func ParseSignal(name string) (syscall.Signal, error) {
+	if num, err := strconv.Atoi(name); err == nil {
+		if num <= 0 || unix.SignalName(syscall.Signal(num)) == "" {
+			return 0, ErrInvalidSignal
+		}
+		return syscall.Signal(num), nil
+	}
+	name = strings.ToUpper(name)
+	if !strings.HasPrefix(name, "SIG") {
+		name = "SIG" + name
+	}
+	sig := unix.SignalNum(name)
+	if sig == 0 {
+		return 0, ErrInvalidSignal
+	}
+	return sig, nil
+}
@@ -0,0 +1,31 @@
+package jobs
+
+import (
+	"syscall"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestParseSignal(t *testing.T) {
+	tests := []struct {
+		name string
+		want syscall.Signal
+	}{
+		{name: "TERM", want: syscall.SIGTERM},
+		{name: "SIGTERM", want: syscall.SIGTERM},
+		{name: "hup", want: syscall.SIGHUP},
+		{name: "SigUsr1", want: syscall.SIGUSR1},
+		{name: "9", want: syscall.SIGKILL},
+	}
+	for _, test := range tests {
+		sig, err := ParseSignal(test.name)
+		assert.NoError(t, err, test.name)
+		assert.Equal(t, test.want, sig, test.name)
+	}
+
+	for _, name := range []string{"", "SIG", "BLAH", "0", "-1", "1000"} {
+		_, err := ParseSignal(name)
+		assert.ErrorIs(t, err, ErrInvalidSignal, name)
+	}
+}
@@ -0,0 +1,119 @@
+// Definition of what should be started as a job and how
+package jobs
+
+import (
+	"errors"
+	"os"
+	"slices"
+	"strings"
+)
+
+// The provided job specification is not valid
+var ErrInvalidSpec = errors.New("Invalid job specification")
+
+// Specification of a job to be started
+type Spec struct {
+	Command []string
+	// Further stages of a pipeline, each reads the standard output of the previous one
+	Pipeline [][]string
+	// Extra environment variables of the job
+	Env map[string]string
+	// Working directory of the job, the server working directory if empty
+	Dir string
+	// When set, no variables are passed through from the server environment
+	CleanEnv bool
+	// Keeps the standard input open for writing, otherwise it is empty
+	Stdin bool
+	// Runs the job in a pseudo-terminal instead of pipes
+	Tty bool
+	// Captures output as chunks of bytes preserved exactly instead of lines
+	Raw bool
+	// Initial size of the terminal window, the default size if zero
+	WindowSize WindowSize
+	// Named set of resource limits, the server default if empty
+	LimitClass string
+	// Explicitly requested resource limits, override limits of the class if not zero
+	Limits Limits
+	// Namespaces the job runs in
+	Isolation Isolation
+	// Unix user the job runs as, the user of the server if nil
+	User *User
+	// Requested timeouts, override the server defaults if not zero
+	Timeouts Timeouts
+	// When the command is started again after it exits
+	Restart Restart
+	// Schedule that started the job, empty if the job was started directly
+	Schedule ScheduleID
+	// Workflow that the job is a step of, empty if the job was started directly
+	Workflow WorkflowID
+	// Principal that submitted the job, limits of running jobs apply to each principal separately
+	Owner string
+	// Queued jobs with a higher priority start first, jobs with the same priority in the order of submission
+	Priority int
+}
+
+// Stands for values of environment variables, they often hold secrets and are never reported or recorded
+const RedactedValue = "***"
+
+// Returns a copy of the specification with values of environment variables replaced by RedactedValue.
+// Names of the variables are kept.
+func (spec Spec) Redacted() Spec {
+	if len(spec.Env) == 0 {
+		return spec
+	}
+	env := make(map[string]string, len(spec.Env))
+	for name := range spec.Env {
+		env[name] = RedactedValue
+	}
+	spec.Env = env
+	return spec
+}
+
+// Checks if the specification can be used to start a job
+func (spec Spec) validate() error {
+	if len(spec.Command) == 0 || spec.Command[0] == "" {
+		return ErrInvalidSpec
+	}
+	for _, stage := range spec.Pipeline {
+		if len(stage) == 0 || stage[0] == "" {
+			return ErrInvalidSpec
+		}
+	}
+	if len(spec.Pipeline) > 0 && (spec.Tty || spec.Isolation.Namespaces) {
+		// a terminal and init of the namespaces serve a single process
+		return ErrInvalidSpec
+	}
+	for name := range spec.Env {
+		if name == "" || strings.ContainsAny(name, "=\x00") {
+			return ErrInvalidSpec
+		}
+	}
+	err := spec.Restart.validate(spec.Tty)
+	if err != nil {
+		return err
+	}
+	return spec.Isolation.validate()
+}
+
+// Builds the environment of the job.
+// Variables from the allowlist are passed through from the server environment unless CleanEnv is set.
+// Explicitly requested variables override the passed through ones.
+func (spec Spec) environ(allowlist []string) []string {
+	// Must not be nil, otherwise exec passes the whole server environment
+	env := []string{}
+	if !spec.CleanEnv {
+		for _, name := range allowlist {
+			if _, ok := spec.Env[name]; ok {
+				continue
+			}
+			if value, ok := os.LookupEnv(name); ok {
+				env = append(env, name+"="+value)
+			}
+		}
+	}
+	for name, value := range spec.Env {
+		env = append(env, name+"="+value)
+	}
+	slices.Sort(env)
+	return env
+}
@@ -1,23 +1,106 @@
 // Definitions of struct that represent snapshot of status of a job
 package jobs
 
-import "time"
+import (
+	"syscall"
+	"time"
+)
 
 type JobStatus struct {
-	ID      JobID
-	Command []string
+	ID   JobID
+	Spec Spec
+	// When the job was submitted, it may wait in the queue before it starts
+	Submitted time.Time
+	// Zero while the job is queued
 	Started time.Time
-	Logs    int
+	// Number of log lines produced by the job
+	Logs int
+	// Number of log lines still kept, older lines were dropped
+	RetainedLogs int
+	// Resource limits applied to the job, zero if limits are disabled
+	Limits Limits
+	// Timeouts applied to the job, zero if there are none
+	Timeouts Timeouts
+	// Namespaces created for the job, as named in /proc/<pid>/ns
+	Namespaces []string
+	// Finished runs of the command, more than one if the job was restarted
+	Attempts []Attempt
+	// Exactly one of them is set
 	Stopped *StoppedJobStatus
 	Pending *PendingJobStatus
+	Queued  *QueuedJobStatus
 }
 
+// Describes what made the job finish
+type Termination int
+
+const (
+	// The job exited on its own
+	TerminationExit Termination = iota
+	// The job finished after receiving the stop signal
+	TerminationSignal
+	// The job had to be killed
+	TerminationKill
+	// The job was stopped while queued, its process never started
+	TerminationCancel
+	// The server stopped while the job was running or queued, the job was loaded from the store afterwards
+	TerminationLost
+)
+
+// Describes why the server stopped the job
+type StopReason int
+
+const (
+	// The server did not stop the job, it finished on its own
+	StopReasonNone StopReason = iota
+	// A client stopped the job
+	StopReasonUser
+	// The job exceeded one of its timeouts
+	StopReasonTimeout
+	// The server was shutting down
+	StopReasonShutdown
+)
+
 type StoppedJobStatus struct {
-	ExitCode int
-	Stopped  time.Time
+	ExitCode    int
+	Stopped     time.Time
+	Termination Termination
+	// Timeout that made the server stop the job
+	Timeout Timeout
+	// Why the process could not be started, empty if it started
+	Error string
+	// Exit codes of all stages of a pipeline, nil for a single command
+	StageExitCodes []int
+	// Signal that terminated the process, zero if it exited
+	Signal syscall.Signal
+	// The terminated process dumped a core
+	CoreDumped bool
+	// The kernel OOM killer killed a process of the job
+	OOMKilled bool
+	// Why the server stopped the job
+	Reason StopReason
+	// Error of waiting for the process, empty if it exited with zero exit code
+	WaitError string
+}
+
+// Status of a job waiting in the queue
+type QueuedJobStatus struct {
+	// Number of jobs that leave the queue before this one
+	Position int
 }
 
 type PendingJobStatus struct {
 	CPUPercentage float32
 	Memory        float32
 }
+
+// A single finished run of the command of a job
+type Attempt struct {
+	Started  time.Time
+	Stopped  time.Time
+	ExitCode int
+	// Index of the first log line produced by the run
+	FirstLog int
+	// Number of log lines produced by the run
+	Logs int
+}
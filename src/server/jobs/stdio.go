@@ -0,0 +1,117 @@
+// Standard input and outputs of a process
+package jobs
+
+import (
+	"io"
+	"os"
+	"os/exec"
+	"sync"
+)
+
+// Parent side of the standard streams of a job
+type stdio struct {
+	// readers of the outputs, stderr is nil in the terminal mode
+	stdout io.ReadCloser
+	stderr io.ReadCloser
+	// writer of the standard input, nil if not requested or in the terminal mode
+	stdin *os.File
+	// set in the terminal mode, output of the terminal is passed to the logs through the pipe
+	terminal       *terminal
+	terminalOutput *io.PipeWriter
+	// ends passed to the child, closed by the parent once the child starts
+	child []*os.File
+	// remaining parent ends, closed on failure
+	parent []io.Closer
+}
+
+// Configures standard streams of the command according to the specification.
+func newStdio(cmd *exec.Cmd, spec Spec, jobID JobID) (*stdio, error) {
+	if spec.Tty {
+		return newTerminalStdio(cmd, spec.WindowSize, jobID)
+	}
+	return newPipesStdio(cmd, spec.Stdin)
+}
+
+// Pipes are created manually instead of using StdoutPipe() and StderrPipe(),
+// because cmd.Wait() closes those as soon as the process exits, possibly before all output was read.
+func newPipesStdio(cmd *exec.Cmd, withStdin bool) (*stdio, error) {
+	result := &stdio{}
+	stdout, stdoutW, err := result.pipe()
+	if err != nil {
+		return nil, err
+	}
+	stderr, stderrW, err := result.pipe()
+	if err != nil {
+		result.close()
+		return nil, err
+	}
+	result.stdout, result.stderr = stdout, stderr
+	cmd.Stdout, cmd.Stderr = stdoutW, stderrW
+	result.child = append(result.child, stdoutW, stderrW)
+	if withStdin {
+		stdinR, stdin, err := result.pipe()
+		if err != nil {
+			result.close()
+			return nil, err
+		}
+		result.stdin = stdin
+		cmd.Stdin = stdinR
+		result.child = append(result.child, stdinR)
+	}
+	return result, nil
+}
+
+// The process gets a pseudo-terminal as all its standard streams.
+// Terminal output is passed to the logs as stdout.
+func newTerminalStdio(cmd *exec.Cmd, size WindowSize, jobID JobID) (*stdio, error) {
+	term, slave, err := openTerminal(size, jobID)
+	if err != nil {
+		return nil, err
+	}
+	cmd.Stdin, cmd.Stdout, cmd.Stderr = slave, slave, slave
+	// the terminal becomes the controlling terminal of a new session
+	cmd.SysProcAttr.Setsid = true
+	cmd.SysProcAttr.Setctty = true
+	logsR, logsW := io.Pipe()
+	return &stdio{
+		stdout:         logsR,
+		terminal:       term,
+		terminalOutput: logsW,
+		child:          []*os.File{slave},
+		parent:         []io.Closer{term.master, logsR, logsW},
+	}, nil
+}
+
+// Creates a pipe and registers both ends for closing on failure
+func (s *stdio) pipe() (*os.File, *os.File, error) {
+	r, w, err := os.Pipe()
+	if err != nil {
+		return nil, nil, err
+	}
+	s.parent = append(s.parent, r, w)
+	return r, w, nil
+}
+
+// Closes ends passed to the child. Must be called after the process starts.
+// The child has its own copies of those.
+func (s *stdio) closeChild() {
+	for _, f := range s.child {
+		f.Close()
+	}
+}
+
+// Closes all remaining streams, used on failure.
+func (s *stdio) close() {
+	for _, c := range s.parent {
+		c.Close()
+	}
+}
+
+// Starts background processing of the outputs, passes them to the logs.
+// Returns a wait group that is done once the outputs are fully read.
+func (s *stdio) start(logs *logs) *sync.WaitGroup {
+	if s.terminal != nil {
+		go s.terminal.pump(s.terminalOutput)
+	}
+	return logs.readFrom(s.stdout, s.stderr)
+}
@@ -0,0 +1,228 @@
+// Persistent store of jobs - their history survives restarts of the server
+package jobs
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/fs"
+	"log"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+// Records jobs so that they can be loaded again after the server restarts.
+// Implementations must be thread safe.
+type Store interface {
+	// Records the current status of the job, replaces the previous one
+	Save(status JobStatus) error
+	// Removes the record of the job, does nothing if there is none
+	Delete(id JobID) error
+	// Returns statuses of all recorded jobs
+	Load() ([]JobStatus, error)
+}
+
+// Extension of files with records of jobs
+const recordExt = ".json"
+
+// Extension of records being written
+const tmpExt = ".tmp"
+
+// Store that keeps every job in its own JSON file inside of a directory
+type FileStore struct {
+	dir string
+}
+
+// Creates a store in the directory, the directory is created if it does not exist.
+// Temporary files left by a crash are removed.
+func NewFileStore(dir string) (*FileStore, error) {
+	err := os.MkdirAll(dir, 0o700)
+	if err != nil {
+		return nil, fmt.Errorf("could not create store directory: %w", err)
+	}
+	tmps, err := filepath.Glob(filepath.Join(dir, ".*"+tmpExt))
+	if err != nil {
+		return nil, err
+	}
+	for _, tmp := range tmps {
+		os.Remove(tmp)
+	}
+	return &FileStore{dir: dir}, nil
+}
+
+// Path of the record of the job
+func (s *FileStore) path(id JobID) string {
+	return filepath.Join(s.dir, string(id)+recordExt)
+}
+
+// Writes the record to a temporary file and renames it, so a crash never leaves a partially written record.
+func (s *FileStore) Save(status JobStatus) error {
+	data, err := json.Marshal(status)
+	if err != nil {
+		return err
+	}
+	tmp, err := os.CreateTemp(s.dir, "."+string(status.ID)+"-*"+tmpExt)
+	if err != nil {
+		return err
+	}
+	_, err = tmp.Write(data)
+	if err == nil {
+		err = tmp.Sync()
+	}
+	closeErr := tmp.Close()
+	if err == nil {
+		err = closeErr
+	}
+	if err == nil {
+		err = os.Rename(tmp.Name(), s.path(status.ID))
+	}
+	if err != nil {
+		os.Remove(tmp.Name())
+	}
+	return err
+}
+
+func (s *FileStore) Delete(id JobID) error {
+	err := os.Remove(s.path(id))
+	if errors.Is(err, fs.ErrNotExist) {
+		return nil
+	}
+	return err
+}
+
+// Records that cannot be parsed are skipped
+func (s *FileStore) Load() ([]JobStatus, error) {
+	entries, err := os.ReadDir(s.dir)
+	if err != nil {
+		return nil, err
+	}
+	var result []JobStatus
+	for _, entry := range entries {
+		name := entry.Name()
+		if entry.IsDir() || strings.HasPrefix(name, ".") || !strings.HasSuffix(name, recordExt) {
+			continue
+		}
+		path := filepath.Join(s.dir, name)
+		data, err := os.ReadFile(path)
+		if err != nil {
+			return nil, err
+		}
+		var status JobStatus
+		err = json.Unmarshal(data, &status)
+		if err != nil || status.ID == "" {
+			log.Println("Skipping invalid job record", path, err)
+			continue
+		}
+		result = append(result, status)
+	}
+	return result, nil
+}
+
+// Records the current status of the job if it is still in the collection.
+// Does nothing without a store.
+// Thread safe
+func (jobs *Jobs) save(j *Job) {
+	store := jobs.config.Store
+	if store == nil {
+		return
+	}
+	jobs.storeMutex.Lock()
+	defer jobs.storeMutex.Unlock()
+	if jobs.Find(j.ID) != j {
+		// removed in the meantime
+		return
+	}
+	status := j.Status()
+	// values of environment variables are not needed by finished jobs and must not leak to the disk
+	status.Spec = status.Spec.Redacted()
+	err := store.Save(status)
+	if err != nil {
+		log.Println("Could not record job", j.ID, err)
+	}
+}
+
+// Removes the record of the job.
+// NOT thread safe, requires the store mutex
+func (jobs *Jobs) forget(id JobID) {
+	store := jobs.config.Store
+	if store == nil {
+		return
+	}
+	err := store.Delete(id)
+	if err != nil {
+		log.Println("Could not remove record of job", id, err)
+	}
+}
+
+// Restore loads jobs recorded in the store of the configuration.
+// Jobs that did not finish before the server stopped are marked as lost, their processes are gone.
+// Logs of the loaded jobs are available as far as they were spilled to the log storage,
+// segment files of jobs that are not loaded are removed.
+func (jobs *Jobs) Restore() error {
+	store := jobs.config.Store
+	if store == nil {
+		jobs.cleanLogs()
+		return nil
+	}
+	statuses, err := store.Load()
+	if err != nil {
+		return fmt.Errorf("could not load jobs: %w", err)
+	}
+	for _, status := range statuses {
+		j := restoreJob(status, jobs.config, time.Now())
+		jobs.mutex.Lock()
+		jobs.pending[j.ID] = j
+		jobs.mutex.Unlock()
+		if status.Stopped == nil {
+			log.Println("Job", j.ID, "was lost")
+			jobs.save(j)
+		}
+	}
+	jobs.cleanLogs()
+	log.Println("Restored", len(statuses), "jobs")
+	return nil
+}
+
+// Removes segment files left by a previous run of the server for jobs that are not in the collection.
+// Thread safe
+func (jobs *Jobs) cleanLogs() {
+	if jobs.config.Logs == nil {
+		return
+	}
+	jobs.config.Logs.clean(func(id JobID) bool {
+		return jobs.Find(id) != nil
+	})
+}
+
+// Creates a finished job from its recorded status.
+// A job that was running or queued is marked as lost at the given time.
+func restoreJob(status JobStatus, config Config, now time.Time) *Job {
+	stopped := status.Stopped
+	if stopped == nil {
+		stopped = &StoppedJobStatus{
+			ExitCode:    -1,
+			Stopped:     now,
+			Termination: TerminationLost,
+		}
+	}
+	j := &Job{
+		ID:           status.ID,
+		Spec:         status.Spec,
+		Limits:       status.Limits,
+		Timeouts:     status.Timeouts,
+		Submitted:    status.Submitted,
+		Started:      status.Started,
+		Stopped:      stopped.Stopped,
+		logs:         restoreLogs(status.ID, config.Logs, config.LogLimits, status.Logs),
+		killedSignal: make(chan struct{}),
+		stopSignal:   make(chan struct{}),
+		config:       config,
+		attempts:     status.Attempts,
+		restored:     stopped,
+	}
+	close(j.killedSignal)
+	close(j.stopSignal)
+	return j
+}
@@ -0,0 +1,130 @@
+package jobs
+
+import (
+	"os"
+	"path/filepath"
+	"syscall"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestFileStore(t *testing.T) {
+	store, err := NewFileStore(filepath.Join(t.TempDir(), "jobs"))
+	assert.NoError(t, err)
+	status := JobStatus{
+		ID:        "c5b7b4a0-5d3e-4f8e-9a4b-0d1e2f3a4b5c",
+		Spec:      Spec{Command: []string{"echo", "hello"}, Env: map[string]string{"A": "1"}, Owner: "team"},
+		Submitted: time.Date(2024, 1, 1, 12, 0, 0, 0, time.UTC),
+		Limits:    Limits{Memory: 1 << 20},
+		Stopped:   &StoppedJobStatus{ExitCode: 3, Stopped: time.Date(2024, 1, 1, 12, 1, 0, 0, time.UTC), Reason: StopReasonUser},
+	}
+	assert.NoError(t, store.Save(status))
+	status.Stopped.ExitCode = 4
+	assert.NoError(t, store.Save(status))
+	// left by a crash while saving
+	assert.NoError(t, os.WriteFile(filepath.Join(store.dir, ".partial.tmp"), []byte("{"), 0o600))
+	assert.NoError(t, os.WriteFile(filepath.Join(store.dir, "invalid.json"), []byte("{"), 0o600))
+
+	loaded, err := store.Load()
+	assert.NoError(t, err)
+	assert.Equal(t, []JobStatus{status}, loaded)
+	_, err = NewFileStore(store.dir)
+	assert.NoError(t, err)
+	assert.NoFileExists(t, filepath.Join(store.dir, ".partial.tmp"))
+
+	assert.NoError(t, store.Delete(status.ID))
+	assert.NoError(t, store.Delete(status.ID))
+	loaded, err = store.Load()
+	assert.NoError(t, err)
+	assert.Empty(t, loaded)
+}
+
+func TestRestoreJobs(t *testing.T) {
+	store, err := NewFileStore(t.TempDir())
+	assert.NoError(t, err)
+	config := Config{Store: store}
+	js := NewJobs(nil, config)
+	finished, err := js.Create(Spec{Command: []string{"sh", "-c", "exit 3"}, Env: map[string]string{"TOKEN": "secret"}})
+	assert.NoError(t, err)
+	<-finished.killedSignal
+	assert.Eventually(t, func() bool {
+		loaded, _ := store.Load()
+		return len(loaded) == 1 && loaded[0].Stopped != nil
+	}, 5*time.Second, 10*time.Millisecond)
+	// the server died while the job was running
+	running := JobStatus{
+		ID:      "9d8e7f6a-5b4c-4d3e-8f2a-1b0c9d8e7f6a",
+		Spec:    Spec{Command: []string{"sleep", "10"}},
+		Started: time.Now(),
+		Pending: &PendingJobStatus{},
+	}
+	assert.NoError(t, store.Save(running))
+
+	record, err := os.ReadFile(store.path(finished.ID))
+	assert.NoError(t, err)
+	assert.NotContains(t, string(record), "secret")
+
+	restarted := NewJobs(nil, config)
+	assert.NoError(t, restarted.Restore())
+	assert.Len(t, restarted.List(), 2)
+
+	status := restarted.Find(finished.ID).Status()
+	assert.Equal(t, finished.Spec.Redacted(), status.Spec)
+	assert.Equal(t, map[string]string{"TOKEN": RedactedValue}, status.Spec.Env)
+	assert.Equal(t, 3, status.Stopped.ExitCode)
+	assert.Equal(t, TerminationExit, status.Stopped.Termination)
+	assert.Len(t, status.Attempts, 1)
+
+	lost := restarted.Find(running.ID)
+	assert.True(t, lost.IsStopped())
+	assert.Equal(t, TerminationLost, lost.Status().Stopped.Termination)
+	assert.Empty(t, lost.GetLogs(0, 10))
+	assert.ErrorIs(t, lost.Signal(syscall.SIGHUP, false), ErrNotRunning)
+
+	// the lost state is recorded
+	loaded, err := store.Load()
+	assert.NoError(t, err)
+	for _, status := range loaded {
+		assert.NotNil(t, status.Stopped)
+	}
+
+	_, err = restarted.Remove(lost.ID)
+	assert.NoError(t, err)
+	loaded, err = store.Load()
+	assert.NoError(t, err)
+	assert.Len(t, loaded, 1)
+}
+
+func TestRestoreJobLogs(t *testing.T) {
+	store, err := NewFileStore(t.TempDir())
+	assert.NoError(t, err)
+	logDir := t.TempDir()
+	storage, err := NewLogStorage(logDir, LogLimits{Memory: 50, Segment: 100})
+	assert.NoError(t, err)
+	js := NewJobs(nil, Config{Store: store, Logs: storage})
+	j, err := js.Create(Spec{Command: []string{"seq", "100"}})
+	assert.NoError(t, err)
+	<-j.killedSignal
+	assert.Eventually(t, func() bool {
+		loaded, _ := store.Load()
+		return len(loaded) == 1 && loaded[0].Stopped != nil
+	}, 5*time.Second, 10*time.Millisecond)
+	// a segment of a job that is not recorded
+	orphan := filepath.Join(logDir, "9d8e7f6a-5b4c-4d3e-8f2a-1b0c9d8e7f6a-0.log")
+	assert.NoError(t, os.WriteFile(orphan, nil, 0o600))
+
+	storage, err = NewLogStorage(logDir, LogLimits{Memory: 50, Segment: 100})
+	assert.NoError(t, err)
+	restarted := NewJobs(nil, Config{Store: store, Logs: storage})
+	assert.NoError(t, restarted.Restore())
+	assert.NoFileExists(t, orphan)
+	restored := restarted.Find(j.ID)
+	assert.Equal(t, 100, restored.Status().Logs)
+	// the spilled lines survive, the ones still in memory are reported as dropped
+	entries := restored.GetLogs(0, 1)
+	if assert.Len(t, entries, 1) {
+		assert.Equal(t, "1", entries[0].Line)
+	}
+}
@@ -0,0 +1,163 @@
+// Pseudo-terminal of a job and clients attached to it
+package jobs
+
+import (
+	"errors"
+	"io"
+	"log"
+	"os"
+	"sync"
+
+	"github.com/creack/pty"
+)
+
+// The job was not started with a terminal
+var ErrNoTerminal = errors.New("Job does not have a terminal")
+
+// Size of the read buffer and of a single chunk of output sent to attached clients
+const terminalChunkSize = 4096
+
+// Number of chunks that may wait for an attached client before it gets disconnected
+const terminalBacklog = 256
+
+// The character that signals the end of input to a process reading from a terminal (Ctrl-D)
+const terminalEOF byte = 4
+
+// Dimensions of a terminal window
+type WindowSize struct {
+	Rows uint16
+	Cols uint16
+}
+
+// Master side of the pseudo-terminal of a job
+type terminal struct {
+	sync.Mutex
+	master      *os.File
+	subscribers map[chan []byte]struct{}
+	closed      bool
+	reaped      bool
+	jobID       JobID
+}
+
+// Background job that reads the terminal output.
+// Output is passed to the logs and broadcast to all attached clients.
+func (t *terminal) pump(logs io.WriteCloser) {
+	defer logs.Close()
+	for {
+		buf := make([]byte, terminalChunkSize)
+		n, err := t.master.Read(buf)
+		if n > 0 {
+			t.broadcast(buf[:n])
+			logs.Write(buf[:n])
+		}
+		if err != nil {
+			// Linux returns EIO once all processes closed the terminal
+			log.Println("terminal of job", t.jobID, "got closed")
+			break
+		}
+	}
+	t.Lock()
+	defer t.Unlock()
+	t.closed = true
+	for sub := range t.subscribers {
+		close(sub)
+	}
+	t.subscribers = nil
+	if t.reaped {
+		t.master.Close()
+	}
+}
+
+// Informs the terminal that the process finished.
+// The master side gets closed once the output is fully read and the process is reaped,
+// closing it earlier would hang up the terminal and send SIGHUP to the exiting process.
+func (t *terminal) processReaped() {
+	t.Lock()
+	defer t.Unlock()
+	t.reaped = true
+	if t.closed {
+		t.master.Close()
+	}
+}
+
+// Sends the output to all attached clients.
+// Clients that cannot keep up are disconnected instead of blocking the job.
+func (t *terminal) broadcast(data []byte) {
+	t.Lock()
+	defer t.Unlock()
+	for sub := range t.subscribers {
+		select {
+		case sub <- data:
+		default:
+			log.Println("client attached to job", t.jobID, "is too slow, disconnecting")
+			delete(t.subscribers, sub)
+			close(sub)
+		}
+	}
+}
+
+// Attaches a new client to the terminal.
+// Returns a channel with the live output, closed when the terminal gets closed,
+// and a function that detaches the client.
+// Thread safe.
+func (t *terminal) attach() (<-chan []byte, func()) {
+	t.Lock()
+	defer t.Unlock()
+	sub := make(chan []byte, terminalBacklog)
+	if t.closed {
+		close(sub)
+		return sub, func() {}
+	}
+	t.subscribers[sub] = struct{}{}
+	return sub, func() {
+		t.Lock()
+		defer t.Unlock()
+		if _, ok := t.subscribers[sub]; ok {
+			delete(t.subscribers, sub)
+			close(sub)
+		}
+	}
+}
+
+// Writes input to the terminal as if it was typed on a keyboard
+func (t *terminal) write(data []byte) error {
+	_, err := t.master.Write(data)
+	return err
+}
+
+// Changes size of the terminal window
+func (t *terminal) resize(size WindowSize) error {
+	return pty.Setsize(t.master, winsize(size))
+}
+
+// Converts the window size to the pty representation, nil means the default size
+func winsize(size WindowSize) *pty.Winsize {
+	if size == (WindowSize{}) {
+		return nil
+	}
+	return &pty.Winsize{Rows: size.Rows, Cols: size.Cols}
+}
+
+// Opens a new pseudo-terminal.
+// Returns the terminal and the slave side that should be passed to the process.
+func openTerminal(size WindowSize, jobID JobID) (*terminal, *os.File, error) {
+	master, slave, err := pty.Open()
+	if err != nil {
+		return nil, nil, err
+	}
+	ws := winsize(size)
+	if ws != nil {
+		err = pty.Setsize(master, ws)
+		if err != nil {
+			master.Close()
+			slave.Close()
+			return nil, nil, err
+		}
+	}
+	t := &terminal{
+		master:      master,
+		subscribers: make(map[chan []byte]struct{}),
+		jobID:       jobID,
+	}
+	return t, slave, nil
+}
@@ -0,0 +1,84 @@
+package jobs
+
+import (
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestTerminalJob(t *testing.T) {
+	j, err := newJob(Spec{Command: []string{"tty"}, Tty: true}, Config{}, nil)
+	assert.NoError(t, err)
+	defer j.stop(StopOptions{})
+	lines := allLines(j)
+	assert.Equal(t, 1, len(lines))
+	assert.True(t, strings.HasPrefix(lines[0], "/dev/pts/"), lines[0])
+}
+
+func TestTerminalSize(t *testing.T) {
+	spec := Spec{
+		Command:    []string{"bash", "-c", "stty size; read; stty size"},
+		Tty:        true,
+		WindowSize: WindowSize{Rows: 30, Cols: 100},
+	}
+	j, err := newJob(spec, Config{}, nil)
+	assert.NoError(t, err)
+	defer j.stop(StopOptions{})
+	assert.Equal(t, "30 100", j.GetLogs(0, 1)[0].Line)
+	assert.NoError(t, j.ResizeTerminal(WindowSize{Rows: 40, Cols: 120}))
+	assert.NoError(t, j.WriteStdin([]byte("\n")))
+	lines := allLines(j)
+	assert.Equal(t, "40 120", lines[len(lines)-1])
+}
+
+func TestAttach(t *testing.T) {
+	j, err := newJob(Spec{Command: []string{"cat"}, Tty: true}, Config{}, nil)
+	assert.NoError(t, err)
+	defer j.stop(StopOptions{})
+	output, detach, err := j.Attach()
+	assert.NoError(t, err)
+	defer detach()
+
+	assert.NoError(t, j.WriteStdin([]byte("hello\n")))
+	received := ""
+	timeout := time.After(time.Second)
+	// the terminal echoes the input and cat prints it again
+	for strings.Count(received, "hello") < 2 {
+		select {
+		case data := <-output:
+			received += string(data)
+		case <-timeout:
+			t.Fatalf("did not receive output, got %q", received)
+		}
+	}
+	// end of input makes cat finish, which closes the terminal
+	assert.NoError(t, j.CloseStdin())
+	for range output {
+	}
+	<-j.killedSignal
+	assert.Equal(t, 0, j.Status().Stopped.ExitCode)
+}
+
+func TestAttachWithoutTerminal(t *testing.T) {
+	j, err := newJob(Spec{Command: []string{"echo"}}, Config{}, nil)
+	assert.NoError(t, err)
+	defer j.stop(StopOptions{})
+	_, _, err = j.Attach()
+	assert.ErrorIs(t, err, ErrNoTerminal)
+	assert.ErrorIs(t, j.ResizeTerminal(WindowSize{Rows: 1, Cols: 1}), ErrNoTerminal)
+}
+
+func TestIsolatedTerminalJob(t *testing.T) {
+	requireNamespaces(t)
+	// the command reads from the terminal, so it has to be in the foreground
+	spec := Spec{Command: []string{"bash", "-c", "read line; echo got $line"}, Tty: true, Isolation: Isolation{Namespaces: true}}
+	j, err := newJob(spec, Config{}, nil)
+	assert.NoError(t, err)
+	defer j.stop(StopOptions{})
+	assert.NoError(t, j.WriteStdin([]byte("hello\n")))
+	assert.Contains(t, allLines(j), "got hello")
+	<-j.killedSignal
+	assert.Equal(t, 0, j.Status().Stopped.ExitCode)
+}
@@ -0,0 +1,35 @@
+// Details of how the process of a job terminated
+package jobs
+
+import (
+	"os"
+	"syscall"
+
+	"golang.org/x/sys/unix"
+)
+
+// Exit codes above this one are used by init of isolated jobs for commands terminated by a signal
+const signalExitBase = 128
+
+// Obtains the signal that terminated the process and whether it dumped a core.
+// Init of an isolated job exits with 128 plus the signal that terminated its command,
+// so the signal is recovered from the exit code and a core dump cannot be detected.
+func processSignal(state *os.ProcessState, isolated bool) (syscall.Signal, bool) {
+	if state == nil {
+		return 0, false
+	}
+	status, ok := state.Sys().(syscall.WaitStatus)
+	if !ok {
+		return 0, false
+	}
+	if status.Signaled() {
+		return status.Signal(), status.CoreDump()
+	}
+	if isolated && status.Exited() && status.ExitStatus() > signalExitBase {
+		sig := syscall.Signal(status.ExitStatus() - signalExitBase)
+		if unix.SignalName(sig) != "" {
+			return sig, false
+		}
+	}
+	return 0, false
+}
@@ -0,0 +1,64 @@
+package jobs
+
+import (
+	"os/exec"
+	"syscall"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestJobTerminatedBySignal(t *testing.T) {
+	j, err := newJob(Spec{Command: []string{"sh", "-c", "kill -SEGV $$"}}, Config{}, nil)
+	assert.NoError(t, err)
+	<-j.killedSignal
+	stopped := j.Status().Stopped
+	assert.Equal(t, -1, stopped.ExitCode)
+	assert.Equal(t, syscall.SIGSEGV, stopped.Signal)
+	assert.Equal(t, StopReasonNone, stopped.Reason)
+	assert.Contains(t, stopped.WaitError, "segmentation fault")
+	assert.False(t, stopped.OOMKilled)
+}
+
+func TestJobStopReason(t *testing.T) {
+	j, err := newJob(Spec{Command: []string{"sleep", "10"}}, Config{}, nil)
+	assert.NoError(t, err)
+	assert.NoError(t, j.stop(StopOptions{}))
+	stopped := j.Status().Stopped
+	assert.Equal(t, StopReasonUser, stopped.Reason)
+	assert.Equal(t, syscall.SIGTERM, stopped.Signal)
+	assert.Equal(t, "signal: terminated", stopped.WaitError)
+
+	j, err = newJob(Spec{Command: []string{"sleep", "10"}}, Config{}, nil)
+	assert.NoError(t, err)
+	assert.NoError(t, j.kill())
+	<-j.killedSignal
+	stopped = j.Status().Stopped
+	assert.Equal(t, StopReasonShutdown, stopped.Reason)
+	assert.Equal(t, syscall.SIGKILL, stopped.Signal)
+
+	j, err = newJob(Spec{Command: []string{"true"}}, Config{}, nil)
+	assert.NoError(t, err)
+	<-j.killedSignal
+	stopped = j.Status().Stopped
+	assert.Equal(t, syscall.Signal(0), stopped.Signal)
+	assert.Empty(t, stopped.WaitError)
+}
+
+func TestProcessSignal(t *testing.T) {
+	cmd := exec.Command("sh", "-c", "exit 137")
+	cmd.Run()
+	sig, core := processSignal(cmd.ProcessState, false)
+	assert.Equal(t, syscall.Signal(0), sig)
+	assert.False(t, core)
+	// init of isolated jobs reports signals in exit codes
+	sig, _ = processSignal(cmd.ProcessState, true)
+	assert.Equal(t, syscall.SIGKILL, sig)
+
+	cmd = exec.Command("sh", "-c", "exit 3")
+	cmd.Run()
+	sig, _ = processSignal(cmd.ProcessState, true)
+	assert.Equal(t, syscall.Signal(0), sig)
+	sig, _ = processSignal(nil, false)
+	assert.Equal(t, syscall.Signal(0), sig)
+}
@@ -0,0 +1,125 @@
+// Timeouts that end jobs which run for too long
+package jobs
+
+import (
+	"errors"
+	"fmt"
+	"log"
+	"strings"
+	"time"
+)
+
+// The requested timeouts are above the server maximums
+var ErrTimeoutsExceeded = errors.New("Timeouts exceed the server maximums")
+
+// Timeouts of a single job, zero means no timeout
+type Timeouts struct {
+	// Wall-clock time the job may run
+	MaxRuntime time.Duration
+	// Time the job may run without producing any output
+	IdleTimeout time.Duration
+}
+
+// Which timeout ended the job
+type Timeout int
+
+const (
+	// The job was not ended by a timeout
+	TimeoutNone Timeout = iota
+	// The job ran for longer than its maximal runtime
+	TimeoutRuntime
+	// The job did not produce any output for longer than its idle timeout
+	TimeoutIdle
+)
+
+// Timeouts of a job with the given specification.
+// Requested timeouts override the server defaults.
+// Defaults are capped at the maximums, requested timeouts above the maximums are rejected.
+func (config Config) timeouts(spec Spec) (Timeouts, error) {
+	requested := spec.Timeouts
+	if requested.MaxRuntime < 0 || requested.IdleTimeout < 0 {
+		return Timeouts{}, ErrInvalidSpec
+	}
+	max := config.MaxTimeouts
+	if exceeds(requested.MaxRuntime, max.MaxRuntime) || exceeds(requested.IdleTimeout, max.IdleTimeout) {
+		return Timeouts{}, ErrTimeoutsExceeded
+	}
+	defaults := config.DefaultTimeouts
+	return Timeouts{
+		MaxRuntime:  limit(requested.MaxRuntime, defaults.MaxRuntime, max.MaxRuntime),
+		IdleTimeout: limit(requested.IdleTimeout, defaults.IdleTimeout, max.IdleTimeout),
+	}, nil
+}
+
+// Parses timeouts in the form of "runtime=24h,idle=30m", missing timeouts are zero
+func ParseTimeouts(text string) (Timeouts, error) {
+	var result Timeouts
+	if text == "" {
+		return result, nil
+	}
+	for _, item := range strings.Split(text, ",") {
+		name, value, ok := strings.Cut(item, "=")
+		if !ok {
+			return Timeouts{}, fmt.Errorf("invalid timeout %q", item)
+		}
+		var err error
+		switch strings.TrimSpace(name) {
+		case "runtime":
+			result.MaxRuntime, err = time.ParseDuration(value)
+		case "idle":
+			result.IdleTimeout, err = time.ParseDuration(value)
+		default:
+			return Timeouts{}, fmt.Errorf("unknown timeout %q", name)
+		}
+		if err != nil {
+			return Timeouts{}, fmt.Errorf("invalid value of timeout %q: %w", name, err)
+		}
+	}
+	if result.MaxRuntime < 0 || result.IdleTimeout < 0 {
+		return Timeouts{}, errors.New("timeouts cannot be negative")
+	}
+	return result, nil
+}
+
+// Stops the job once it runs for longer than its maximal runtime
+// or does not produce any output for longer than its idle timeout.
+// Returns when the job finishes.
+func (job *Job) watch(timeouts Timeouts, grace time.Duration) {
+	var runtime, idle <-chan time.Time
+	if timeouts.MaxRuntime != 0 {
+		timer := time.NewTimer(timeouts.MaxRuntime - time.Since(job.Started))
+		defer timer.Stop()
+		runtime = timer.C
+	}
+	var idleTimer *time.Timer
+	if timeouts.IdleTimeout != 0 {
+		idleTimer = time.NewTimer(timeouts.IdleTimeout)
+		defer idleTimer.Stop()
+		idle = idleTimer.C
+	}
+	var timeout Timeout
+	for timeout == TimeoutNone {
+		select {
+		case <-job.killedSignal:
+			return
+		case <-runtime:
+			timeout = TimeoutRuntime
+		case <-idle:
+			last := job.Started
+			if appended := job.logs.lastAppend(); appended.After(last) {
+				last = appended
+			}
+			if remaining := timeouts.IdleTimeout - time.Since(last); remaining > 0 {
+				// produced some output in the meantime
+				idleTimer.Reset(remaining)
+			} else {
+				timeout = TimeoutIdle
+			}
+		}
+	}
+	log.Println("Job", job.ID, "timed out, stopping it")
+	err := job.stop(StopOptions{GracePeriod: grace, timeout: timeout})
+	if err != nil {
+		log.Println("Could not stop the timed out job", job.ID, err)
+	}
+}
@@ -0,0 +1,95 @@
+package jobs
+
+import (
+	"syscall"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestTimeoutsResolution(t *testing.T) {
+	config := Config{
+		DefaultTimeouts: Timeouts{MaxRuntime: time.Hour},
+		MaxTimeouts:     Timeouts{MaxRuntime: 24 * time.Hour, IdleTimeout: time.Hour},
+	}
+	cmd := []string{"true"}
+
+	// defaults, no idle timeout capped at the maximum
+	timeouts, err := config.timeouts(Spec{Command: cmd})
+	assert.NoError(t, err)
+	assert.Equal(t, Timeouts{MaxRuntime: time.Hour, IdleTimeout: time.Hour}, timeouts)
+
+	// requested timeouts override the defaults
+	timeouts, err = config.timeouts(Spec{Command: cmd, Timeouts: Timeouts{MaxRuntime: 2 * time.Hour, IdleTimeout: time.Minute}})
+	assert.NoError(t, err)
+	assert.Equal(t, Timeouts{MaxRuntime: 2 * time.Hour, IdleTimeout: time.Minute}, timeouts)
+
+	_, err = config.timeouts(Spec{Command: cmd, Timeouts: Timeouts{MaxRuntime: 48 * time.Hour}})
+	assert.ErrorIs(t, err, ErrTimeoutsExceeded)
+	_, err = config.timeouts(Spec{Command: cmd, Timeouts: Timeouts{IdleTimeout: -time.Second}})
+	assert.ErrorIs(t, err, ErrInvalidSpec)
+
+	// nothing configured
+	timeouts, err = Config{}.timeouts(Spec{Command: cmd})
+	assert.NoError(t, err)
+	assert.Equal(t, Timeouts{}, timeouts)
+}
+
+func TestParseTimeouts(t *testing.T) {
+	timeouts, err := ParseTimeouts("runtime=24h,idle=30m")
+	assert.NoError(t, err)
+	assert.Equal(t, Timeouts{MaxRuntime: 24 * time.Hour, IdleTimeout: 30 * time.Minute}, timeouts)
+
+	timeouts, err = ParseTimeouts("")
+	assert.NoError(t, err)
+	assert.Equal(t, Timeouts{}, timeouts)
+
+	for _, invalid := range []string{"runtime", "runtime=1", "wall=1h", "idle=-1s"} {
+		_, err = ParseTimeouts(invalid)
+		assert.Error(t, err, invalid)
+	}
+}
+
+func TestJobMaxRuntime(t *testing.T) {
+	spec := Spec{Command: []string{"sleep", "10"}, Timeouts: Timeouts{MaxRuntime: 200 * time.Millisecond}}
+	j, err := newJob(spec, Config{}, nil)
+	assert.NoError(t, err)
+	assert.Equal(t, spec.Timeouts, j.Status().Timeouts)
+	select {
+	case <-j.killedSignal:
+	case <-time.After(5 * time.Second):
+		t.Fatal("job did not time out")
+	}
+	stopped := j.Status().Stopped
+	assert.Equal(t, TerminationSignal, stopped.Termination)
+	assert.Equal(t, TimeoutRuntime, stopped.Timeout)
+	assert.Equal(t, StopReasonTimeout, stopped.Reason)
+	assert.Equal(t, syscall.SIGTERM, stopped.Signal)
+}
+
+func TestJobIdleTimeout(t *testing.T) {
+	// the output keeps the job alive for a while, then it hangs
+	cmd := []string{"bash", "-c", "for i in {1..6}; do echo $i; sleep 0.1; done; sleep 10"}
+	spec := Spec{Command: cmd, Timeouts: Timeouts{IdleTimeout: 300 * time.Millisecond}}
+	j, err := newJob(spec, Config{}, nil)
+	assert.NoError(t, err)
+	select {
+	case <-j.killedSignal:
+	case <-time.After(5 * time.Second):
+		t.Fatal("job did not time out")
+	}
+	assert.Equal(t, []string{"1", "2", "3", "4", "5", "6"}, allLines(j))
+	assert.Equal(t, TimeoutIdle, j.Status().Stopped.Timeout)
+}
+
+func TestJobWithinTimeouts(t *testing.T) {
+	spec := Spec{Command: []string{"echo", "done"}, Timeouts: Timeouts{MaxRuntime: time.Second, IdleTimeout: time.Second}}
+	j, err := newJob(spec, Config{}, nil)
+	assert.NoError(t, err)
+	<-j.killedSignal
+	stopped := j.Status().Stopped
+	assert.Equal(t, TerminationExit, stopped.Termination)
+	assert.Equal(t, TimeoutNone, stopped.Timeout)
+	assert.Equal(t, StopReasonNone, stopped.Reason)
+}
@@ -0,0 +1,108 @@
+// Unix users that jobs run as
+package jobs
+
+import (
+	"fmt"
+	"os/user"
+	"strconv"
+	"strings"
+	"syscall"
+)
+
+// Unix user a job runs as
+type User struct {
+	// Authenticated principal that is mapped to the user
+	Principal string
+	// Name of the user, empty if it was given by numbers
+	Name string
+	Uid  uint32
+	Gid  uint32
+	// Supplementary groups
+	Groups []uint32
+}
+
+// Finds a Unix user either by name or in the UID:GID[:GROUP,...] form.
+// Users found by name get all the groups they belong to.
+func LookupUser(name string) (User, error) {
+	if name != "" && name[0] >= '0' && name[0] <= '9' {
+		return parseUser(name)
+	}
+	u, err := user.Lookup(name)
+	if err != nil {
+		return User{}, err
+	}
+	result := User{Name: u.Username}
+	result.Uid, err = parseID(u.Uid)
+	if err != nil {
+		return User{}, err
+	}
+	result.Gid, err = parseID(u.Gid)
+	if err != nil {
+		return User{}, err
+	}
+	groups, err := u.GroupIds()
+	if err != nil {
+		return User{}, err
+	}
+	for _, group := range groups {
+		gid, err := parseID(group)
+		if err != nil {
+			return User{}, err
+		}
+		if gid != result.Gid {
+			result.Groups = append(result.Groups, gid)
+		}
+	}
+	return result, nil
+}
+
+// Parses a user in the UID:GID[:GROUP,...] form
+func parseUser(s string) (User, error) {
+	parts := strings.Split(s, ":")
+	if len(parts) < 2 || len(parts) > 3 {
+		return User{}, fmt.Errorf("invalid user %q, expected UID:GID[:GROUP,...]", s)
+	}
+	var result User
+	var err error
+	result.Uid, err = parseID(parts[0])
+	if err != nil {
+		return User{}, err
+	}
+	result.Gid, err = parseID(parts[1])
+	if err != nil {
+		return User{}, err
+	}
+	if len(parts) == 3 && parts[2] != "" {
+		for _, group := range strings.Split(parts[2], ",") {
+			gid, err := parseID(group)
+			if err != nil {
+				return User{}, err
+			}
+			result.Groups = append(result.Groups, gid)
+		}
+	}
+	return result, nil
+}
+
+// Parses a numeric user or group ID
+func parseID(s string) (uint32, error) {
+	id, err := strconv.ParseUint(s, 10, 32)
+	if err != nil {
+		return 0, fmt.Errorf("invalid user or group ID %q", s)
+	}
+	return uint32(id), nil
+}
+
+// Formats numbers of the user in the form accepted by parseUser
+func (u User) numbers() string {
+	groups := make([]string, len(u.Groups))
+	for i, gid := range u.Groups {
+		groups[i] = strconv.FormatUint(uint64(gid), 10)
+	}
+	return fmt.Sprintf("%d:%d:%s", u.Uid, u.Gid, strings.Join(groups, ","))
+}
+
+// Credentials that a process is started with
+func (u User) credential() *syscall.Credential {
+	return &syscall.Credential{Uid: u.Uid, Gid: u.Gid, Groups: u.Groups}
+}
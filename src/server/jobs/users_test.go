@@ -0,0 +1,62 @@
+package jobs
+
+import (
+	"os"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// Skips the test if the server cannot switch users
+func requireRoot(t *testing.T) {
+	if os.Geteuid() != 0 {
+		t.Skip("switching users requires root")
+	}
+}
+
+func TestLookupUser(t *testing.T) {
+	u, err := LookupUser("root")
+	assert.NoError(t, err)
+	assert.Equal(t, "root", u.Name)
+	assert.Equal(t, uint32(0), u.Uid)
+	assert.Equal(t, uint32(0), u.Gid)
+
+	u, err = LookupUser("1000:100:10,20")
+	assert.NoError(t, err)
+	assert.Equal(t, User{Uid: 1000, Gid: 100, Groups: []uint32{10, 20}}, u)
+	assert.Equal(t, "1000:100:10,20", u.numbers())
+
+	u, err = LookupUser("1000:100")
+	assert.NoError(t, err)
+	assert.Equal(t, User{Uid: 1000, Gid: 100}, u)
+	assert.Equal(t, "1000:100:", u.numbers())
+
+	for _, invalid := range []string{"1000", "1000:x", "1000:100:a", "1:2:3:4", "no-such-user"} {
+		_, err = LookupUser(invalid)
+		assert.Error(t, err, invalid)
+	}
+}
+
+func TestJobUser(t *testing.T) {
+	requireRoot(t)
+	user := &User{Principal: "team", Uid: 65534, Gid: 65534, Groups: []uint32{100}}
+	cmd := []string{"bash", "-c", "id -u; id -g; id -G"}
+	j, err := newJob(Spec{Command: cmd, User: user}, Config{}, nil)
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"65534", "65534", "65534 100"}, allLines(j))
+	assert.Equal(t, user, j.Status().Spec.User)
+}
+
+func TestJobIsolatedUser(t *testing.T) {
+	requireRoot(t)
+	requireNamespaces(t)
+	user := &User{Uid: 65534, Gid: 65534}
+	// init keeps running as root, only the command is started as the user
+	cmd := []string{"bash", "-c", "id -u; id -G; stat -c %u /proc/1"}
+	spec := Spec{Command: cmd, User: user, Isolation: Isolation{Namespaces: true}}
+	j, err := newJob(spec, Config{}, nil)
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"65534", "65534", "0"}, allLines(j))
+	<-j.killedSignal
+	assert.Equal(t, 0, j.Status().Stopped.ExitCode)
+}
@@ -0,0 +1,337 @@
+// Workflows - sets of jobs that depend on each other
+package jobs
+
+import (
+	"errors"
+	"log"
+	"slices"
+	"sync"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// The steps do not form a valid workflow
+var ErrInvalidWorkflow = errors.New("Invalid workflow")
+
+// The step did not start because the workflow was cancelled
+var ErrWorkflowCancelled = errors.New("Workflow was cancelled")
+
+// Type safe workflow identifier
+// Actually UUID
+type WorkflowID string
+
+// A named command of a workflow
+type Step struct {
+	Name string
+	// Steps that have to succeed before this one starts
+	DependsOn []string
+	Job       Spec
+}
+
+// Progress of a step
+type StepState int
+
+const (
+	// The step waits for its dependencies
+	StepWaiting StepState = iota
+	// The job of the step was created, it may still be queued
+	StepRunning
+	// The job exited with zero exit code
+	StepSucceeded
+	// The job failed or could not be created
+	StepFailed
+	// A dependency of the step did not succeed, the step never starts
+	StepSkipped
+)
+
+// Snapshot of the status of a step
+type StepStatus struct {
+	Step  Step
+	State StepState
+	// nil if the job was not created
+	Job *JobStatus
+	// Why the job could not be created
+	Error string
+}
+
+// Snapshot of the status of a workflow
+type WorkflowStatus struct {
+	ID      WorkflowID
+	Created time.Time
+	// Zero until all steps finished
+	Finished time.Time
+	// In the order of submission
+	Steps []StepStatus
+}
+
+// Starts jobs of its steps once their dependencies succeed
+type Workflow struct {
+	mutex    sync.Mutex
+	ID       WorkflowID
+	Created  time.Time
+	Finished time.Time
+	steps    []Step
+	// indexes of the steps, every step comes after its dependencies
+	order  []int
+	states []StepState
+	jobs   []*Job
+	errors []error
+	// creates jobs of the steps
+	create func(Spec) (*Job, error)
+}
+
+// Checks the steps and orders them so that every step comes after its dependencies.
+// Returns ErrInvalidWorkflow if names are not unique, a dependency does not exist or dependencies form a cycle.
+func orderSteps(steps []Step) ([]int, error) {
+	if len(steps) == 0 {
+		return nil, ErrInvalidWorkflow
+	}
+	indexes := make(map[string]int, len(steps))
+	for i, step := range steps {
+		if _, ok := indexes[step.Name]; ok || step.Name == "" {
+			return nil, ErrInvalidWorkflow
+		}
+		indexes[step.Name] = i
+	}
+	for _, step := range steps {
+		for _, dep := range step.DependsOn {
+			if _, ok := indexes[dep]; !ok {
+				return nil, ErrInvalidWorkflow
+			}
+		}
+	}
+	// depth first search, a step being visited again means a cycle
+	const (
+		unvisited = iota
+		visiting
+		visited
+	)
+	marks := make([]int, len(steps))
+	order := make([]int, 0, len(steps))
+	var visit func(i int) bool
+	visit = func(i int) bool {
+		switch marks[i] {
+		case visiting:
+			return false
+		case visited:
+			return true
+		}
+		marks[i] = visiting
+		for _, dep := range steps[i].DependsOn {
+			if !visit(indexes[dep]) {
+				return false
+			}
+		}
+		marks[i] = visited
+		order = append(order, i)
+		return true
+	}
+	for i := range steps {
+		if !visit(i) {
+			return nil, ErrInvalidWorkflow
+		}
+	}
+	return order, nil
+}
+
+// Creates a workflow and starts the steps without dependencies.
+// create is used for creating jobs of the steps.
+func newWorkflow(steps []Step, create func(Spec) (*Job, error)) (*Workflow, error) {
+	order, err := orderSteps(steps)
+	if err != nil {
+		return nil, err
+	}
+	w := &Workflow{
+		ID:      WorkflowID(uuid.New().String()),
+		Created: time.Now(),
+		steps:   slices.Clone(steps),
+		order:   order,
+		states:  make([]StepState, len(steps)),
+		jobs:    make([]*Job, len(steps)),
+		errors:  make([]error, len(steps)),
+		create:  create,
+	}
+	for i := range w.steps {
+		w.steps[i].Job.Workflow = w.ID
+	}
+	w.mutex.Lock()
+	defer w.mutex.Unlock()
+	w.advance()
+	return w, nil
+}
+
+// Starts the steps whose dependencies succeeded, skips the steps with a failed dependency.
+// NOT thread safe
+func (w *Workflow) advance() {
+	finished := true
+	for _, i := range w.order {
+		if w.states[i] == StepWaiting {
+			// dependencies come first, their states are already final in this pass
+			w.states[i] = w.ready(i)
+			if w.states[i] == StepRunning {
+				w.start(i)
+			}
+		}
+		if w.states[i] == StepWaiting || w.states[i] == StepRunning {
+			finished = false
+		}
+	}
+	if finished && w.Finished.IsZero() {
+		log.Println("Workflow", w.ID, "finished")
+		w.Finished = time.Now()
+	}
+}
+
+// Decides the state of a waiting step from the states of its dependencies.
+// NOT thread safe
+func (w *Workflow) ready(i int) StepState {
+	result := StepRunning
+	for _, dep := range w.steps[i].DependsOn {
+		j := slices.IndexFunc(w.steps, func(step Step) bool { return step.Name == dep })
+		switch w.states[j] {
+		case StepFailed, StepSkipped:
+			return StepSkipped
+		case StepWaiting, StepRunning:
+			result = StepWaiting
+		}
+	}
+	return result
+}
+
+// Creates the job of the step and follows it.
+// NOT thread safe
+func (w *Workflow) start(i int) {
+	log.Println("Workflow", w.ID, "starts step", w.steps[i].Name)
+	job, err := w.create(w.steps[i].Job)
+	if err != nil {
+		log.Println("Workflow", w.ID, "could not start step", w.steps[i].Name, err)
+		w.states[i] = StepFailed
+		w.errors[i] = err
+		return
+	}
+	w.jobs[i] = job
+	go w.track(i, job)
+}
+
+// Waits for the job of the step to finish and moves the workflow forward
+func (w *Workflow) track(i int, job *Job) {
+	<-job.killedSignal
+	stopped := job.Status().Stopped
+	w.mutex.Lock()
+	defer w.mutex.Unlock()
+	if stopped.ExitCode == 0 && stopped.Error == "" {
+		w.states[i] = StepSucceeded
+	} else {
+		w.states[i] = StepFailed
+	}
+	w.advance()
+}
+
+// Skips the steps that did not start yet, running steps finish on their own.
+// Thread safe
+func (w *Workflow) cancel() {
+	w.mutex.Lock()
+	defer w.mutex.Unlock()
+	for i, state := range w.states {
+		if state == StepWaiting {
+			w.states[i] = StepSkipped
+			w.errors[i] = ErrWorkflowCancelled
+		}
+	}
+	// finishes the workflow if no step is running
+	w.advance()
+}
+
+// Returns the principal that started the workflow, it owns jobs of all steps.
+// Thread safe
+func (w *Workflow) Owner() string {
+	// steps do not change after creation and there is at least one
+	return w.steps[0].Job.Owner
+}
+
+// Returns snapshot of status of the workflow and of jobs of its steps.
+// Thread safe
+func (w *Workflow) Status() WorkflowStatus {
+	w.mutex.Lock()
+	result := WorkflowStatus{ID: w.ID, Created: w.Created, Finished: w.Finished}
+	jobs := slices.Clone(w.jobs)
+	for i, step := range w.steps {
+		status := StepStatus{Step: step, State: w.states[i]}
+		if w.errors[i] != nil {
+			status.Error = w.errors[i].Error()
+		}
+		result.Steps = append(result.Steps, status)
+	}
+	w.mutex.Unlock()
+	// jobs lock themselves and may need the queue
+	for i, job := range jobs {
+		if job != nil {
+			status := job.Status()
+			result.Steps[i].Job = &status
+		}
+	}
+	return result
+}
+
+// Thread safe collection of workflows
+type Workflows struct {
+	workflows map[WorkflowID]*Workflow
+	jobs      *Jobs
+	mutex     sync.Mutex
+}
+
+// Creates an empty collection of workflows that create jobs in the given collection.
+// Finished workflows are removed in the background according to the retention policy of the jobs.
+func NewWorkflows(jobs *Jobs) *Workflows {
+	result := &Workflows{workflows: make(map[WorkflowID]*Workflow), jobs: jobs}
+	if jobs.config.Retention != (Retention{}) {
+		go result.collectPeriodically()
+	}
+	return result
+}
+
+// Creates a new workflow and starts the steps without dependencies.
+// Job specifications of all steps are checked before any of them starts.
+func (workflows *Workflows) Create(steps []Step) (*Workflow, error) {
+	for _, step := range steps {
+		err := workflows.jobs.check(step.Job)
+		if err != nil {
+			return nil, err
+		}
+	}
+	w, err := newWorkflow(steps, workflows.jobs.Create)
+	if err != nil {
+		return nil, err
+	}
+	workflows.mutex.Lock()
+	defer workflows.mutex.Unlock()
+	workflows.workflows[w.ID] = w
+	return w, nil
+}
+
+// Find returns a workflow by its ID.
+func (workflows *Workflows) Find(id WorkflowID) *Workflow {
+	workflows.mutex.Lock()
+	defer workflows.mutex.Unlock()
+	return workflows.workflows[id]
+}
+
+// Creates a snapshot of the current collection of the workflows.
+func (workflows *Workflows) List() []*Workflow {
+	workflows.mutex.Lock()
+	defer workflows.mutex.Unlock()
+	result := make([]*Workflow, 0, len(workflows.workflows))
+	for _, w := range workflows.workflows {
+		result = append(result, w)
+	}
+	return result
+}
+
+// Cancels all workflows, no more steps are started.
+// Jobs of running steps keep running.
+func (workflows *Workflows) CancelAll() {
+	for _, w := range workflows.List() {
+		w.cancel()
+	}
+}
@@ -0,0 +1,122 @@
+package jobs
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestOrderSteps(t *testing.T) {
+	steps := []Step{
+		{Name: "package", DependsOn: []string{"build", "test"}},
+		{Name: "test", DependsOn: []string{"build"}},
+		{Name: "build"},
+	}
+	order, err := orderSteps(steps)
+	assert.NoError(t, err)
+	assert.Equal(t, []int{2, 1, 0}, order)
+
+	for _, invalid := range [][]Step{
+		{},
+		{{Name: ""}},
+		{{Name: "build"}, {Name: "build"}},
+		{{Name: "test", DependsOn: []string{"build"}}},
+		{{Name: "a", DependsOn: []string{"b"}}, {Name: "b", DependsOn: []string{"a"}}},
+		{{Name: "a", DependsOn: []string{"a"}}},
+	} {
+		_, err := orderSteps(invalid)
+		assert.ErrorIs(t, err, ErrInvalidWorkflow)
+	}
+}
+
+// Waits until all steps of the workflow finish
+func waitWorkflow(t *testing.T, w *Workflow) WorkflowStatus {
+	assert.Eventually(t, func() bool { return !w.Status().Finished.IsZero() }, 5*time.Second, 10*time.Millisecond)
+	return w.Status()
+}
+
+func TestWorkflowSuccess(t *testing.T) {
+	js := NewJobs(nil, Config{})
+	defer js.KillAll()
+	workflows := NewWorkflows(js)
+	w, err := workflows.Create([]Step{
+		{Name: "package", DependsOn: []string{"test"}, Job: Spec{Command: []string{"echo", "package"}}},
+		{Name: "build", Job: Spec{Command: []string{"echo", "build"}}},
+		{Name: "test", DependsOn: []string{"build"}, Job: Spec{Command: []string{"echo", "test"}}},
+	})
+	assert.NoError(t, err)
+	assert.Same(t, w, workflows.Find(w.ID))
+
+	status := waitWorkflow(t, w)
+	// steps are reported in the order of submission
+	assert.Equal(t, "package", status.Steps[0].Step.Name)
+	assert.Equal(t, StepSucceeded, status.Steps[0].State)
+	assert.Equal(t, StepSucceeded, status.Steps[1].State)
+	assert.Equal(t, StepSucceeded, status.Steps[2].State)
+	build, test := status.Steps[1].Job, status.Steps[2].Job
+	assert.Equal(t, w.ID, build.Spec.Workflow)
+	// a step starts only after its dependencies finished
+	assert.False(t, test.Started.Before(build.Stopped.Stopped))
+}
+
+func TestWorkflowSkipsOnFailure(t *testing.T) {
+	js := NewJobs(nil, Config{})
+	defer js.KillAll()
+	workflows := NewWorkflows(js)
+	w, err := workflows.Create([]Step{
+		{Name: "build", Job: Spec{Command: []string{"false"}}},
+		{Name: "lint", Job: Spec{Command: []string{"true"}}},
+		{Name: "test", DependsOn: []string{"build"}, Job: Spec{Command: []string{"true"}}},
+		{Name: "package", DependsOn: []string{"test", "lint"}, Job: Spec{Command: []string{"true"}}},
+	})
+	assert.NoError(t, err)
+
+	status := waitWorkflow(t, w)
+	states := []StepState{}
+	for _, step := range status.Steps {
+		states = append(states, step.State)
+	}
+	assert.Equal(t, []StepState{StepFailed, StepSucceeded, StepSkipped, StepSkipped}, states)
+	assert.Nil(t, status.Steps[2].Job)
+	assert.Nil(t, status.Steps[3].Job)
+}
+
+func TestWorkflowStartFailure(t *testing.T) {
+	js := NewJobs(nil, Config{})
+	defer js.KillAll()
+	workflows := NewWorkflows(js)
+
+	// job specifications are checked up front
+	_, err := workflows.Create([]Step{{Name: "build", Job: Spec{}}})
+	assert.ErrorIs(t, err, ErrInvalidSpec)
+
+	w, err := workflows.Create([]Step{
+		{Name: "build", Job: Spec{Command: []string{"barambaram"}}},
+		{Name: "test", DependsOn: []string{"build"}, Job: Spec{Command: []string{"true"}}},
+	})
+	assert.NoError(t, err)
+	status := waitWorkflow(t, w)
+	assert.Equal(t, StepFailed, status.Steps[0].State)
+	assert.Contains(t, status.Steps[0].Error, "barambaram")
+	assert.Equal(t, StepSkipped, status.Steps[1].State)
+}
+
+func TestWorkflowCancelAll(t *testing.T) {
+	js := NewJobs(nil, Config{})
+	defer js.KillAll()
+	workflows := NewWorkflows(js)
+	w, err := workflows.Create([]Step{
+		{Name: "build", Job: Spec{Command: []string{"sleep", "0.2"}}},
+		{Name: "test", DependsOn: []string{"build"}, Job: Spec{Command: []string{"true"}}},
+	})
+	assert.NoError(t, err)
+
+	workflows.CancelAll()
+	status := waitWorkflow(t, w)
+	// the running step finishes, the following one does not start
+	assert.Equal(t, StepSucceeded, status.Steps[0].State)
+	assert.Equal(t, StepSkipped, status.Steps[1].State)
+	assert.Equal(t, ErrWorkflowCancelled.Error(), status.Steps[1].Error)
+	assert.Nil(t, status.Steps[1].Job)
+}
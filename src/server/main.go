@@ -7,18 +7,41 @@ import (
 	"fmt"
 	"log"
 
+	"github.com/szymonwieloch/go-teleport/server/jobs"
 	"github.com/szymonwieloch/go-teleport/server/service"
 )
 
 func main() {
+	// isolated jobs are started through the server binary
+	jobs.RunInit()
 	fmt.Println("Teleport server")
 	args := parseArgs()
+	// already validated
+	io, _ := args.ioLimits()
+	users, _ := args.users()
 	opts := service.ServiceOptions{
-		Address:  args.Address,
-		AuthKey:  args.AuthKey,
-		AuthCert: args.AuthCert,
-		Secret:   args.Secret,
-		Limits:   args.Limits,
+		Address:                args.Address,
+		AuthKey:                args.AuthKey,
+		AuthCert:               args.AuthCert,
+		Secret:                 args.Secret,
+		Principals:             args.Principals,
+		Limits:                 args.Limits,
+		EnvAllowlist:           args.EnvAllowlist,
+		StopGracePeriod:        args.StopGracePeriod,
+		LimitClasses:           args.limitClasses(),
+		DefaultLimitClass:      args.DefaultLimitClass,
+		MaxLimits:              jobs.Limits(*args.MaxLimits),
+		IO:                     io,
+		TotalPids:              args.TotalPids,
+		DefaultTimeouts:        jobs.Timeouts(args.DefaultTimeouts),
+		MaxTimeouts:            jobs.Timeouts(args.MaxTimeouts),
+		Users:                  users,
+		MaxRunning:             args.MaxRunning,
+		MaxRunningPerPrincipal: args.MaxRunningPerPrincipal,
+		Retention:              jobs.Retention(args.Retention),
+		StoreDir:               args.StoreDir,
+		LogDir:                 args.LogDir,
+		LogLimits:              jobs.LogLimits(args.LogLimits),
 	}
 	srv, err := service.NewService(opts)
 	if err != nil {
@@ -2,8 +2,11 @@ package main
 
 import (
 	"testing"
+	"time"
 
+	"github.com/alexflint/go-arg"
 	"github.com/stretchr/testify/assert"
+	"github.com/szymonwieloch/go-teleport/server/jobs"
 )
 
 func TestDefinedTogether(t *testing.T) {
@@ -14,3 +17,84 @@ func TestDefinedTogether(t *testing.T) {
 	assert.False(t, definedTogether("", "blah", "okay"))
 	assert.False(t, definedTogether("nope", "blah", ""))
 }
+
+func TestLimitsArg(t *testing.T) {
+	var args Args
+	parser, err := arg.NewParser(arg.Config{}, &args)
+	assert.NoError(t, err)
+	err = parser.Parse([]string{"--address", ":1234", "--limit-class", "tiny=memory=1M,pids=5", "--max-limits", "cpus=1.5"})
+	assert.NoError(t, err)
+	assert.Equal(t, map[string]jobs.Limits{"tiny": {Memory: 1 << 20, Pids: 5}}, args.limitClasses())
+	assert.Equal(t, jobs.Limits{CPUs: 1.5}, jobs.Limits(*args.MaxLimits))
+
+	err = parser.Parse([]string{"--address", ":1234", "--max-limits", "disk=1G"})
+	assert.Error(t, err)
+}
+
+func TestIOLimitsArg(t *testing.T) {
+	args := Args{IOWeight: 200, IOMax: map[string]string{"8:0": "rbps=1M", "8:16": "wiops=100"}}
+	io, err := args.ioLimits()
+	assert.NoError(t, err)
+	assert.Equal(t, jobs.IOLimits{
+		Weight: 200,
+		Devices: []jobs.DeviceIOLimits{
+			{Major: 8, Minor: 0, ReadBPS: 1 << 20},
+			{Major: 8, Minor: 16, WriteIOPS: 100},
+		},
+	}, io)
+
+	args.IOMax["/nonexistent"] = "rbps=1M"
+	_, err = args.ioLimits()
+	assert.Error(t, err)
+}
+
+func TestUsersArg(t *testing.T) {
+	args := Args{RunAs: map[string]string{"default": "root", "team": "1000:100:10"}}
+	users, err := args.users()
+	assert.NoError(t, err)
+	assert.Equal(t, "root", users["default"].Name)
+	assert.Equal(t, uint32(0), users["default"].Uid)
+	assert.Equal(t, jobs.User{Uid: 1000, Gid: 100, Groups: []uint32{10}}, users["team"])
+
+	args = Args{RunAs: map[string]string{"team": "1000"}}
+	_, err = args.users()
+	assert.Error(t, err)
+}
+
+func TestTimeoutsArg(t *testing.T) {
+	var args Args
+	parser, err := arg.NewParser(arg.Config{}, &args)
+	assert.NoError(t, err)
+	err = parser.Parse([]string{"--address", ":1234", "--default-timeouts", "runtime=1h", "--max-timeouts", "runtime=24h,idle=30m"})
+	assert.NoError(t, err)
+	assert.Equal(t, jobs.Timeouts{MaxRuntime: time.Hour}, jobs.Timeouts(args.DefaultTimeouts))
+	assert.Equal(t, jobs.Timeouts{MaxRuntime: 24 * time.Hour, IdleTimeout: 30 * time.Minute}, jobs.Timeouts(args.MaxTimeouts))
+
+	err = parser.Parse([]string{"--address", ":1234", "--max-timeouts", "runtime=forever"})
+	assert.Error(t, err)
+}
+
+func TestRetentionArg(t *testing.T) {
+	var args Args
+	parser, err := arg.NewParser(arg.Config{}, &args)
+	assert.NoError(t, err)
+	err = parser.Parse([]string{"--address", ":1234", "--retention", "age=12h,logs=100M"})
+	assert.NoError(t, err)
+	assert.Equal(t, jobs.Retention{MaxAge: 12 * time.Hour, MaxLogBytes: 100 << 20}, jobs.Retention(args.Retention))
+
+	err = parser.Parse([]string{"--address", ":1234", "--retention", "count=many"})
+	assert.Error(t, err)
+}
+
+func TestLogLimitsArg(t *testing.T) {
+	var args Args
+	parser, err := arg.NewParser(arg.Config{}, &args)
+	assert.NoError(t, err)
+	err = parser.Parse([]string{"--address", ":1234", "--log-dir", "/var/log/teleport", "--log-limits", "memory=64K,job=1G"})
+	assert.NoError(t, err)
+	assert.Equal(t, "/var/log/teleport", args.LogDir)
+	assert.Equal(t, jobs.LogLimits{Memory: 64 << 10, Job: 1 << 30}, jobs.LogLimits(args.LogLimits))
+
+	err = parser.Parse([]string{"--address", ":1234", "--log-limits", "memory=-1"})
+	assert.Error(t, err)
+}
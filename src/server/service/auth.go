@@ -11,7 +11,21 @@ import (
 	"google.golang.org/grpc/metadata"
 )
 
-func ensureValidToken(secret string) grpc.UnaryServerInterceptor {
+// Principal of clients that authenticate with the main secret or that are not authenticated at all
+const DefaultPrincipal = "default"
+
+// Key of the authenticated principal in the request context
+type principalKey struct{}
+
+// Returns the principal that authenticated the request
+func principal(ctx context.Context) string {
+	if p, ok := ctx.Value(principalKey{}).(string); ok {
+		return p
+	}
+	return DefaultPrincipal
+}
+
+func ensureValidToken(secrets map[string]string) grpc.UnaryServerInterceptor {
 	return func(ctx context.Context, req any, _ *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (any, error) {
 		md, ok := metadata.FromIncomingContext(ctx)
 		if !ok {
@@ -19,23 +33,62 @@ func ensureValidToken(secret string) grpc.UnaryServerInterceptor {
 		}
 		// The keys within metadata.MD are normalized to lowercase.
 		// See: https://godoc.org/google.golang.org/grpc/metadata#New
-		if !validSecret(md["authorization"], secret) {
+		p, ok := authenticate(md["authorization"], secrets)
+		if !ok {
 			return nil, errInvalidToken
 		}
 		// Continue execution of handler after ensuring a valid token.
-		return handler(ctx, req)
+		return handler(context.WithValue(ctx, principalKey{}, p), req)
 	}
 }
 
-func validSecret(authorization []string, secret string) bool {
+func ensureValidTokenStream(secrets map[string]string) grpc.StreamServerInterceptor {
+	return func(srv any, ss grpc.ServerStream, _ *grpc.StreamServerInfo, handler grpc.StreamHandler) error {
+		md, ok := metadata.FromIncomingContext(ss.Context())
+		if !ok {
+			return errMissingMetadata
+		}
+		p, ok := authenticate(md["authorization"], secrets)
+		if !ok {
+			return errInvalidToken
+		}
+		return handler(srv, principalStream{ServerStream: ss, ctx: context.WithValue(ss.Context(), principalKey{}, p)})
+	}
+}
+
+// Server stream that carries the authenticated principal in its context
+type principalStream struct {
+	grpc.ServerStream
+	ctx context.Context
+}
+
+func (stream principalStream) Context() context.Context {
+	return stream.ctx
+}
+
+// Finds the principal that the token belongs to, secrets map tokens to principals
+func authenticate(authorization []string, secrets map[string]string) (string, bool) {
 	if len(authorization) < 1 {
-		return false
+		return "", false
 	}
 	token := strings.TrimPrefix(authorization[0], "Bearer ")
 	// Perform the token validation here. For the sake of this example, the code
 	// here forgoes any of the usual OAuth2 token validation and instead checks
 	// for a token matching an arbitrary string.
-	return token == secret
+	p, ok := secrets[token]
+	return p, ok && token != ""
+}
+
+// Maps secrets of all principals to their names
+func secrets(args ServiceOptions) map[string]string {
+	result := make(map[string]string, len(args.Principals)+1)
+	if args.Secret != "" {
+		result[args.Secret] = DefaultPrincipal
+	}
+	for name, secret := range args.Principals {
+		result[secret] = name
+	}
+	return result
 }
 
 func configOAuth(opts []grpc.ServerOption, args ServiceOptions) ([]grpc.ServerOption, error) {
@@ -44,7 +97,9 @@ func configOAuth(opts []grpc.ServerOption, args ServiceOptions) ([]grpc.ServerOp
 		return nil, fmt.Errorf("failed to load key pair: %w", err)
 	}
 	return append(opts,
-		grpc.UnaryInterceptor(ensureValidToken(args.Secret)),
+		grpc.UnaryInterceptor(ensureValidToken(secrets(args))),
+		// streaming calls such as Logs or WriteStdin need to be authenticated too
+		grpc.StreamInterceptor(ensureValidTokenStream(secrets(args))),
 		grpc.Creds(credentials.NewServerTLSFromCert(&cert)),
 	), nil
 
@@ -10,4 +10,22 @@ var (
 	errInvalidToken         = status.Errorf(codes.Unauthenticated, "invalid token")
 	errCouldNotStartProcess = status.Error(codes.Internal, "could not start the process")
 	errIDNotFound           = status.Error(codes.NotFound, "id was not found")
+	errInvalidCommand       = status.Error(codes.InvalidArgument, "invalid command")
+	errMissingID            = status.Error(codes.InvalidArgument, "missing job id")
+	errNoStdin              = status.Error(codes.FailedPrecondition, "standard input of the job is not available")
+	errNoTerminal           = status.Error(codes.FailedPrecondition, "job does not have a terminal")
+	errInvalidSignal        = status.Error(codes.InvalidArgument, "invalid signal")
+	errInvalidGracePeriod   = status.Error(codes.InvalidArgument, "invalid grace period")
+	errNotRunning           = status.Error(codes.FailedPrecondition, "job is not running")
+	errMainExited           = status.Error(codes.FailedPrecondition, "main process of the job exited, signal the process group to reach its descendants")
+	errStillRunning         = status.Error(codes.FailedPrecondition, "job is still running, stop it first")
+	errQueued               = status.Error(codes.FailedPrecondition, "job is queued")
+	errUnknownLimitClass    = status.Error(codes.InvalidArgument, "unknown limit class")
+	errLimitsExceeded       = status.Error(codes.InvalidArgument, "limits exceed the server maximums")
+	errTimeoutsExceeded     = status.Error(codes.InvalidArgument, "timeouts exceed the server maximums")
+	errUnmappedPrincipal    = status.Error(codes.PermissionDenied, "no user is mapped to the principal")
+	errInvalidSchedule      = status.Error(codes.InvalidArgument, "invalid schedule")
+	errScheduleNotFound     = status.Error(codes.NotFound, "schedule was not found")
+	errInvalidWorkflow      = status.Error(codes.InvalidArgument, "invalid workflow")
+	errWorkflowNotFound     = status.Error(codes.NotFound, "workflow was not found")
 )
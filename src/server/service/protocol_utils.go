@@ -1,25 +1,81 @@
 package service
 
 import (
+	"math"
+	"strconv"
+	"strings"
+	"syscall"
+	"time"
+
 	"github.com/szymonwieloch/go-teleport/server/jobs"
 	"github.com/szymonwieloch/go-teleport/server/proto/teleportproto"
+	"golang.org/x/sys/unix"
+	"google.golang.org/protobuf/types/known/durationpb"
 	"google.golang.org/protobuf/types/known/timestamppb"
 )
 
 // Maps job status as reported by a job to the gRPC equivalent
 func jobStatus(status jobs.JobStatus) *teleportproto.JobStatus {
 	result := teleportproto.JobStatus{
-		Id:      &teleportproto.JobId{Uuid: string(status.ID)},
-		Started: timestamppb.New(status.Started),
-		Logs:    uint32(status.Logs),
-		Command: &teleportproto.Command{Command: status.Command},
+		Id:           &teleportproto.JobId{Uuid: string(status.ID)},
+		Submitted:    timestamppb.New(status.Submitted),
+		Logs:         uint32(status.Logs),
+		RetainedLogs: uint32(status.RetainedLogs),
+		Command:      command(status.Spec),
+	}
+	if !status.Started.IsZero() {
+		result.Started = timestamppb.New(status.Started)
+	}
+	if status.Limits != (jobs.Limits{}) {
+		result.Limits = limits(status.Limits)
+	}
+	result.MaxRuntime = duration(status.Timeouts.MaxRuntime)
+	result.IdleTimeout = duration(status.Timeouts.IdleTimeout)
+	result.Namespaces = status.Namespaces
+	for _, a := range status.Attempts {
+		result.Attempts = append(result.Attempts, &teleportproto.Attempt{
+			Started:   timestamppb.New(a.Started),
+			Stopped:   timestamppb.New(a.Stopped),
+			ErrorCode: int32(a.ExitCode),
+			FirstLog:  uint32(a.FirstLog),
+			Logs:      uint32(a.Logs),
+		})
+	}
+	if u := status.Spec.User; u != nil {
+		result.User = &teleportproto.User{
+			Principal: u.Principal,
+			Name:      u.Name,
+			Uid:       u.Uid,
+			Gid:       u.Gid,
+			Groups:    u.Groups,
+		}
+	}
+	if status.Spec.Schedule != "" {
+		result.ScheduleId = &teleportproto.ScheduleId{Uuid: string(status.Spec.Schedule)}
+	}
+	if status.Spec.Workflow != "" {
+		result.WorkflowId = &teleportproto.WorkflowId{Uuid: string(status.Spec.Workflow)}
 	}
 	if status.Stopped != nil {
-		result.Details = &teleportproto.JobStatus_Stopped{
-			Stopped: &teleportproto.StoppedJobStatus{
-				ErrorCode: int32(status.Stopped.ExitCode),
-				Stopped:   timestamppb.New(status.Stopped.Stopped),
-			},
+		stopped := &teleportproto.StoppedJobStatus{
+			ErrorCode:   int32(status.Stopped.ExitCode),
+			Stopped:     timestamppb.New(status.Stopped.Stopped),
+			Termination: termination(status.Stopped.Termination),
+			Timeout:     timeout(status.Stopped.Timeout),
+			Error:       status.Stopped.Error,
+			Signal:      signalName(status.Stopped.Signal),
+			CoreDumped:  status.Stopped.CoreDumped,
+			OomKilled:   status.Stopped.OOMKilled,
+			Reason:      stopReason(status.Stopped.Reason),
+			WaitError:   status.Stopped.WaitError,
+		}
+		for _, code := range status.Stopped.StageExitCodes {
+			stopped.StageErrorCodes = append(stopped.StageErrorCodes, int32(code))
+		}
+		result.Details = &teleportproto.JobStatus_Stopped{Stopped: stopped}
+	} else if status.Queued != nil {
+		result.Details = &teleportproto.JobStatus_Queued{
+			Queued: &teleportproto.QueuedJobStatus{Position: uint32(status.Queued.Position)},
 		}
 	} else {
 		result.Details = &teleportproto.JobStatus_Pending{
@@ -33,3 +89,395 @@ func jobStatus(status jobs.JobStatus) *teleportproto.JobStatus {
 	return &result
 
 }
+
+// Maps job specification to the gRPC command.
+// Values of environment variables are redacted, the command is visible to other callers.
+func command(spec jobs.Spec) *teleportproto.Command {
+	spec = spec.Redacted()
+	result := teleportproto.Command{
+		Command:    spec.Command,
+		Env:        spec.Env,
+		WorkingDir: spec.Dir,
+		Stdin:      spec.Stdin,
+		Tty:        spec.Tty,
+		Raw:        spec.Raw,
+	}
+	if spec.WindowSize != (jobs.WindowSize{}) {
+		result.WindowSize = windowSize(spec.WindowSize)
+	}
+	if spec.CleanEnv {
+		result.EnvPolicy = teleportproto.EnvPolicy_EP_CLEAN
+	}
+	result.LimitClass = spec.LimitClass
+	if spec.Limits != (jobs.Limits{}) {
+		result.Limits = limits(spec.Limits)
+	}
+	if spec.Isolation != (jobs.Isolation{}) {
+		result.Isolation = isolation(spec.Isolation)
+	}
+	result.MaxRuntime = duration(spec.Timeouts.MaxRuntime)
+	result.IdleTimeout = duration(spec.Timeouts.IdleTimeout)
+	if spec.Restart != (jobs.Restart{}) {
+		result.Restart = restart(spec.Restart)
+	}
+	result.Priority = int32(spec.Priority)
+	for _, stage := range spec.Pipeline {
+		result.Pipeline = append(result.Pipeline, &teleportproto.Stage{Command: stage})
+	}
+	return &result
+}
+
+// Maps the gRPC command to the job specification
+func jobSpec(cmd *teleportproto.Command) jobs.Spec {
+	return jobs.Spec{
+		Command:    cmd.Command,
+		Pipeline:   jobPipeline(cmd.Pipeline),
+		Env:        cmd.Env,
+		Dir:        cmd.WorkingDir,
+		CleanEnv:   cmd.EnvPolicy == teleportproto.EnvPolicy_EP_CLEAN,
+		Stdin:      cmd.Stdin,
+		Tty:        cmd.Tty,
+		Raw:        cmd.Raw,
+		WindowSize: jobWindowSize(cmd.WindowSize),
+		LimitClass: cmd.LimitClass,
+		Limits:     jobLimits(cmd.Limits),
+		Isolation:  jobIsolation(cmd.Isolation),
+		Timeouts: jobs.Timeouts{
+			MaxRuntime:  cmd.MaxRuntime.AsDuration(),
+			IdleTimeout: cmd.IdleTimeout.AsDuration(),
+		},
+		Restart:  jobRestart(cmd.Restart),
+		Priority: int(cmd.Priority),
+	}
+}
+
+// Maps stages of a pipeline to their commands, nil if there are none
+func jobPipeline(stages []*teleportproto.Stage) [][]string {
+	var result [][]string
+	for _, stage := range stages {
+		result = append(result, stage.Command)
+	}
+	return result
+}
+
+// Maps schedule status to the gRPC equivalent
+func scheduleStatus(status jobs.ScheduleStatus) *teleportproto.ScheduleStatus {
+	result := teleportproto.ScheduleStatus{
+		Id:      &teleportproto.ScheduleId{Uuid: string(status.ID)},
+		Request: scheduleRequest(status.Spec),
+		Created: timestamppb.New(status.Created),
+		Paused:  status.Paused,
+	}
+	if !status.Next.IsZero() {
+		result.NextRun = timestamppb.New(status.Next)
+	}
+	for _, run := range status.Runs {
+		r := &teleportproto.ScheduledRun{
+			Planned: timestamppb.New(run.Planned),
+			Started: timestamppb.New(run.Started),
+			Error:   run.Error,
+		}
+		if run.JobID != "" {
+			r.JobId = &teleportproto.JobId{Uuid: string(run.JobID)}
+		}
+		result.Runs = append(result.Runs, r)
+	}
+	return &result
+}
+
+// Maps schedule specification to the gRPC schedule request
+func scheduleRequest(spec jobs.ScheduleSpec) *teleportproto.ScheduleRequest {
+	result := teleportproto.ScheduleRequest{Command: command(spec.Job)}
+	if spec.Cron != "" {
+		result.When = &teleportproto.ScheduleRequest_Cron{Cron: spec.Cron}
+	} else {
+		result.When = &teleportproto.ScheduleRequest_RunAt{RunAt: timestamppb.New(spec.RunAt)}
+	}
+	if spec.Missed == jobs.MissedRunOnce {
+		result.Missed = teleportproto.MissedRunPolicy_MR_RUN_ONCE
+	}
+	return &result
+}
+
+// Maps the gRPC schedule request to the schedule specification.
+// Returns gRPC errors.
+func jobScheduleSpec(req *teleportproto.ScheduleRequest) (jobs.ScheduleSpec, error) {
+	result := jobs.ScheduleSpec{Job: jobSpec(req.Command)}
+	switch when := req.When.(type) {
+	case *teleportproto.ScheduleRequest_Cron:
+		result.Cron = when.Cron
+	case *teleportproto.ScheduleRequest_RunAt:
+		if when.RunAt.CheckValid() != nil {
+			return result, errInvalidSchedule
+		}
+		result.RunAt = when.RunAt.AsTime()
+	default:
+		return result, errInvalidSchedule
+	}
+	switch req.Missed {
+	case teleportproto.MissedRunPolicy_MR_SKIP:
+		result.Missed = jobs.MissedSkip
+	case teleportproto.MissedRunPolicy_MR_RUN_ONCE:
+		result.Missed = jobs.MissedRunOnce
+	default:
+		return result, errInvalidSchedule
+	}
+	return result, nil
+}
+
+// Maps workflow status to the gRPC equivalent
+func workflowStatus(status jobs.WorkflowStatus) *teleportproto.WorkflowStatus {
+	result := teleportproto.WorkflowStatus{
+		Id:      &teleportproto.WorkflowId{Uuid: string(status.ID)},
+		Created: timestamppb.New(status.Created),
+	}
+	if !status.Finished.IsZero() {
+		result.Finished = timestamppb.New(status.Finished)
+	}
+	for _, step := range status.Steps {
+		s := &teleportproto.StepStatus{
+			Step: &teleportproto.WorkflowStep{
+				Name:      step.Step.Name,
+				DependsOn: step.Step.DependsOn,
+				Command:   command(step.Step.Job),
+			},
+			State: stepState(step.State),
+			Error: step.Error,
+		}
+		if step.Job != nil {
+			s.Job = jobStatus(*step.Job)
+		}
+		result.Steps = append(result.Steps, s)
+	}
+	return &result
+}
+
+// Maps the state of a workflow step to the gRPC equivalent
+func stepState(state jobs.StepState) teleportproto.StepState {
+	switch state {
+	case jobs.StepRunning:
+		return teleportproto.StepState_S_RUNNING
+	case jobs.StepSucceeded:
+		return teleportproto.StepState_S_SUCCEEDED
+	case jobs.StepFailed:
+		return teleportproto.StepState_S_FAILED
+	case jobs.StepSkipped:
+		return teleportproto.StepState_S_SKIPPED
+	default:
+		return teleportproto.StepState_S_WAITING
+	}
+}
+
+// Maps the restart policy of a job to the gRPC equivalent
+func restart(r jobs.Restart) *teleportproto.Restart {
+	result := teleportproto.Restart{
+		MaxRetries: uint32(r.MaxRetries),
+		Backoff:    duration(r.Backoff),
+		MaxBackoff: duration(r.MaxBackoff),
+	}
+	switch r.Policy {
+	case jobs.RestartOnFailure:
+		result.Policy = teleportproto.RestartPolicy_RP_ON_FAILURE
+	case jobs.RestartAlways:
+		result.Policy = teleportproto.RestartPolicy_RP_ALWAYS
+	}
+	return &result
+}
+
+// Maps the gRPC restart policy to the job restart policy, nil means no restarts
+func jobRestart(r *teleportproto.Restart) jobs.Restart {
+	if r == nil {
+		return jobs.Restart{}
+	}
+	result := jobs.Restart{
+		MaxRetries: int(min(r.MaxRetries, math.MaxInt32)),
+		Backoff:    r.Backoff.AsDuration(),
+		MaxBackoff: r.MaxBackoff.AsDuration(),
+	}
+	switch r.Policy {
+	case teleportproto.RestartPolicy_RP_NEVER:
+		result.Policy = jobs.RestartNever
+	case teleportproto.RestartPolicy_RP_ON_FAILURE:
+		result.Policy = jobs.RestartOnFailure
+	case teleportproto.RestartPolicy_RP_ALWAYS:
+		result.Policy = jobs.RestartAlways
+	default:
+		// rejected by the validation
+		result.Policy = jobs.RestartPolicy(r.Policy)
+	}
+	return result
+}
+
+// Maps a timeout to the gRPC duration, zero means no timeout and is not set
+func duration(d time.Duration) *durationpb.Duration {
+	if d == 0 {
+		return nil
+	}
+	return durationpb.New(d)
+}
+
+// Maps isolation of a job to the gRPC equivalent
+func isolation(i jobs.Isolation) *teleportproto.Isolation {
+	result := teleportproto.Isolation{Namespaces: i.Namespaces}
+	if i.Network == jobs.NetworkNone {
+		result.Network = teleportproto.Network_N_NONE
+	}
+	return &result
+}
+
+// Maps the gRPC isolation to the job isolation, nil means no isolation
+func jobIsolation(i *teleportproto.Isolation) jobs.Isolation {
+	if i == nil {
+		return jobs.Isolation{}
+	}
+	result := jobs.Isolation{Namespaces: i.Namespaces}
+	switch i.Network {
+	case teleportproto.Network_N_HOST:
+		result.Network = jobs.NetworkHost
+	case teleportproto.Network_N_NONE:
+		result.Network = jobs.NetworkNone
+	default:
+		// rejected by the validation
+		result.Network = jobs.Network(i.Network)
+	}
+	return result
+}
+
+// Maps resource limits to the gRPC equivalent
+func limits(l jobs.Limits) *teleportproto.Limits {
+	return &teleportproto.Limits{Memory: l.Memory, Cpus: l.CPUs, Pids: l.Pids}
+}
+
+// Maps the gRPC resource limits to the job limits, nil means no explicit limits
+func jobLimits(l *teleportproto.Limits) jobs.Limits {
+	if l == nil {
+		return jobs.Limits{}
+	}
+	return jobs.Limits{Memory: l.Memory, CPUs: l.Cpus, Pids: l.Pids}
+}
+
+// Maps the terminal window size to the gRPC equivalent
+func windowSize(size jobs.WindowSize) *teleportproto.WindowSize {
+	return &teleportproto.WindowSize{Rows: uint32(size.Rows), Cols: uint32(size.Cols)}
+}
+
+// Maps the gRPC window size to the terminal window size, nil means the default size
+func jobWindowSize(size *teleportproto.WindowSize) jobs.WindowSize {
+	if size == nil {
+		return jobs.WindowSize{}
+	}
+	return jobs.WindowSize{Rows: uint16(min(size.Rows, math.MaxUint16)), Cols: uint16(min(size.Cols, math.MaxUint16))}
+}
+
+// Maps the termination step to the gRPC equivalent
+func termination(t jobs.Termination) teleportproto.Termination {
+	switch t {
+	case jobs.TerminationSignal:
+		return teleportproto.Termination_T_SIGNAL
+	case jobs.TerminationKill:
+		return teleportproto.Termination_T_KILL
+	case jobs.TerminationCancel:
+		return teleportproto.Termination_T_CANCEL
+	case jobs.TerminationLost:
+		return teleportproto.Termination_T_LOST
+	default:
+		return teleportproto.Termination_T_EXIT
+	}
+}
+
+// Maps the reason of stopping a job to the gRPC equivalent
+func stopReason(r jobs.StopReason) teleportproto.StopReason {
+	switch r {
+	case jobs.StopReasonUser:
+		return teleportproto.StopReason_SR_USER
+	case jobs.StopReasonTimeout:
+		return teleportproto.StopReason_SR_TIMEOUT
+	case jobs.StopReasonShutdown:
+		return teleportproto.StopReason_SR_SHUTDOWN
+	default:
+		return teleportproto.StopReason_SR_NONE
+	}
+}
+
+// Name of the signal without the SIG prefix, the number if the signal has no name, empty if zero
+func signalName(sig syscall.Signal) string {
+	if sig == 0 {
+		return ""
+	}
+	name := unix.SignalName(sig)
+	if name == "" {
+		return strconv.Itoa(int(sig))
+	}
+	return strings.TrimPrefix(name, "SIG")
+}
+
+// Maps the timeout that stopped a job to the gRPC equivalent
+func timeout(t jobs.Timeout) teleportproto.Timeout {
+	switch t {
+	case jobs.TimeoutRuntime:
+		return teleportproto.Timeout_TO_RUNTIME
+	case jobs.TimeoutIdle:
+		return teleportproto.Timeout_TO_IDLE
+	default:
+		return teleportproto.Timeout_TO_NONE
+	}
+}
+
+// Maps the gRPC stop request to the stop options.
+// Returns gRPC errors.
+func stopOptions(req *teleportproto.StopRequest) (jobs.StopOptions, error) {
+	var opts jobs.StopOptions
+	if req.Signal != "" {
+		sig, err := jobs.ParseSignal(req.Signal)
+		if err != nil {
+			return opts, errInvalidSignal
+		}
+		opts.Signal = sig
+	}
+	if req.GracePeriod != nil {
+		err := req.GracePeriod.CheckValid()
+		if err != nil || req.GracePeriod.AsDuration() < 0 {
+			return opts, errInvalidGracePeriod
+		}
+		opts.GracePeriod = req.GracePeriod.AsDuration()
+	}
+	return opts, nil
+}
+
+// Maps the gRPC request of logs to the query of the jobs package
+func logQuery(req *teleportproto.LogsRequest) jobs.LogQuery {
+	query := jobs.LogQuery{
+		Start:  int(min(req.Start, math.MaxInt)),
+		Tail:   int(req.Tail),
+		Follow: !req.NoFollow,
+		Stdout: req.Filter == teleportproto.LogFilter_LF_STDOUT,
+		Stderr: req.Filter == teleportproto.LogFilter_LF_STDERR,
+	}
+	if req.Since != nil {
+		query.Since = req.Since.AsTime()
+	}
+	if req.Until != nil {
+		query.Until = req.Until.AsTime()
+	}
+	return query
+}
+
+// Maps a log entry to the gRPC message
+func logMessage(entry jobs.LogEntry) *teleportproto.Log {
+	if entry.Dropped > 0 {
+		// a marker has neither a source nor a time
+		return &teleportproto.Log{Src: teleportproto.LogSource_LS_STDOUT, Dropped: uint32(entry.Dropped), Sequence: uint64(entry.Index)}
+	}
+	src := teleportproto.LogSource_LS_STDERR
+	if entry.Stdout {
+		src = teleportproto.LogSource_LS_STDOUT
+	}
+	return &teleportproto.Log{
+		Text:      entry.Line,
+		Src:       src,
+		Timestamp: timestamppb.New(entry.Timestamp),
+		Data:      entry.Data,
+		Offset:    uint64(entry.Offset),
+		Sequence:  uint64(entry.Index),
+	}
+}
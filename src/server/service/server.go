@@ -4,39 +4,122 @@ package service
 import (
 	"context"
 	"fmt"
+	"io"
 	"log"
 
-	"github.com/containerd/cgroups/v3/cgroup2"
 	"github.com/golang/protobuf/ptypes/empty"
 	"github.com/szymonwieloch/go-teleport/server/jobs"
 	"github.com/szymonwieloch/go-teleport/server/proto/teleportproto"
 	"google.golang.org/grpc"
 	"google.golang.org/grpc/codes"
 	"google.golang.org/grpc/status"
-	"google.golang.org/protobuf/types/known/timestamppb"
 )
 
 // The main server type
 type server struct {
 	teleportproto.UnimplementedRemoteExecutorServer
-	jobs *jobs.Jobs
+	jobs      *jobs.Jobs
+	schedules *jobs.Schedules
+	workflows *jobs.Workflows
+	// Unix users of principals
+	users map[string]jobs.User
 }
 
 // Creates a new instant of a server
 func newServer(args ServiceOptions) (*server, error) {
-	var cg *cgroup2.Manager
+	var slice *jobs.Slice
 	var err error
 	if args.Limits {
-		cg, err = jobs.GetOrCreateGroup()
+		slice, err = jobs.GetOrCreateGroup(args.TotalPids)
 		if err != nil {
 			return nil, fmt.Errorf("could not create cgroup: %w", err)
 		}
 	}
-	j := jobs.NewJobs(cg)
-	return &server{jobs: j}, nil
+	config := jobs.Config{
+		EnvAllowlist:       args.EnvAllowlist,
+		StopGracePeriod:    args.StopGracePeriod,
+		LimitClasses:       args.LimitClasses,
+		DefaultLimitClass:  args.DefaultLimitClass,
+		MaxLimits:          args.MaxLimits,
+		IO:                 args.IO,
+		DefaultTimeouts:    args.DefaultTimeouts,
+		MaxTimeouts:        args.MaxTimeouts,
+		MaxRunning:         args.MaxRunning,
+		MaxRunningPerOwner: args.MaxRunningPerPrincipal,
+		Retention:          args.Retention,
+	}
+	config.LogLimits = args.LogLimits
+	if args.LogDir != "" {
+		config.Logs, err = jobs.NewLogStorage(args.LogDir, args.LogLimits)
+		if err != nil {
+			return nil, err
+		}
+	}
+	if args.StoreDir != "" {
+		config.Store, err = jobs.NewFileStore(args.StoreDir)
+		if err != nil {
+			return nil, err
+		}
+	}
+	j := jobs.NewJobs(slice, config)
+	err = j.Restore()
+	if err != nil {
+		return nil, err
+	}
+	return &server{
+		jobs:      j,
+		schedules: jobs.NewSchedules(j),
+		workflows: jobs.NewWorkflows(j),
+		users:     args.Users,
+	}, nil
+}
+
+// Finds the Unix user that jobs of the calling principal run as, nil if users are not mapped
+func (s *server) user(ctx context.Context) (*jobs.User, error) {
+	if len(s.users) == 0 {
+		return nil, nil
+	}
+	p := principal(ctx)
+	user, ok := s.users[p]
+	if !ok {
+		return nil, errUnmappedPrincipal
+	}
+	user.Principal = p
+	return &user, nil
+}
+
+// Finds a job of the calling principal.
+// Jobs of other principals are reported as not found, so that their IDs can not be probed.
+func (s *server) findJob(ctx context.Context, id string) (*jobs.Job, error) {
+	job := s.jobs.Find(jobs.JobID(id))
+	if job == nil || job.Spec.Owner != principal(ctx) {
+		return nil, errIDNotFound
+	}
+	return job, nil
+}
+
+// Finds a schedule of the calling principal, schedules of other principals are reported as not found
+func (s *server) findSchedule(ctx context.Context, id string) (*jobs.Schedule, error) {
+	schedule := s.schedules.Find(jobs.ScheduleID(id))
+	if schedule == nil || schedule.Spec.Job.Owner != principal(ctx) {
+		return nil, errScheduleNotFound
+	}
+	return schedule, nil
+}
+
+// Finds a workflow of the calling principal, workflows of other principals are reported as not found
+func (s *server) findWorkflow(ctx context.Context, id string) (*jobs.Workflow, error) {
+	workflow := s.workflows.Find(jobs.WorkflowID(id))
+	if workflow == nil || workflow.Owner() != principal(ctx) {
+		return nil, errWorkflowNotFound
+	}
+	return workflow, nil
 }
 
 func (s *server) Close() {
+	// no new jobs may be started while killing the old ones
+	s.schedules.StopAll()
+	s.workflows.CancelAll()
 	s.jobs.KillAll()
 }
 
@@ -45,16 +128,34 @@ var _ teleportproto.RemoteExecutorServer = (*server)(nil)
 
 func (s *server) Start(ctx context.Context, req *teleportproto.Command) (*teleportproto.JobStatus, error) {
 	log.Println("Starting command", req.Command)
-	job, err := s.jobs.Create(req.Command)
+	spec := jobSpec(req)
+	spec.Owner = principal(ctx)
+	var err error
+	spec.User, err = s.user(ctx)
 	if err != nil {
-		return nil, errCouldNotStartProcess
+		return nil, err
+	}
+	job, err := s.jobs.Create(spec)
+	if err != nil {
+		return nil, specError(err)
 	}
 	return jobStatus(job.Status()), nil
 }
 
-func (s *server) Stop(ctx context.Context, req *teleportproto.JobId) (*teleportproto.JobStatus, error) {
-	log.Println("Stopping job", req.Uuid)
-	job, err := s.jobs.Stop(jobs.JobID(req.Uuid))
+func (s *server) Stop(ctx context.Context, req *teleportproto.StopRequest) (*teleportproto.JobStatus, error) {
+	if req.Id == nil {
+		return nil, errMissingID
+	}
+	log.Println("Stopping job", req.Id.Uuid)
+	opts, err := stopOptions(req)
+	if err != nil {
+		return nil, err
+	}
+	_, err = s.findJob(ctx, req.Id.Uuid)
+	if err != nil {
+		return nil, err
+	}
+	job, err := s.jobs.Stop(jobs.JobID(req.Id.Uuid), opts)
 	if err != nil {
 		if err == jobs.ErrNotFound {
 			return nil, errIDNotFound
@@ -66,52 +167,335 @@ func (s *server) Stop(ctx context.Context, req *teleportproto.JobId) (*teleportp
 
 }
 
+func (s *server) Signal(ctx context.Context, req *teleportproto.SignalRequest) (*teleportproto.JobStatus, error) {
+	if req.Id == nil {
+		return nil, errMissingID
+	}
+	log.Println("Sending signal", req.Signal, "to job", req.Id.Uuid)
+	sig, err := jobs.ParseSignal(req.Signal)
+	if err != nil {
+		return nil, errInvalidSignal
+	}
+	job, err := s.findJob(ctx, req.Id.Uuid)
+	if err != nil {
+		return nil, err
+	}
+	err = job.Signal(sig, req.Group)
+	if err != nil {
+		if err == jobs.ErrNotRunning {
+			return nil, errNotRunning
+		}
+		if err == jobs.ErrMainExited {
+			return nil, errMainExited
+		}
+		if err == jobs.ErrQueued {
+			return nil, errQueued
+		}
+		return nil, status.Error(codes.Internal, err.Error())
+	}
+	return jobStatus(job.Status()), nil
+}
+
 func (s *server) List(ctx context.Context, req *empty.Empty) (*teleportproto.JobList, error) {
 	log.Println("Listing jobs")
 	jobs := s.jobs.List()
 	output := make([]*teleportproto.JobStatus, 0, len(jobs))
 	for _, job := range jobs {
+		if job.Spec.Owner != principal(ctx) {
+			continue
+		}
 		output = append(output, jobStatus(job.Status()))
 	}
 	return &teleportproto.JobList{Jobs: output}, nil
 }
 
-func (s *server) Logs(req *teleportproto.JobId, srv grpc.ServerStreamingServer[teleportproto.Log]) error {
-	log.Println("Showing logs for job", req.Uuid)
-	job := s.jobs.Find(jobs.JobID(req.Uuid))
-	if job == nil {
-		return errIDNotFound
+func (s *server) Logs(req *teleportproto.LogsRequest, srv grpc.ServerStreamingServer[teleportproto.Log]) error {
+	log.Println("Showing logs for job", req.GetId().GetUuid())
+	job, err := s.findJob(srv.Context(), req.GetId().GetUuid())
+	if err != nil {
+		return err
 	}
-	position := 0
+	return job.ReadLogs(logQuery(req), func(entry jobs.LogEntry) error {
+		return srv.Send(logMessage(entry))
+	})
+}
+
+func (s *server) GetStatus(ctx context.Context, req *teleportproto.JobId) (*teleportproto.JobStatus, error) {
+	log.Println("Showing status for job", req.Uuid)
+	job, err := s.findJob(ctx, req.Uuid)
+	if err != nil {
+		return nil, err
+	}
+	return jobStatus(job.Status()), nil
+}
+
+func (s *server) Remove(ctx context.Context, req *teleportproto.JobId) (*teleportproto.JobStatus, error) {
+	log.Println("Removing job", req.Uuid)
+	_, err := s.findJob(ctx, req.Uuid)
+	if err != nil {
+		return nil, err
+	}
+	job, err := s.jobs.Remove(jobs.JobID(req.Uuid))
+	switch err {
+	case nil:
+		return jobStatus(job.Status()), nil
+	case jobs.ErrNotFound:
+		return nil, errIDNotFound
+	case jobs.ErrRunning:
+		return nil, errStillRunning
+	default:
+		return nil, status.Error(codes.Internal, err.Error())
+	}
+}
+
+func (s *server) WriteStdin(srv grpc.ClientStreamingServer[teleportproto.StdinChunk, empty.Empty]) error {
+	var job *jobs.Job
 	for {
-		logs := job.GetLogs(position, 10)
-		if len(logs) == 0 {
-			return nil
-		}
-		position += len(logs)
-		for _, log := range logs {
-			src := teleportproto.LogSource_LS_STDERR
-			if log.Stdout {
-				src = teleportproto.LogSource_LS_STDOUT
+		chunk, err := srv.Recv()
+		if err == io.EOF {
+			return srv.SendAndClose(&empty.Empty{})
+		} else if err != nil {
+			return err
+		}
+		if job == nil {
+			if chunk.Id == nil {
+				return errMissingID
+			}
+			log.Println("Writing standard input of job", chunk.Id.Uuid)
+			job, err = s.findJob(srv.Context(), chunk.Id.Uuid)
+			if err != nil {
+				return err
+			}
+		}
+		if len(chunk.Data) > 0 {
+			err = job.WriteStdin(chunk.Data)
+			if err != nil {
+				return inputError(err)
+			}
+		}
+		if chunk.Eof {
+			err = job.CloseStdin()
+			if err != nil {
+				return inputError(err)
+			}
+		}
+	}
+}
+
+func (s *server) Attach(srv grpc.BidiStreamingServer[teleportproto.AttachInput, teleportproto.AttachOutput]) error {
+	first, err := srv.Recv()
+	if err != nil {
+		return err
+	}
+	if first.GetId() == nil {
+		return errMissingID
+	}
+	log.Println("Attaching to job", first.GetId().Uuid)
+	job, err := s.findJob(srv.Context(), first.GetId().Uuid)
+	if err != nil {
+		return err
+	}
+	output, detach, err := job.Attach()
+	if err != nil {
+		return inputError(err)
+	}
+	defer detach()
+
+	// input is handled in the background, output in this goroutine
+	inputErr := make(chan error, 1)
+	go func() {
+		for {
+			in, err := srv.Recv()
+			if err == io.EOF {
+				// client does not send anything more, but still receives the output
+				return
+			} else if err != nil {
+				inputErr <- err
+				return
 			}
-			msg := &teleportproto.Log{
-				Text:      log.Line,
-				Src:       src,
-				Timestamp: timestamppb.New(log.Timestamp),
+			switch input := in.Input.(type) {
+			case *teleportproto.AttachInput_Data:
+				err = job.WriteStdin(input.Data)
+			case *teleportproto.AttachInput_Resize:
+				err = job.ResizeTerminal(jobWindowSize(input.Resize))
 			}
-			err := srv.Send(msg)
+			if err != nil {
+				inputErr <- inputError(err)
+				return
+			}
+		}
+	}()
+
+	for {
+		select {
+		case data, ok := <-output:
+			if !ok {
+				// terminal got closed
+				return nil
+			}
+			err = srv.Send(&teleportproto.AttachOutput{Data: data})
 			if err != nil {
 				return err
 			}
+		case err = <-inputErr:
+			return err
 		}
 	}
 }
 
-func (s *server) GetStatus(ctx context.Context, req *teleportproto.JobId) (*teleportproto.JobStatus, error) {
-	log.Println("Showing status for job", req.Uuid)
-	job := s.jobs.Find(jobs.JobID(req.Uuid))
-	if job == nil {
-		return nil, errIDNotFound
+func (s *server) Schedule(ctx context.Context, req *teleportproto.ScheduleRequest) (*teleportproto.ScheduleStatus, error) {
+	if req.Command == nil {
+		return nil, errInvalidCommand
 	}
-	return jobStatus(job.Status()), nil
+	log.Println("Scheduling command", req.Command.Command)
+	spec, err := jobScheduleSpec(req)
+	if err != nil {
+		return nil, err
+	}
+	// jobs of the schedule run as the user of the principal that created it
+	spec.Job.Owner = principal(ctx)
+	spec.Job.User, err = s.user(ctx)
+	if err != nil {
+		return nil, err
+	}
+	schedule, err := s.schedules.Create(spec)
+	if err != nil {
+		if err == jobs.ErrInvalidSchedule {
+			return nil, errInvalidSchedule
+		}
+		return nil, specError(err)
+	}
+	return scheduleStatus(schedule.Status()), nil
+}
+
+func (s *server) ListSchedules(ctx context.Context, req *empty.Empty) (*teleportproto.ScheduleList, error) {
+	log.Println("Listing schedules")
+	schedules := s.schedules.List()
+	output := make([]*teleportproto.ScheduleStatus, 0, len(schedules))
+	for _, schedule := range schedules {
+		if schedule.Spec.Job.Owner != principal(ctx) {
+			continue
+		}
+		output = append(output, scheduleStatus(schedule.Status()))
+	}
+	return &teleportproto.ScheduleList{Schedules: output}, nil
+}
+
+func (s *server) GetSchedule(ctx context.Context, req *teleportproto.ScheduleId) (*teleportproto.ScheduleStatus, error) {
+	log.Println("Showing status for schedule", req.Uuid)
+	schedule, err := s.findSchedule(ctx, req.Uuid)
+	if err != nil {
+		return nil, err
+	}
+	return scheduleStatus(schedule.Status()), nil
+}
+
+func (s *server) DeleteSchedule(ctx context.Context, req *teleportproto.ScheduleId) (*teleportproto.ScheduleStatus, error) {
+	log.Println("Deleting schedule", req.Uuid)
+	_, err := s.findSchedule(ctx, req.Uuid)
+	if err != nil {
+		return nil, err
+	}
+	schedule, err := s.schedules.Delete(jobs.ScheduleID(req.Uuid))
+	if err != nil {
+		return nil, errScheduleNotFound
+	}
+	return scheduleStatus(schedule.Status()), nil
+}
+
+func (s *server) PauseSchedule(ctx context.Context, req *teleportproto.ScheduleId) (*teleportproto.ScheduleStatus, error) {
+	log.Println("Pausing schedule", req.Uuid)
+	schedule, err := s.findSchedule(ctx, req.Uuid)
+	if err != nil {
+		return nil, err
+	}
+	schedule.Pause()
+	return scheduleStatus(schedule.Status()), nil
+}
+
+func (s *server) ResumeSchedule(ctx context.Context, req *teleportproto.ScheduleId) (*teleportproto.ScheduleStatus, error) {
+	log.Println("Resuming schedule", req.Uuid)
+	schedule, err := s.findSchedule(ctx, req.Uuid)
+	if err != nil {
+		return nil, err
+	}
+	schedule.Resume()
+	return scheduleStatus(schedule.Status()), nil
+}
+
+func (s *server) StartWorkflow(ctx context.Context, req *teleportproto.WorkflowRequest) (*teleportproto.WorkflowStatus, error) {
+	log.Println("Starting workflow with", len(req.Steps), "steps")
+	steps := make([]jobs.Step, 0, len(req.Steps))
+	user, err := s.user(ctx)
+	if err != nil {
+		return nil, err
+	}
+	for _, step := range req.Steps {
+		if step.Command == nil {
+			return nil, errInvalidCommand
+		}
+		spec := jobSpec(step.Command)
+		spec.Owner = principal(ctx)
+		spec.User = user
+		steps = append(steps, jobs.Step{Name: step.Name, DependsOn: step.DependsOn, Job: spec})
+	}
+	workflow, err := s.workflows.Create(steps)
+	if err != nil {
+		if err == jobs.ErrInvalidWorkflow {
+			return nil, errInvalidWorkflow
+		}
+		return nil, specError(err)
+	}
+	return workflowStatus(workflow.Status()), nil
+}
+
+func (s *server) GetWorkflow(ctx context.Context, req *teleportproto.WorkflowId) (*teleportproto.WorkflowStatus, error) {
+	log.Println("Showing status for workflow", req.Uuid)
+	workflow, err := s.findWorkflow(ctx, req.Uuid)
+	if err != nil {
+		return nil, err
+	}
+	return workflowStatus(workflow.Status()), nil
+}
+
+func (s *server) ListWorkflows(ctx context.Context, req *empty.Empty) (*teleportproto.WorkflowList, error) {
+	log.Println("Listing workflows")
+	workflows := s.workflows.List()
+	output := make([]*teleportproto.WorkflowStatus, 0, len(workflows))
+	for _, workflow := range workflows {
+		if workflow.Owner() != principal(ctx) {
+			continue
+		}
+		output = append(output, workflowStatus(workflow.Status()))
+	}
+	return &teleportproto.WorkflowList{Workflows: output}, nil
+}
+
+// Maps errors of creating a job to gRPC errors
+func specError(err error) error {
+	switch err {
+	case jobs.ErrInvalidSpec:
+		return errInvalidCommand
+	case jobs.ErrUnknownLimitClass:
+		return errUnknownLimitClass
+	case jobs.ErrLimitsExceeded:
+		return errLimitsExceeded
+	case jobs.ErrTimeoutsExceeded:
+		return errTimeoutsExceeded
+	}
+	return errCouldNotStartProcess
+}
+
+// Maps errors of writing the input of a job to gRPC errors
+func inputError(err error) error {
+	if err == jobs.ErrNoStdin {
+		return errNoStdin
+	}
+	if err == jobs.ErrNoTerminal {
+		return errNoTerminal
+	}
+	if err == jobs.ErrQueued {
+		return errQueued
+	}
+	return status.Error(codes.Internal, err.Error())
 }
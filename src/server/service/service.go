@@ -3,7 +3,9 @@ package service
 import (
 	"fmt"
 	"net"
+	"time"
 
+	"github.com/szymonwieloch/go-teleport/server/jobs"
 	"github.com/szymonwieloch/go-teleport/server/proto/teleportproto"
 	"google.golang.org/grpc"
 )
@@ -13,7 +15,39 @@ type ServiceOptions struct {
 	AuthKey  string
 	AuthCert string
 	Secret   string
-	Limits   bool
+	// Secrets of named principals, the main secret authenticates the default principal
+	Principals   map[string]string
+	Limits       bool
+	EnvAllowlist []string
+	// Time given to jobs to finish after the stop signal if the client does not request otherwise
+	StopGracePeriod time.Duration
+	// Named sets of resource limits that jobs can request
+	LimitClasses map[string]jobs.Limits
+	// Class of jobs that do not request any
+	DefaultLimitClass string
+	// Maximal resource limits of a single job
+	MaxLimits jobs.Limits
+	// Block IO limits of every job
+	IO jobs.IOLimits
+	// Maximal number of processes of all jobs together, zero means unlimited
+	TotalPids int64
+	// Timeouts of jobs that do not request any
+	DefaultTimeouts jobs.Timeouts
+	// Maximal timeouts of a single job, zero means no maximum
+	MaxTimeouts jobs.Timeouts
+	// Unix users that jobs of the principals run as, jobs run as the server user if empty
+	Users map[string]jobs.User
+	// Maximal number of running jobs, in total and of a single principal, zero means unlimited
+	MaxRunning             int
+	MaxRunningPerPrincipal int
+	// When finished jobs are removed, they are kept until removed explicitly if zero
+	Retention jobs.Retention
+	// Directory where jobs are recorded to survive restarts of the server, kept only in memory if empty
+	StoreDir string
+	// Directory where logs are spilled from memory, all logs are kept in memory if empty
+	LogDir string
+	// When logs are spilled to disk and when they are dropped, limits of single jobs apply also without a log directory
+	LogLimits jobs.LogLimits
 }
 
 type Service struct {
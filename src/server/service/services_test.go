@@ -1,12 +1,17 @@
 package service
 
 import (
+	"context"
 	"slices"
+	"syscall"
 	"testing"
 	"time"
 
 	"github.com/stretchr/testify/assert"
 	"github.com/szymonwieloch/go-teleport/server/jobs"
+	"github.com/szymonwieloch/go-teleport/server/proto/teleportproto"
+	"google.golang.org/protobuf/types/known/durationpb"
+	"google.golang.org/protobuf/types/known/timestamppb"
 )
 
 func TestPendingJobStatus(t *testing.T) {
@@ -18,7 +23,7 @@ func TestPendingJobStatus(t *testing.T) {
 
 	status := jobs.JobStatus{
 		ID:      jobs.JobID(id),
-		Command: cmd,
+		Spec:    jobs.Spec{Command: cmd},
 		Started: then,
 		Logs:    23,
 		Stopped: nil,
@@ -52,13 +57,14 @@ func TestStoppedJobStatus(t *testing.T) {
 
 	status := jobs.JobStatus{
 		ID:      jobs.JobID(id),
-		Command: cmd,
+		Spec:    jobs.Spec{Command: cmd},
 		Started: then,
 		Logs:    23,
 		Pending: nil,
 		Stopped: &jobs.StoppedJobStatus{
-			ExitCode: 2,
-			Stopped:  later,
+			ExitCode:    2,
+			Stopped:     later,
+			Termination: jobs.TerminationKill,
 		},
 	}
 	grpcStatus := jobStatus(status)
@@ -72,11 +78,365 @@ func TestStoppedJobStatus(t *testing.T) {
 	assert.Nil(t, grpcStatus.GetPending())
 	assert.Equal(t, grpcStatus.GetStopped().Stopped.AsTime(), later)
 	assert.Equal(t, grpcStatus.GetStopped().ErrorCode, int32(2))
+	assert.Equal(t, grpcStatus.GetStopped().Termination, teleportproto.Termination_T_KILL)
+}
+
+func TestQueuedJobStatus(t *testing.T) {
+	submitted := time.Date(2009, 11, 17, 20, 34, 58, 0, time.UTC)
+	status := jobs.JobStatus{
+		ID:        "36e48d8e-a44f-4f2e-803e-8353355ded6d",
+		Spec:      jobs.Spec{Command: []string{"make"}, Priority: -5},
+		Submitted: submitted,
+		Queued:    &jobs.QueuedJobStatus{Position: 3},
+	}
+	grpcStatus := jobStatus(status)
+	assert.Nil(t, grpcStatus.Started)
+	assert.Equal(t, submitted, grpcStatus.Submitted.AsTime())
+	assert.Equal(t, uint32(3), grpcStatus.GetQueued().Position)
+	assert.Equal(t, int32(-5), grpcStatus.Command.Priority)
+	assert.Equal(t, -5, jobSpec(grpcStatus.Command).Priority)
+
+	status.Queued = nil
+	status.Stopped = &jobs.StoppedJobStatus{ExitCode: -1, Termination: jobs.TerminationCancel}
+	grpcStatus = jobStatus(status)
+	assert.Equal(t, teleportproto.Termination_T_CANCEL, grpcStatus.GetStopped().Termination)
+
+	status.Stopped.Termination = jobs.TerminationLost
+	grpcStatus = jobStatus(status)
+	assert.Equal(t, teleportproto.Termination_T_LOST, grpcStatus.GetStopped().Termination)
 }
 
-func TestValidSecret(t *testing.T) {
-	assert.False(t, validSecret([]string{}, "password"))
-	assert.False(t, validSecret([]string{"", ""}, "password"))
-	assert.False(t, validSecret([]string{"Bearer Ole!"}, "password"))
-	assert.True(t, validSecret([]string{"Bearer password"}, "password"))
+func TestPipelineJobStatus(t *testing.T) {
+	cmd := &teleportproto.Command{
+		Command:  []string{"cat", "access.log"},
+		Pipeline: []*teleportproto.Stage{{Command: []string{"grep", "GET"}}, {Command: []string{"wc", "-l"}}},
+	}
+	spec := jobSpec(cmd)
+	assert.Equal(t, [][]string{{"grep", "GET"}, {"wc", "-l"}}, spec.Pipeline)
+	status := jobs.JobStatus{
+		ID:      "36e48d8e-a44f-4f2e-803e-8353355ded6d",
+		Spec:    spec,
+		Stopped: &jobs.StoppedJobStatus{ExitCode: 1, StageExitCodes: []int{0, 1, 0}},
+	}
+	grpcStatus := jobStatus(status)
+	assert.Equal(t, cmd.String(), grpcStatus.Command.String())
+	assert.Equal(t, []int32{0, 1, 0}, grpcStatus.GetStopped().StageErrorCodes)
+	assert.Nil(t, jobSpec(&teleportproto.Command{Command: []string{"ls"}}).Pipeline)
+}
+
+func TestStoppedJobStatusTermination(t *testing.T) {
+	status := jobs.JobStatus{
+		ID:   "36e48d8e-a44f-4f2e-803e-8353355ded6d",
+		Spec: jobs.Spec{Command: []string{"make"}},
+		Stopped: &jobs.StoppedJobStatus{
+			ExitCode:  -1,
+			Signal:    syscall.SIGKILL,
+			OOMKilled: true,
+			Reason:    jobs.StopReasonNone,
+			WaitError: "signal: killed",
+		},
+	}
+	stopped := jobStatus(status).GetStopped()
+	assert.Equal(t, "KILL", stopped.Signal)
+	assert.True(t, stopped.OomKilled)
+	assert.False(t, stopped.CoreDumped)
+	assert.Equal(t, teleportproto.StopReason_SR_NONE, stopped.Reason)
+	assert.Equal(t, "signal: killed", stopped.WaitError)
+
+	status.Stopped = &jobs.StoppedJobStatus{Signal: syscall.SIGABRT, CoreDumped: true, Reason: jobs.StopReasonShutdown}
+	stopped = jobStatus(status).GetStopped()
+	assert.Equal(t, "ABRT", stopped.Signal)
+	assert.True(t, stopped.CoreDumped)
+	assert.Equal(t, teleportproto.StopReason_SR_SHUTDOWN, stopped.Reason)
+	status.Stopped = &jobs.StoppedJobStatus{Reason: jobs.StopReasonUser}
+	stopped = jobStatus(status).GetStopped()
+	assert.Empty(t, stopped.Signal)
+	assert.Equal(t, teleportproto.StopReason_SR_USER, stopped.Reason)
+	assert.Equal(t, "40", signalName(syscall.Signal(40)))
+}
+
+func TestWorkflowStatus(t *testing.T) {
+	created := time.Date(2009, 11, 17, 20, 34, 58, 0, time.UTC)
+	build := jobs.Step{Name: "build", Job: jobs.Spec{Command: []string{"make"}, Workflow: "wf"}}
+	test := jobs.Step{Name: "test", DependsOn: []string{"build"}, Job: jobs.Spec{Command: []string{"make", "test"}, Workflow: "wf"}}
+	status := jobs.WorkflowStatus{
+		ID:      "wf",
+		Created: created,
+		Steps: []jobs.StepStatus{
+			{Step: build, State: jobs.StepFailed, Error: "no make"},
+			{Step: test, State: jobs.StepSkipped},
+		},
+	}
+	grpcStatus := workflowStatus(status)
+	assert.Equal(t, "wf", grpcStatus.Id.Uuid)
+	assert.Equal(t, created, grpcStatus.Created.AsTime())
+	assert.Nil(t, grpcStatus.Finished)
+	assert.Len(t, grpcStatus.Steps, 2)
+	assert.Equal(t, teleportproto.StepState_S_FAILED, grpcStatus.Steps[0].State)
+	assert.Equal(t, "no make", grpcStatus.Steps[0].Error)
+	assert.Nil(t, grpcStatus.Steps[0].Job)
+	assert.Equal(t, teleportproto.StepState_S_SKIPPED, grpcStatus.Steps[1].State)
+	assert.Equal(t, []string{"build"}, grpcStatus.Steps[1].Step.DependsOn)
+	assert.Equal(t, []string{"make", "test"}, grpcStatus.Steps[1].Step.Command.Command)
+
+	status.Finished = created
+	status.Steps[0].State = jobs.StepRunning
+	status.Steps[0].Job = &jobs.JobStatus{ID: "job", Spec: build.Job, Pending: &jobs.PendingJobStatus{}}
+	grpcStatus = workflowStatus(status)
+	assert.Equal(t, created, grpcStatus.Finished.AsTime())
+	assert.Equal(t, teleportproto.StepState_S_RUNNING, grpcStatus.Steps[0].State)
+	assert.Equal(t, "wf", grpcStatus.Steps[0].Job.WorkflowId.Uuid)
+}
+
+func TestAuthenticate(t *testing.T) {
+	secrets := secrets(ServiceOptions{Secret: "password", Principals: map[string]string{"team": "token"}})
+	_, ok := authenticate([]string{}, secrets)
+	assert.False(t, ok)
+	_, ok = authenticate([]string{"", ""}, secrets)
+	assert.False(t, ok)
+	_, ok = authenticate([]string{"Bearer Ole!"}, secrets)
+	assert.False(t, ok)
+	p, ok := authenticate([]string{"Bearer password"}, secrets)
+	assert.True(t, ok)
+	assert.Equal(t, DefaultPrincipal, p)
+	p, ok = authenticate([]string{"Bearer token"}, secrets)
+	assert.True(t, ok)
+	assert.Equal(t, "team", p)
+}
+
+func TestUser(t *testing.T) {
+	s := server{}
+	user, err := s.user(context.Background())
+	assert.NoError(t, err)
+	assert.Nil(t, user)
+
+	s.users = map[string]jobs.User{"team": {Uid: 1000, Gid: 100}}
+	ctx := context.WithValue(context.Background(), principalKey{}, "team")
+	user, err = s.user(ctx)
+	assert.NoError(t, err)
+	assert.Equal(t, &jobs.User{Principal: "team", Uid: 1000, Gid: 100}, user)
+	assert.Equal(t, uint32(1000), jobStatus(jobs.JobStatus{Spec: jobs.Spec{User: user}, Pending: &jobs.PendingJobStatus{}}).User.Uid)
+
+	// unauthenticated clients are the default principal
+	_, err = s.user(context.Background())
+	assert.Equal(t, errUnmappedPrincipal, err)
+}
+
+func TestJobSpec(t *testing.T) {
+	cmd := teleportproto.Command{
+		Command:    []string{"go", "build"},
+		Env:        map[string]string{"GOFLAGS": "-mod=mod"},
+		WorkingDir: "/home/user",
+		EnvPolicy:  teleportproto.EnvPolicy_EP_CLEAN,
+	}
+	spec := jobSpec(&cmd)
+	assert.Equal(t, []string{"go", "build"}, spec.Command)
+	assert.Equal(t, map[string]string{"GOFLAGS": "-mod=mod"}, spec.Env)
+	assert.Equal(t, "/home/user", spec.Dir)
+	assert.True(t, spec.CleanEnv)
+
+	back := command(spec)
+	assert.Equal(t, cmd.Command, back.Command)
+	assert.Equal(t, map[string]string{"GOFLAGS": jobs.RedactedValue}, back.Env)
+	assert.Equal(t, cmd.WorkingDir, back.WorkingDir)
+	assert.Equal(t, cmd.EnvPolicy, back.EnvPolicy)
+}
+
+func TestJobSpecTerminal(t *testing.T) {
+	cmd := teleportproto.Command{
+		Command:    []string{"top"},
+		Tty:        true,
+		WindowSize: &teleportproto.WindowSize{Rows: 50, Cols: 200},
+	}
+	spec := jobSpec(&cmd)
+	assert.True(t, spec.Tty)
+	assert.Equal(t, jobs.WindowSize{Rows: 50, Cols: 200}, spec.WindowSize)
+
+	back := command(spec)
+	assert.True(t, back.Tty)
+	assert.Equal(t, uint32(50), back.WindowSize.Rows)
+	assert.Equal(t, uint32(200), back.WindowSize.Cols)
+
+	assert.Nil(t, command(jobs.Spec{Command: []string{"top"}}).WindowSize)
+}
+
+func TestJobSpecLimits(t *testing.T) {
+	cmd := teleportproto.Command{
+		Command:    []string{"make"},
+		LimitClass: "large",
+		Limits:     &teleportproto.Limits{Memory: 1 << 30, Cpus: 1.5},
+	}
+	spec := jobSpec(&cmd)
+	assert.Equal(t, "large", spec.LimitClass)
+	assert.Equal(t, jobs.Limits{Memory: 1 << 30, CPUs: 1.5}, spec.Limits)
+
+	back := command(spec)
+	assert.Equal(t, "large", back.LimitClass)
+	assert.Equal(t, int64(1<<30), back.Limits.Memory)
+	assert.Equal(t, 1.5, back.Limits.Cpus)
+	assert.Zero(t, back.Limits.Pids)
+
+	assert.Nil(t, command(jobs.Spec{Command: []string{"make"}}).Limits)
+}
+
+func TestJobSpecIsolation(t *testing.T) {
+	cmd := teleportproto.Command{
+		Command:   []string{"make"},
+		Isolation: &teleportproto.Isolation{Namespaces: true, Network: teleportproto.Network_N_NONE},
+	}
+	spec := jobSpec(&cmd)
+	assert.Equal(t, jobs.Isolation{Namespaces: true, Network: jobs.NetworkNone}, spec.Isolation)
+
+	back := command(spec)
+	assert.True(t, back.Isolation.Namespaces)
+	assert.Equal(t, teleportproto.Network_N_NONE, back.Isolation.Network)
+
+	assert.Nil(t, command(jobs.Spec{Command: []string{"make"}}).Isolation)
+}
+
+func TestJobSpecTimeouts(t *testing.T) {
+	cmd := teleportproto.Command{
+		Command:    []string{"make"},
+		MaxRuntime: durationpb.New(time.Hour),
+	}
+	spec := jobSpec(&cmd)
+	assert.Equal(t, jobs.Timeouts{MaxRuntime: time.Hour}, spec.Timeouts)
+
+	back := command(spec)
+	assert.Equal(t, time.Hour, back.MaxRuntime.AsDuration())
+	assert.Nil(t, back.IdleTimeout)
+
+	status := jobs.JobStatus{
+		Timeouts: jobs.Timeouts{IdleTimeout: time.Minute},
+		Stopped:  &jobs.StoppedJobStatus{Termination: jobs.TerminationKill, Timeout: jobs.TimeoutIdle},
+	}
+	grpcStatus := jobStatus(status)
+	assert.Equal(t, time.Minute, grpcStatus.IdleTimeout.AsDuration())
+	assert.Nil(t, grpcStatus.MaxRuntime)
+	assert.Equal(t, teleportproto.Timeout_TO_IDLE, grpcStatus.GetStopped().Timeout)
+}
+
+func TestJobSpecRestart(t *testing.T) {
+	cmd := teleportproto.Command{
+		Command: []string{"daemon"},
+		Restart: &teleportproto.Restart{
+			Policy:     teleportproto.RestartPolicy_RP_ON_FAILURE,
+			MaxRetries: 5,
+			Backoff:    durationpb.New(time.Second),
+		},
+	}
+	spec := jobSpec(&cmd)
+	assert.Equal(t, jobs.Restart{Policy: jobs.RestartOnFailure, MaxRetries: 5, Backoff: time.Second}, spec.Restart)
+
+	back := command(spec)
+	assert.Equal(t, teleportproto.RestartPolicy_RP_ON_FAILURE, back.Restart.Policy)
+	assert.Equal(t, uint32(5), back.Restart.MaxRetries)
+	assert.Nil(t, back.Restart.MaxBackoff)
+	assert.Nil(t, command(jobs.Spec{Command: []string{"make"}}).Restart)
+
+	status := jobs.JobStatus{
+		Attempts: []jobs.Attempt{{ExitCode: 1, Logs: 3}, {ExitCode: 0, FirstLog: 3, Logs: 1}},
+		Pending:  &jobs.PendingJobStatus{},
+	}
+	grpcStatus := jobStatus(status)
+	if assert.Len(t, grpcStatus.Attempts, 2) {
+		assert.Equal(t, int32(1), grpcStatus.Attempts[0].ErrorCode)
+		assert.Equal(t, uint32(3), grpcStatus.Attempts[1].FirstLog)
+	}
+}
+
+func TestJobScheduleSpec(t *testing.T) {
+	cmd := &teleportproto.Command{Command: []string{"cleanup"}}
+	req := teleportproto.ScheduleRequest{
+		Command: cmd,
+		When:    &teleportproto.ScheduleRequest_Cron{Cron: "0 3 * * *"},
+		Missed:  teleportproto.MissedRunPolicy_MR_RUN_ONCE,
+	}
+	spec, err := jobScheduleSpec(&req)
+	assert.NoError(t, err)
+	assert.Equal(t, "0 3 * * *", spec.Cron)
+	assert.Equal(t, jobs.MissedRunOnce, spec.Missed)
+	assert.Equal(t, []string{"cleanup"}, spec.Job.Command)
+
+	runAt := time.Date(2030, 1, 2, 3, 4, 5, 0, time.UTC)
+	req = teleportproto.ScheduleRequest{Command: cmd, When: &teleportproto.ScheduleRequest_RunAt{RunAt: timestamppb.New(runAt)}}
+	spec, err = jobScheduleSpec(&req)
+	assert.NoError(t, err)
+	assert.True(t, runAt.Equal(spec.RunAt))
+	assert.Equal(t, jobs.MissedSkip, spec.Missed)
+
+	_, err = jobScheduleSpec(&teleportproto.ScheduleRequest{Command: cmd})
+	assert.Equal(t, errInvalidSchedule, err)
+	req.Missed = 7
+	_, err = jobScheduleSpec(&req)
+	assert.Equal(t, errInvalidSchedule, err)
+}
+
+func TestScheduleStatus(t *testing.T) {
+	status := jobs.ScheduleStatus{
+		ID:   "schedule",
+		Spec: jobs.ScheduleSpec{Cron: "@daily", Job: jobs.Spec{Command: []string{"report"}}},
+		Runs: []jobs.ScheduledRun{{JobID: "job"}, {Error: "could not start"}},
+	}
+	grpcStatus := scheduleStatus(status)
+	assert.Equal(t, "schedule", grpcStatus.Id.Uuid)
+	assert.Equal(t, "@daily", grpcStatus.Request.GetCron())
+	assert.Nil(t, grpcStatus.NextRun)
+	if assert.Len(t, grpcStatus.Runs, 2) {
+		assert.Equal(t, "job", grpcStatus.Runs[0].JobId.Uuid)
+		assert.Nil(t, grpcStatus.Runs[1].JobId)
+		assert.Equal(t, "could not start", grpcStatus.Runs[1].Error)
+	}
+
+	job := jobs.JobStatus{Spec: jobs.Spec{Schedule: "schedule"}, Pending: &jobs.PendingJobStatus{}}
+	assert.Equal(t, "schedule", jobStatus(job).ScheduleId.Uuid)
+	job.Spec.Schedule = ""
+	assert.Nil(t, jobStatus(job).ScheduleId)
+}
+
+func TestStopOptions(t *testing.T) {
+	id := &teleportproto.JobId{Uuid: "36e48d8e-a44f-4f2e-803e-8353355ded6d"}
+	opts, err := stopOptions(&teleportproto.StopRequest{Id: id})
+	assert.NoError(t, err)
+	assert.Equal(t, jobs.StopOptions{}, opts)
+
+	opts, err = stopOptions(&teleportproto.StopRequest{
+		Id:          id,
+		Signal:      "INT",
+		GracePeriod: durationpb.New(30 * time.Second),
+	})
+	assert.NoError(t, err)
+	assert.Equal(t, jobs.StopOptions{Signal: syscall.SIGINT, GracePeriod: 30 * time.Second}, opts)
+
+	_, err = stopOptions(&teleportproto.StopRequest{Id: id, Signal: "BLAH"})
+	assert.Equal(t, errInvalidSignal, err)
+	_, err = stopOptions(&teleportproto.StopRequest{Id: id, GracePeriod: durationpb.New(-time.Second)})
+	assert.Equal(t, errInvalidGracePeriod, err)
+}
+
+func TestLogQuery(t *testing.T) {
+	since := time.Date(2024, 1, 1, 12, 0, 0, 0, time.UTC)
+	req := teleportproto.LogsRequest{
+		Start:    5,
+		Tail:     100,
+		Since:    timestamppb.New(since),
+		NoFollow: true,
+		Filter:   teleportproto.LogFilter_LF_STDERR,
+	}
+	assert.Equal(t, jobs.LogQuery{Start: 5, Tail: 100, Since: since, Stderr: true}, logQuery(&req))
+	assert.Equal(t, jobs.LogQuery{Follow: true}, logQuery(&teleportproto.LogsRequest{}))
+}
+
+func TestLogMessage(t *testing.T) {
+	then := time.Date(2024, 1, 1, 12, 0, 0, 0, time.UTC)
+	msg := logMessage(jobs.LogEntry{Line: "error", Timestamp: then, Index: 7})
+	assert.Equal(t, "error", msg.Text)
+	assert.Equal(t, teleportproto.LogSource_LS_STDERR, msg.Src)
+	assert.Equal(t, uint64(7), msg.Sequence)
+	assert.Equal(t, then, msg.Timestamp.AsTime())
+
+	marker := logMessage(jobs.LogEntry{Index: 9, Dropped: 5})
+	assert.Equal(t, uint32(5), marker.Dropped)
+	assert.Equal(t, uint64(9), marker.Sequence)
+	assert.Nil(t, marker.Timestamp)
 }